@@ -0,0 +1,197 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+// RabbitConfig is the RabbitMQ results of rooms are published to
+type RabbitConfig struct {
+	Host        string `json:"host,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	ResultQueue string `json:"resultQueue,omitempty"`
+
+	// CredentialsSecret is the secret of the manager namespace Gimulators read the credentials from
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+}
+
+// S3Config is the object storage settings, rules, logs, datasets and outputs are kept in
+type S3Config struct {
+	URL       string `json:"url,omitempty"`
+	AccessKey string `json:"accessKey,omitempty"`
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// NetworkConfig is the cluster services pods of isolated rooms are allowed to reach
+type NetworkConfig struct {
+	// DNS are the peers serving DNS to pods, the kube-dns pods of kube-system by default
+	DNS []networkingv1.NetworkPolicyPeer `json:"dns,omitempty"`
+
+	// ObjectStore are the peers serving s3.url to pods fetching source code from it.
+	// Isolated rooms with source code are rejected if it is not set.
+	ObjectStore []networkingv1.NetworkPolicyPeer `json:"objectStore,omitempty"`
+
+	// Registry are the peers serving the repositories images of submissions are built from and pushed to.
+	// Isolated rooms building images are rejected if it is not set.
+	Registry []networkingv1.NetworkPolicyPeer `json:"registry,omitempty"`
+}
+
+// GimulatorConfig is how the manager talks to Gimulators of rooms
+type GimulatorConfig struct {
+	// Token the manager reports statuses of participants with
+	Token string `json:"token,omitempty"`
+	Port  int32  `json:"port,omitempty"`
+}
+
+// ImagesConfig is images of the helper pods the manager runs
+type ImagesConfig struct {
+	Builder           string `json:"builder,omitempty"`
+	Pusher            string `json:"pusher,omitempty"`
+	SourceFetcher     string `json:"sourceFetcher,omitempty"`
+	ObjectStoreClient string `json:"objectStoreClient,omitempty"`
+	WarmerHelper      string `json:"warmerHelper,omitempty"`
+	WarmerPause       string `json:"warmerPause,omitempty"`
+}
+
+// TenantConfig is the defaults of rooms in a namespace, so competitions of several tenants can share a manager
+type TenantConfig struct {
+	Namespace string `json:"namespace"`
+
+	// ResultQueue is the RabbitMQ queue results are published to, rabbit.resultQueue if not set
+	ResultQueue string `json:"resultQueue,omitempty"`
+
+	// BucketPrefix is prepended to the buckets settings, rules, logs, datasets and outputs are kept in.
+	// Buckets set explicitly by datasets are not prefixed.
+	BucketPrefix string `json:"bucketPrefix,omitempty"`
+
+	// ImagePullSecrets are used by rooms which set none themselves, instead of the registry secret
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+}
+
+// ShardingConfig splits rooms between replicas of the manager by a hash of their ID.
+// Every shard elects a leader of its own.
+type ShardingConfig struct {
+	// Shards is the number of shards, rooms are not sharded if it is less than two
+	Shards int32 `json:"shards,omitempty"`
+
+	// Shard is the shard of this replica. Replicas of a StatefulSet leave it unset,
+	// their shard is the ordinal in their hostname.
+	Shard *int32 `json:"shard,omitempty"`
+}
+
+// LocalConfig replaces the external services for running the manager outside the cluster
+type LocalConfig struct {
+	// ObjectStoreDir is the directory objects are kept in instead of S3
+	ObjectStoreDir string `json:"objectStoreDir,omitempty"`
+
+	// ResultsFile is the file results are appended to as JSON lines instead of being published to RabbitMQ
+	ResultsFile string `json:"resultsFile,omitempty"`
+}
+
+// RateLimiterConfig is how rooms failing to reconcile are retried. Failing rooms back off
+// exponentially from BaseDelay to MaxDelay, and retries of all rooms are limited to QPS with bursts of Burst.
+type RateLimiterConfig struct {
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	MaxDelay  metav1.Duration `json:"maxDelay,omitempty"`
+	QPS       int32           `json:"qps,omitempty"`
+	Burst     int32           `json:"burst,omitempty"`
+}
+
+// RuntimeConfig is the part of the configuration which is reloaded when the file changes.
+// Changes only apply to objects created after the reload.
+type RuntimeConfig struct {
+	ReconcileTimeout metav1.Duration `json:"reconcileTimeout,omitempty"`
+
+	// StepTimeout bounds the steps of a reconcile which call S3, registries or Gimulator,
+	// so a slow service fails its step instead of the time of the whole reconcile running out.
+	// A step also gets at most half of the time left to the reconcile.
+	StepTimeout metav1.Duration `json:"stepTimeout,omitempty"`
+
+	// SandboxUserID is the user, group and file system group contestant code runs as
+	SandboxUserID int64 `json:"sandboxUserID,omitempty"`
+
+	// ImageWarmerNodeSelector is labels of the nodes that images of rooms are pre-pulled on.
+	// All nodes are used if it is empty.
+	ImageWarmerNodeSelector map[string]string `json:"imageWarmerNodeSelector,omitempty"`
+
+	// ImageWarmerUpdateInterval is the minimum time between updates of the images of the warmer,
+	// since each of them restarts its pods on every node
+	ImageWarmerUpdateInterval metav1.Duration `json:"imageWarmerUpdateInterval,omitempty"`
+
+	// SourceVolumeSize is the size of the PVCs source code of submissions is fetched into
+	SourceVolumeSize resource.Quantity `json:"sourceVolumeSize,omitempty"`
+
+	// ObjectStoreCredentialsDuration is how long the credentials of pods copying datasets and outputs
+	// from or to the object store are valid, so it should cover copying the largest dataset
+	ObjectStoreCredentialsDuration metav1.Duration `json:"objectStoreCredentialsDuration,omitempty"`
+
+	Images ImagesConfig `json:"images,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// HubConfig is the configuration file of the hub manager
+type HubConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec configures metrics, leader election and the sync period of the manager
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	// Namespace is where rooms are created, unless they run in their own namespace
+	Namespace string `json:"namespace,omitempty"`
+
+	// AllowRoomNamespaces allows problems to run their rooms in ephemeral namespaces,
+	// which makes the manager watch all namespaces
+	AllowRoomNamespaces bool `json:"allowRoomNamespaces,omitempty"`
+
+	// WatchNamespaces are the namespaces whose rooms are reconciled besides Namespace
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	// ClusterScoped reconciles rooms of all namespaces matching NamespaceSelector instead of
+	// Namespace and WatchNamespaces. All namespaces match if NamespaceSelector is not set.
+	ClusterScoped     bool                  `json:"clusterScoped,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	Sharding ShardingConfig `json:"sharding,omitempty"`
+
+	RateLimiter RateLimiterConfig `json:"rateLimiter,omitempty"`
+
+	// Tenants are the defaults of rooms in their namespaces
+	Tenants []TenantConfig `json:"tenants,omitempty"`
+
+	// OTLPEndpoint is the OTLP collector traces are exported to. Tracing is disabled if it is empty.
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty"`
+
+	Rabbit    RabbitConfig    `json:"rabbit,omitempty"`
+	S3        S3Config        `json:"s3,omitempty"`
+	Gimulator GimulatorConfig `json:"gimulator,omitempty"`
+	Network   NetworkConfig   `json:"network,omitempty"`
+	Runtime   RuntimeConfig   `json:"runtime,omitempty"`
+
+	// Local runs the manager without RabbitMQ and S3 if it is set. Rooms which need pods
+	// to reach the object store are rejected.
+	Local *LocalConfig `json:"local,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HubConfig{})
+}
@@ -16,21 +16,180 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// PVCNames are data PVCs mounted by actors and the director.
+// Deprecated: use Volumes of the setting, PVCNames are converted to them.
 type PVCNames struct {
 	Public  []string `json:"public,omitempty" yaml:"public,omitempty"`
 	Private []string `json:"private,omitempty" yaml:"private,omitempty"`
 }
 
+// Dataset is a prefix of the object storage which the operator copies into a PVC,
+// shared by rooms of the problem. The PVC is deleted once no room has used it for
+// controllers.DatasetRetention.
+type Dataset struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Bucket is name.S3DatasetsBucket() of the namespace of the room if not set
+	Bucket string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	Prefix string `json:"prefix" yaml:"prefix"`
+
+	// Size, StorageClass and AccessModes of the PVC. StorageClass of the setting is used if not set,
+	// AccessModes is ReadWriteMany if empty, since pods of rooms on any node mount the PVC.
+	Size         string                              `json:"size" yaml:"size"`
+	StorageClass string                              `json:"storageClass,omitempty" yaml:"storageClass,omitempty"`
+	AccessModes  []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty" yaml:"accessModes,omitempty"`
+}
+
+// Volume is a data PVC, or the PVC of a dataset, mounted into pods of a problem
+type Volume struct {
+	PVCName string `json:"pvcName,omitempty" yaml:"pvcName,omitempty"`
+	Dataset string `json:"dataset,omitempty" yaml:"dataset,omitempty"`
+
+	// MountPath is name.DataVolumeMountPath() of PVCName or Dataset if not set
+	MountPath string `json:"mountPath,omitempty" yaml:"mountPath,omitempty"`
+	SubPath   string `json:"subPath,omitempty" yaml:"subPath,omitempty"`
+	// ReadOnly is true if not set
+	ReadOnly *bool `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+
+	// Roles receiving the volume, including the "director" and "gimulator" roles.
+	// Every actor and the director receive it if empty.
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+// OutputVolumeType is the kind of volume outputs of actors are written to
+type OutputVolumeType string
+
+const (
+	// OutputVolumePVC is a PVC of the actor, shared with the director
+	OutputVolumePVC OutputVolumeType = "pvc"
+	// OutputVolumeEphemeral is a generic ephemeral volume, deleted along with the actor pod
+	OutputVolumeEphemeral OutputVolumeType = "ephemeral"
+	// OutputVolumeEmptyDir is an emptyDir volume limited to OutputVolumeSize
+	OutputVolumeEmptyDir OutputVolumeType = "emptyDir"
+)
+
+// OutputRetentionPolicy is how long output PVCs of actors outlive their room
+type OutputRetentionPolicy string
+
+const (
+	// OutputRetentionDelete deletes output PVCs along with their room
+	OutputRetentionDelete OutputRetentionPolicy = "delete"
+	// OutputRetentionKeep keeps output PVCs for KeepForHours after their room is deleted
+	OutputRetentionKeep OutputRetentionPolicy = "keep"
+	// OutputRetentionUntilUploaded uploads output PVCs to the object storage after their room
+	// is deleted and deletes them once they are uploaded
+	OutputRetentionUntilUploaded OutputRetentionPolicy = "untilUploaded"
+)
+
+// OutputRetention decides what happens to output PVCs once their room is deleted
+type OutputRetention struct {
+	Policy       OutputRetentionPolicy `json:"policy,omitempty" yaml:"policy,omitempty"`
+	KeepForHours int32                 `json:"keepForHours,omitempty" yaml:"keepForHours,omitempty"`
+}
+
+// OutputSettings is where outputs of actors are written and mounted
+type OutputSettings struct {
+	// MountPath is the output of an actor in its pod, name.OutputVolumeMountPath() if not set
+	MountPath string `json:"mountPath,omitempty" yaml:"mountPath,omitempty"`
+	// DirectorMountPath contains outputs of actors by their name in the director pod,
+	// name.DirectorOutputMountPath() if not set
+	DirectorMountPath string `json:"directorMountPath,omitempty" yaml:"directorMountPath,omitempty"`
+
+	// Volume is OutputVolumePVC if not set. Other volumes belong to the actor pod,
+	// so they are not mounted into the director pod.
+	Volume OutputVolumeType `json:"volume,omitempty" yaml:"volume,omitempty"`
+	// Retention only applies to OutputVolumePVC, OutputRetentionDelete is used if not set
+	Retention *OutputRetention `json:"retention,omitempty" yaml:"retention,omitempty"`
+}
+
 type GimulatorSettings struct {
 	Image     string                       `json:"image" yaml:"image"`
 	Resources *corev1.ResourceRequirements `json:"resources,omitempty" yaml:"resources,omitempty"`
 }
 
+// NamespaceSettings makes rooms of a problem run in their own namespace,
+// limited by the given quota and default limits
+type NamespaceSettings struct {
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resourceQuota,omitempty" yaml:"resourceQuota,omitempty"`
+	LimitRange    *corev1.LimitRangeSpec    `json:"limitRange,omitempty" yaml:"limitRange,omitempty"`
+}
+
+// NetworkSettings describes the network isolation of rooms. Actors and the director
+// can only reach their own gimulator, unless more destinations are allowed by Egress.
+type NetworkSettings struct {
+	Disabled bool                                   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	Egress   []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty" yaml:"egress,omitempty"`
+}
+
+// SandboxProfile names a set of security restrictions applied to actor and director pods
+type SandboxProfile string
+
+const (
+	// SandboxProfileDefault drops capabilities and privilege escalation and applies the runtime's seccomp profile
+	SandboxProfileDefault SandboxProfile = "default"
+	// SandboxProfileStrict is SandboxProfileDefault plus a read-only root filesystem and a writable /tmp
+	SandboxProfileStrict SandboxProfile = "strict"
+	// SandboxProfileCustom applies only the restrictions given in SandboxSettings
+	SandboxProfileCustom SandboxProfile = "custom"
+)
+
+// SandboxSettings describes how contestant code is sandboxed
+type SandboxSettings struct {
+	Profile          SandboxProfile `json:"profile,omitempty" yaml:"profile,omitempty"`
+	RuntimeClassName *string        `json:"runtimeClassName,omitempty" yaml:"runtimeClassName,omitempty"`
+
+	// The fields below are only used by SandboxProfileCustom
+	ReadOnlyRootFilesystem       *bool                  `json:"readOnlyRootFilesystem,omitempty" yaml:"readOnlyRootFilesystem,omitempty"`
+	AllowPrivilegeEscalation     *bool                  `json:"allowPrivilegeEscalation,omitempty" yaml:"allowPrivilegeEscalation,omitempty"`
+	DropCapabilities             []corev1.Capability    `json:"dropCapabilities,omitempty" yaml:"dropCapabilities,omitempty"`
+	SeccompProfile               *corev1.SeccompProfile `json:"seccompProfile,omitempty" yaml:"seccompProfile,omitempty"`
+	AutomountServiceAccountToken *bool                  `json:"automountServiceAccountToken,omitempty" yaml:"automountServiceAccountToken,omitempty"`
+}
+
+// ImagePolicy restricts the images actors may run
+type ImagePolicy struct {
+	// AllowedRepositories are fully qualified repositories or their parents, e.g. "docker.io/roboepics".
+	// Every image is allowed if it is empty.
+	AllowedRepositories []string `json:"allowedRepositories,omitempty" yaml:"allowedRepositories,omitempty"`
+	// RequireDigest rejects images which are not pinned to a digest
+	RequireDigest bool `json:"requireDigest,omitempty" yaml:"requireDigest,omitempty"`
+	// ResolveDigests pins tags of images to their digests when the room is created.
+	// Rooms are rejected if the registry does not serve an image of an actor or its containers.
+	ResolveDigests bool `json:"resolveDigests,omitempty" yaml:"resolveDigests,omitempty"`
+}
+
+// BenchmarkSettings makes actors run with equal and isolated resources
+type BenchmarkSettings struct {
+	// CPUModelLabel is the label of nodes holding their CPU model, name.CPUModelLabel() if not set
+	CPUModelLabel string `json:"cpuModelLabel,omitempty" yaml:"cpuModelLabel,omitempty"`
+}
+
+// Placement constrains the nodes pods are scheduled on
+type Placement struct {
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty" yaml:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty" yaml:"tolerations,omitempty"`
+	Affinity     *corev1.Affinity    `json:"affinity,omitempty" yaml:"affinity,omitempty"`
+
+	// DisableColocation stops preferring the node of other pods of the room
+	// and nodes without pods of other rooms
+	DisableColocation bool `json:"disableColocation,omitempty" yaml:"disableColocation,omitempty"`
+}
+
+// RoleSettings are settings of actors of a role. Placement of the gimulator and the director,
+// and containers of the director are taken from the "gimulator" and "director" roles.
 type RoleSettings struct {
 	Resources *corev1.ResourceRequirements `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Placement *Placement                   `json:"placement,omitempty" yaml:"placement,omitempty"`
+
+	// InitContainers run before the main container and Sidecars run along with it.
+	// They share volumes of the main container and get those of its environment variables,
+	// e.g. GIMULATOR_HOST, which they list by name without a value.
+	InitContainers []corev1.Container `json:"initContainers,omitempty" yaml:"initContainers,omitempty"`
+	Sidecars       []corev1.Container `json:"sidecars,omitempty" yaml:"sidecars,omitempty"`
 }
 
 type Setting struct {
@@ -40,16 +199,132 @@ type Setting struct {
 	DefaultResources corev1.ResourceRequirements `json:"defaultResources" yaml:"defaultResources"`
 	Roles            map[string]*RoleSettings    `json:"roles,omitempty" yaml:"roles,omitempty"`
 	StorageClass     string                      `json:"storageClass" yaml:"storageClass"`
+
+	// Volumes are data PVCs mounted into pods of the problem
+	Volumes  []Volume        `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	Datasets []Dataset       `json:"datasets,omitempty" yaml:"datasets,omitempty"`
+	Output   *OutputSettings `json:"output,omitempty" yaml:"output,omitempty"`
+
+	// PendingGracePeriod is the number of seconds a pod may stay pending on an
+	// image pull or scheduling problem before it is considered failed
+	PendingGracePeriod uint64 `json:"pendingGracePeriod,omitempty" yaml:"pendingGracePeriod,omitempty"`
+
+	// Namespace makes every room run in an ephemeral namespace of its own if set
+	Namespace *NamespaceSettings `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+
+	// Network isolates rooms by network policies unless it is disabled
+	Network *NetworkSettings `json:"network,omitempty" yaml:"network,omitempty"`
+
+	// Sandbox restricts actor and director pods, SandboxProfileDefault is used if not set
+	Sandbox *SandboxSettings `json:"sandbox,omitempty" yaml:"sandbox,omitempty"`
+
+	// ImagePullSecrets are names of secrets used to pull images of the problem
+	ImagePullSecrets []string     `json:"imagePullSecrets,omitempty" yaml:"imagePullSecrets,omitempty"`
+	ImagePolicy      *ImagePolicy `json:"imagePolicy,omitempty" yaml:"imagePolicy,omitempty"`
+
+	// Placement constrains the nodes of every pod of the problem, Roles may extend it
+	Placement *Placement `json:"placement,omitempty" yaml:"placement,omitempty"`
+
+	// Templates are the runtime templates of source code submissions by name
+	Templates map[string]*RuntimeTemplate `json:"templates,omitempty" yaml:"templates,omitempty"`
+
+	// Benchmark gives actors Guaranteed QoS with whole CPUs, so the CPU manager pins them,
+	// and records where each actor ran
+	Benchmark *BenchmarkSettings `json:"benchmark,omitempty" yaml:"benchmark,omitempty"`
+
+	// PrePullImages keeps director and gimulator images of the problem, and actor images
+	// of rooms which have not started yet, pulled on every node. Only images pinned to
+	// their digest are pre-pulled, actor images are pinned if the image policy resolves digests.
+	PrePullImages bool `json:"prePullImages,omitempty" yaml:"prePullImages,omitempty"`
+
+	// FileSecrets are the secrets files of actors and the director may be taken from.
+	// Credentials of the hub are never allowed, even if they are listed.
+	FileSecrets []string `json:"fileSecrets,omitempty" yaml:"fileSecrets,omitempty"`
+
+	// FileConfigMaps are the ConfigMaps files of actors and the director may be taken from.
+	// ConfigMaps of credentials and rules of rooms are never allowed, even if they are listed.
+	FileConfigMaps []string `json:"fileConfigMaps,omitempty" yaml:"fileConfigMaps,omitempty"`
+}
+
+// File is a small file mounted into a container. Its content is taken from
+// the ConfigMap or the Secret if one of them is set, otherwise from Content.
+// The ConfigMap and the Secret should be in the namespace of the pods of the room,
+// and be one of the FileConfigMaps or the FileSecrets of the setting.
+type File struct {
+	// Path is the absolute path of the file in the container
+	Path string `json:"path"`
+	Mode *int32 `json:"mode,omitempty"`
+
+	Content   string                       `json:"content,omitempty"`
+	ConfigMap *corev1.ConfigMapKeySelector `json:"configMap,omitempty"`
+	Secret    *corev1.SecretKeySelector    `json:"secret,omitempty"`
+}
+
+// SubmissionMode is how source code of a submission is run
+type SubmissionMode string
+
+const (
+	// SubmissionModeBuild builds an image of the source code in the cluster
+	SubmissionModeBuild SubmissionMode = "build"
+	// SubmissionModeInterpret mounts the source code into the image of the template
+	SubmissionModeInterpret SubmissionMode = "interpret"
+)
+
+// RuntimeTemplate defines how submissions of a language or a runtime are run
+type RuntimeTemplate struct {
+	Mode SubmissionMode `json:"mode" yaml:"mode"`
+
+	// Image, Command, Args and WorkingDir run the source code in interpret mode,
+	// the source code is extracted into name.SourceMountPath()
+	Image      string   `json:"image,omitempty" yaml:"image,omitempty"`
+	Command    []string `json:"command,omitempty" yaml:"command,omitempty"`
+	Args       []string `json:"args,omitempty" yaml:"args,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty" yaml:"workingDir,omitempty"`
+
+	// Dockerfile builds the source code in build mode, the source code is its context.
+	// Built images are pushed to Repository with credentials of PushSecret, which the RUN steps
+	// of the Dockerfile can not read. Base images are pulled without credentials.
+	Dockerfile string                       `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"`
+	Repository string                       `json:"repository,omitempty" yaml:"repository,omitempty"`
+	PushSecret string                       `json:"pushSecret,omitempty" yaml:"pushSecret,omitempty"`
+	Resources  *corev1.ResourceRequirements `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// Source is the source code of a submission
+type Source struct {
+	// Object is the gzipped tarball of the source code in the submissions bucket
+	Object string `json:"object"`
+	// Digest is the sha256 digest of the tarball, e.g. "sha256:..."
+	Digest string `json:"digest"`
+	// Template is the name of a runtime template of the problem
+	Template string `json:"template"`
 }
 
 // Actor defines some actor of a Room
 type Actor struct {
-	Name      string                       `json:"name"`
-	Image     string                       `json:"image"`
+	Name string `json:"name"`
+	// Image is set by the operator for actors with a Source
+	Image string `json:"image,omitempty"`
+	// Role can not be "director" or "gimulator", which are the roles of the other pods of the room
 	Role      string                       `json:"role"`
 	Token     string                       `json:"token,omitempty"`
 	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
 	Envs      []corev1.EnvVar              `json:"envs,omitempty"`
+
+	// InitContainers and Sidecars are merged by name into those of the role
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+	Sidecars       []corev1.Container `json:"sidecars,omitempty"`
+
+	// Command, Args and WorkingDir override those of the image if set
+	Command    []string `json:"command,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty"`
+
+	// Files are mounted into the main container
+	Files []File `json:"files,omitempty"`
+
+	// Source is run instead of Image if set
+	Source *Source `json:"source,omitempty"`
 }
 
 // Director defines the director of a Room
@@ -59,6 +334,18 @@ type Director struct {
 	Token     string                       `json:"token,omitempty"`
 	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
 	Envs      []corev1.EnvVar              `json:"envs,omitempty"`
+
+	// InitContainers and Sidecars are merged by name into those of the role
+	InitContainers []corev1.Container `json:"initContainers,omitempty"`
+	Sidecars       []corev1.Container `json:"sidecars,omitempty"`
+
+	// Command, Args and WorkingDir override those of the image if set
+	Command    []string `json:"command,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty"`
+
+	// Files are mounted into the main container
+	Files []File `json:"files,omitempty"`
 }
 
 // RoomSpec defines the desired state of Room
@@ -71,15 +358,75 @@ type RoomSpec struct {
 	Director                *Director          `json:"director"`
 	Timeout                 uint64             `json:"timeout"`
 	TerminateOnActorFailure bool               `json:"terminateOnActorFailure"`
+
+	// ImagePullSecrets overrides the image pull secrets of the setting
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+
+	// Placement extends the placement of the setting for every pod of the room
+	Placement *Placement `json:"placement,omitempty"`
+}
+
+// ActorPlacement is the node an actor ran on and the resources it was given
+type ActorPlacement struct {
+	Node      string                      `json:"node"`
+	CPUModel  string                      `json:"cpuModel,omitempty"`
+	QOSClass  corev1.PodQOSClass          `json:"qosClass,omitempty"`
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 }
 
 // RoomStatus defines the observed state of Room
 type RoomStatus struct {
+	// Namespace is the ephemeral namespace of the room, empty if the room runs in its own namespace
+	Namespace string `json:"namespace,omitempty"`
+
+	// Naming of objects of the room, rooms created before the current naming keep their names
+	Naming RoomNaming `json:"naming,omitempty"`
+
+	// ImagesPinned is true once images of the room are pinned to their digests
+	ImagesPinned bool `json:"imagesPinned,omitempty"`
+
+	// WarmNodes are the nodes which have every image of the room pulled, they are refreshed until pods of the room start.
+	// ImagesWarm is true if there is any, so rooms which start without pulling images can be admitted first.
+	WarmNodes  []string `json:"warmNodes,omitempty"`
+	ImagesWarm bool     `json:"imagesWarm,omitempty"`
+
+	// StartTime is when the gimulator of the room started running and its actors were created,
+	// RunningTime is when every pod of the room was running
+	StartTime   *metav1.Time `json:"startTime,omitempty"`
+	RunningTime *metav1.Time `json:"runningTime,omitempty"`
+
+	// Builds are phases of the pods building images of actors with a Source
+	Builds map[string]corev1.PodPhase `json:"builds,omitempty"`
+
+	// TimedOut is set once an actor of the room reaches the timeout, before the timeout is reported,
+	// so a manager taking over the room reports the timeout and deletes the room instead of running it
+	TimedOut bool `json:"timedOut,omitempty"`
+
+	// ActorPlacements are recorded for auditing rooms of problems in benchmark mode
+	ActorPlacements map[string]*ActorPlacement `json:"actorPlacements,omitempty"`
+
 	GimulatorStatus corev1.PodPhase            `json:"gimulatorStatus"`
 	DirectorStatus  corev1.PodPhase            `json:"directorStatus"`
 	ActorStatuses   map[string]corev1.PodPhase `json:"actorStatuses"`
+
+	// Reasons of pods that failed before they could start
+	GimulatorReason string            `json:"gimulatorReason,omitempty"`
+	DirectorReason  string            `json:"directorReason,omitempty"`
+	ActorReasons    map[string]string `json:"actorReasons,omitempty"`
 }
 
+// RoomNaming is the scheme objects of a room are named by
+type RoomNaming string
+
+const (
+	// RoomNamingHashed derives names from the room ID and the participant, followed by a hash of both
+	RoomNamingHashed RoomNaming = "hashed"
+	// RoomNamingScoped derives names from the room ID and the participant joined without a hash
+	RoomNamingScoped RoomNaming = "scoped"
+	// RoomNamingLegacy derives names from the participant only
+	RoomNamingLegacy RoomNaming = "legacy"
+)
+
 // +kubebuilder:object:root=true
 
 // Room is the Schema for the rooms API
@@ -100,6 +447,14 @@ type RoomList struct {
 	Items           []Room `json:"items"`
 }
 
+// WorkloadNamespace returns the namespace that pods, services, config maps and volumes of the room live in
+func (r *Room) WorkloadNamespace() string {
+	if r.Status.Namespace != "" {
+		return r.Status.Namespace
+	}
+	return r.Namespace
+}
+
 func init() {
 	SchemeBuilder.Register(&Room{}, &RoomList{})
 }
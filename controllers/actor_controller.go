@@ -2,45 +2,67 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	hubv1 "github.com/Gimulator/hub/api/v1"
 	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
 	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/naming"
+	"github.com/Gimulator/hub/pkg/tracing"
 )
 
 // actorReconciler reconciles an actor of a Room object
 type actorReconciler struct {
 	*client.Client
-	Log logr.Logger
+	Log    logr.Logger
+	config *hubconfig.Config
 }
 
 // newActorReconciler returns new instance of ActorReconciler
-func newActorReconciler(client *client.Client, log logr.Logger) (*actorReconciler, error) {
+func newActorReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*actorReconciler, error) {
 	return &actorReconciler{
+		config: config,
 		Log:    log,
 		Client: client,
 	}, nil
 }
 
-func (a *actorReconciler) reconcileActor(ctx context.Context, room *hubv1.Room, actor *hubv1.Actor) error {
-	logger := a.Log.WithValues("reconciler", "Actor", "actor", actor.Name, "room", room.Spec.ID)
+// reconcileActor syncs the output PVC, files and pod of an actor. It returns a reason if the room
+// should be rejected because the pod of the actor can not be created from its setting.
+func (a *actorReconciler) reconcileActor(ctx context.Context, room *hubv1.Room, actor *hubv1.Actor) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "actorReconciler.reconcileActor", attribute.String("room", room.Spec.ID), attribute.String("actor", actor.Name))
+	defer tracing.End(span, &err)
+
+	logger := logging.Logger(ctx, a.Log).WithValues("reconciler", "Actor", "actor", actor.Name)
 
 	logger.Info("starting to reconcile actor's output PVC")
 	if err := a.reconcileOutputPVC(ctx, actor, room); err != nil {
 		logger.Error(err, "could not reconcile actor's output PVC")
-		return err
+		return "", err
+	}
+
+	logger.Info("starting to reconcile actor's files")
+	if cm := filesConfigMap(room, naming.ActorPodName(room, actor.Name), actor.Files); cm != nil {
+		if _, err := a.SyncConfigMap(ctx, cm, room); err != nil {
+			logger.Error(err, "could not reconcile actor's files")
+			return "", err
+		}
 	}
 
 	logger.Info("starting to create actor's manifest")
 	actorPod, err := a.actorPodManifest(actor, room)
 	if err != nil {
-		logger.Error(err, "could not create actor's manifest")
-		return err
+		logger.Info("could not create actor's manifest", "error", err.Error())
+		return fmt.Sprintf("Pod of actor %s could not be created.\n%s", actor.Name, err), nil
 	}
 
 	if room.Status.GimulatorStatus != corev1.PodRunning {
@@ -50,31 +72,46 @@ func (a *actorReconciler) reconcileActor(ctx context.Context, room *hubv1.Room,
 		syncedActorPod, err := a.SyncPod(ctx, actorPod, room)
 		if err != nil {
 			logger.Error(err, "could not sync actor's pod")
-			return err
+			return "", err
 		}
 
 		logger.Info("starting to update status of actor")
 		a.updateActorStatus(room, actor, syncedActorPod)
+
+		if room.Spec.Setting.Benchmark != nil {
+			logger.Info("starting to record placement of actor")
+			if err := a.recordActorPlacement(ctx, room, actor, syncedActorPod); err != nil {
+				logger.Error(err, "could not record placement of actor")
+				return "", err
+			}
+		}
 	}
 
-	return nil
+	return "", nil
 }
 
+// reconcileOutputPVC creates the output PVC of an actor. PVCs kept after their room is deleted are not
+// owned by it and carry their retention policy, which the output controller applies once the room is gone.
 func (a *actorReconciler) reconcileOutputPVC(ctx context.Context, actor *hubv1.Actor, room *hubv1.Room) error {
 	quantity, err := resource.ParseQuantity(room.Spec.Setting.OutputVolumeSize)
 	if err != nil {
 		return err
 	}
 
-	if quantity.IsZero() {
+	if quantity.IsZero() || outputVolumeType(room) != hubv1.OutputVolumePVC {
 		// Actor doesn't need an output PVC
 		return nil
 	}
 
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name.OutputPVCName(actor.Name),
-			Namespace: room.Namespace,
+			Name:      naming.OutputPVCName(room, actor.Name),
+			Namespace: room.WorkloadNamespace(),
+			Labels: map[string]string{
+				name.RoomLabel():    room.Spec.ID,
+				name.ProblemLabel(): room.Spec.ProblemID,
+				name.OutputLabel():  actor.Name,
+			},
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			Resources: corev1.ResourceRequirements{
@@ -87,58 +124,42 @@ func (a *actorReconciler) reconcileOutputPVC(ctx context.Context, actor *hubv1.A
 		},
 	}
 
-	_, err = a.SyncPVC(ctx, pvc, room)
+	if !keepsOutputs(room) {
+		_, err = a.SyncPVC(ctx, pvc, room)
+		return err
+	}
+
+	retention := outputRetention(room)
+	pvc.Annotations = map[string]string{
+		name.OutputRetentionAnnotation():    string(retention.Policy),
+		name.OutputKeepForHoursAnnotation(): strconv.Itoa(int(retention.KeepForHours)),
+	}
+	_, err = a.SyncPVC(ctx, pvc, nil)
 	return err
 }
 
 func (a *actorReconciler) actorPodManifest(actor *hubv1.Actor, room *hubv1.Room) (*corev1.Pod, error) {
+	// volumes are given to pods by their role, so an actor can not share the role of the director or the gimulator
+	if actor.Role == name.CharacterDirector() || actor.Role == name.CharacterGimulator() {
+		return nil, fmt.Errorf("role %s is reserved", actor.Role)
+	}
+
 	volumes := make([]corev1.Volume, 0)
 	volumeMounts := make([]corev1.VolumeMount, 0)
 
-	userId := int64(2000)
-	fsGroupChangePolicy := corev1.FSGroupChangeOnRootMismatch
-
 	outputVolumeSize, err := resource.ParseQuantity(room.Spec.Setting.OutputVolumeSize)
 	if err != nil {
 		return nil, err
 	}
 	if !outputVolumeSize.IsZero() {
-		volumes = append(volumes, corev1.Volume{
-			Name: name.OutputVolumeName(actor.Name),
-			VolumeSource: corev1.VolumeSource{
-				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-					ClaimName: name.OutputPVCName(actor.Name),
-				},
-			},
-		})
+		volumes = append(volumes, outputVolume(room, actor.Name, outputVolumeSize))
 
 		volumeMounts = append(volumeMounts, corev1.VolumeMount{
 			Name:      name.OutputVolumeName(actor.Name),
-			MountPath: name.OutputVolumeMountPath(),
+			MountPath: outputMountPath(room),
 		})
 	}
 
-	if room.Spec.Setting.DataPVCNames != nil {
-		if room.Spec.Setting.DataPVCNames.Public != nil {
-			for _, pvcName := range room.Spec.Setting.DataPVCNames.Public {
-				volumes = append(volumes, corev1.Volume{
-					Name: name.DataVolumeName(pvcName),
-					VolumeSource: corev1.VolumeSource{
-						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: pvcName,
-							ReadOnly:  true,
-						},
-					},
-				})
-				volumeMounts = append(volumeMounts, corev1.VolumeMount{
-					Name:      name.DataVolumeName(pvcName),
-					MountPath: name.DataVolumeMountPath(pvcName),
-					ReadOnly:  true,
-				})
-			}
-		}
-	}
-
 	labels := map[string]string{
 		name.CharacterLabel(): name.CharacterActor(),
 		name.RoleLabel():      actor.Role,
@@ -153,7 +174,7 @@ func (a *actorReconciler) actorPodManifest(actor *hubv1.Actor, room *hubv1.Room)
 	}
 	envs = append(envs, corev1.EnvVar{
 		Name:  "GIMULATOR_HOST",
-		Value: name.GimulatorHost(room.Spec.ID),
+		Value: name.GimulatorHost(room.Spec.ID, a.config.Hub().Gimulator.Port),
 	})
 	envs = append(envs, corev1.EnvVar{
 		Name:  "GIMULATOR_CHARACTER",
@@ -187,42 +208,72 @@ func (a *actorReconciler) actorPodManifest(actor *hubv1.Actor, room *hubv1.Room)
 		resources = *actor.Resources
 	}
 
-	return &corev1.Pod{
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name.ActorPodName(actor.Name),
-			Namespace: room.Namespace,
+			Name:      naming.ActorPodName(room, actor.Name),
+			Namespace: room.WorkloadNamespace(),
 			Labels:    labels,
 		},
 		Spec: corev1.PodSpec{
-			Volumes:       volumes,
-			RestartPolicy: corev1.RestartPolicyNever,
-			ImagePullSecrets: []corev1.LocalObjectReference{
-				{
-					Name: "registry-credentials",
-				},
-			},
+			Volumes:          volumes,
+			RestartPolicy:    corev1.RestartPolicyNever,
+			ImagePullSecrets: pullSecrets(room, a.config),
 			Containers: []corev1.Container{
 				{
 					Name:            name.ActorContainerName(),
 					Image:           actor.Image,
 					ImagePullPolicy: corev1.PullIfNotPresent,
+					Command:         actor.Command,
+					Args:            actor.Args,
+					WorkingDir:      actor.WorkingDir,
 					VolumeMounts:    volumeMounts,
 					Env:             envs,
 					Resources:       resources,
 				},
 			},
-			SecurityContext: &corev1.PodSecurityContext{
-				RunAsUser:           &userId,
-				RunAsGroup:          &userId,
-				FSGroup:             &userId,
-				FSGroupChangePolicy: &fsGroupChangePolicy,
-			},
 		},
-	}, nil
+	}
+
+	mountVolumes(room, pod)
+
+	if err := mountFiles(pod, actor.Files, allowedFileSources(room, a.config)); err != nil {
+		return nil, fmt.Errorf("could not mount files of actor %s: %w", actor.Name, err)
+	}
+
+	if err := mountSource(room, actor, pod); err != nil {
+		return nil, fmt.Errorf("could not mount source code of actor %s: %w", actor.Name, err)
+	}
+
+	initContainers, sidecars := actor.InitContainers, actor.Sidecars
+	if roleSettings, ok := room.Spec.Setting.Roles[actor.Role]; ok && roleSettings != nil {
+		initContainers = mergeContainers(roleSettings.InitContainers, actor.InitContainers)
+		sidecars = mergeContainers(roleSettings.Sidecars, actor.Sidecars)
+	}
+	if err := addContainers(pod, initContainers, sidecars); err != nil {
+		return nil, fmt.Errorf("could not add containers of actor %s: %w", actor.Name, err)
+	}
+
+	if room.Spec.Setting.Benchmark != nil {
+		if err := guaranteePod(pod); err != nil {
+			return nil, fmt.Errorf("could not run actor %s in benchmark mode: %w", actor.Name, err)
+		}
+	}
+
+	applySandbox(room, pod, a.config.Runtime().SandboxUserID)
+	applyPlacement(room, pod)
+	preferWarmNodes(room, pod)
+
+	return pod, nil
 }
 
 func (a *actorReconciler) updateActorStatus(room *hubv1.Room, actor *hubv1.Actor, pod *corev1.Pod) {
-	phase := pod.Status.DeepCopy().Phase
+	phase, reason := podPhase(room, pod)
 
 	room.Status.ActorStatuses[actor.Name] = phase
+	if reason != "" {
+		if room.Status.ActorReasons == nil {
+			room.Status.ActorReasons = make(map[string]string)
+		}
+		room.Status.ActorReasons[actor.Name] = reason
+	}
 }
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	goerrors "errors"
+	"net"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+)
+
+// newRateLimiter returns the rate limiter of the work queue of rooms. The delay of a failing room starts
+// long enough to not hammer a slow service, and the bucket bounds the retries of all rooms together,
+// so an outage failing thousands of rooms at once does not flood the API server.
+func newRateLimiter(config v1alpha1.RateLimiterConfig) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(config.BaseDelay.Duration, config.MaxDelay.Duration),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(config.QPS), int(config.Burst))},
+	)
+}
+
+// withStepTimeout returns the context of a step of a reconcile calling a service outside the cluster.
+// A step gets at most half of the time left to the reconcile, so a slow step leaves time for the steps after it.
+func withStepTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if half := time.Until(deadline) / 2; half < timeout {
+			timeout = half
+		}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// isTransient returns true for errors which are likely to go away by retrying later,
+// such as timeouts, conflicts and unavailable services
+func isTransient(err error) bool {
+	if goerrors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if goerrors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	if errors.IsConflict(err) || errors.IsServerTimeout(err) || errors.IsTimeout(err) ||
+		errors.IsTooManyRequests(err) || errors.IsServiceUnavailable(err) {
+		return true
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
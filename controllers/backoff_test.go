@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+)
+
+func TestIsTransient(t *testing.T) {
+	room := schema.GroupResource{Group: "hub.roboepics.com", Resource: "rooms"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "deadline", err: context.DeadlineExceeded, want: true},
+		{name: "wrapped deadline", err: fmt.Errorf("could not fetch setting: %w", context.DeadlineExceeded), want: true},
+		{name: "network timeout", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: true},
+		{name: "conflict", err: errors.NewConflict(room, "room-1", fmt.Errorf("modified")), want: true},
+		{name: "server timeout", err: errors.NewServerTimeout(room, "update", 1), want: true},
+		{name: "too many requests", err: errors.NewTooManyRequests("slow down", 1), want: true},
+		{name: "service unavailable", err: errors.NewServiceUnavailable("down"), want: true},
+		{name: "grpc unavailable", err: status.Error(codes.Unavailable, "connection refused"), want: true},
+		{name: "grpc resource exhausted", err: status.Error(codes.ResourceExhausted, "quota"), want: true},
+		{name: "not found", err: errors.NewNotFound(room, "room-1"), want: false},
+		{name: "invalid", err: errors.NewInvalid(schema.GroupKind{Kind: "Room"}, "room-1", nil), want: false},
+		{name: "forbidden", err: errors.NewForbidden(room, "room-1", fmt.Errorf("denied")), want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "grpc permission denied", err: status.Error(codes.PermissionDenied, "token"), want: false},
+		{name: "plain", err: fmt.Errorf("unknown template"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(v1alpha1.RateLimiterConfig{
+		BaseDelay: metav1.Duration{Duration: time.Second},
+		MaxDelay:  metav1.Duration{Duration: 4 * time.Second},
+		QPS:       1000,
+		Burst:     1000,
+	})
+
+	// each failure of a room doubles its delay up to the maximum, independently of other rooms
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if got := limiter.When("room-1"); got != want {
+			t.Errorf("failure %d of room-1 is delayed %v, want %v", i+1, got, want)
+		}
+	}
+	if got := limiter.When("room-2"); got != time.Second {
+		t.Errorf("first failure of room-2 is delayed %v, want 1s", got)
+	}
+
+	limiter.Forget("room-1")
+	if got := limiter.When("room-1"); got != time.Second {
+		t.Errorf("failure of room-1 after a success is delayed %v, want 1s", got)
+	}
+}
+
+func TestWithStepTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		reconcile time.Duration
+		step      time.Duration
+		max       time.Duration
+	}{
+		{name: "step shorter than half of the reconcile", reconcile: 20 * time.Second, step: 5 * time.Second, max: 5 * time.Second},
+		{name: "step longer than half of the reconcile", reconcile: 20 * time.Second, step: 15 * time.Second, max: 10 * time.Second},
+		{name: "no reconcile deadline", step: 5 * time.Second, max: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.reconcile > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.reconcile)
+				defer cancel()
+			}
+
+			stepCtx, cancel := withStepTimeout(ctx, tt.step)
+			defer cancel()
+
+			deadline, ok := stepCtx.Deadline()
+			if !ok {
+				t.Fatal("step has no deadline")
+			}
+			if left := time.Until(deadline); left > tt.max || left < tt.max-time.Second {
+				t.Errorf("step has %v left, want about %v", left, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// benchmarkResources returns resources with Guaranteed QoS: requests and limits are both set
+// to the larger of them, and CPU is rounded up to whole CPUs so the static CPU manager
+// policy gives the container exclusive cores
+func benchmarkResources(resources corev1.ResourceRequirements) (corev1.ResourceRequirements, error) {
+	guaranteed := corev1.ResourceList{}
+	for _, list := range []corev1.ResourceList{resources.Requests, resources.Limits} {
+		for resourceName, quantity := range list {
+			if current, ok := guaranteed[resourceName]; !ok || quantity.Cmp(current) > 0 {
+				guaranteed[resourceName] = quantity.DeepCopy()
+			}
+		}
+	}
+
+	memory, ok := guaranteed[corev1.ResourceMemory]
+	if !ok || memory.IsZero() {
+		return corev1.ResourceRequirements{}, fmt.Errorf("memory of the actor should be set")
+	}
+
+	cpu := guaranteed[corev1.ResourceCPU]
+	cores := (cpu.MilliValue() + 999) / 1000
+	if cores == 0 {
+		cores = 1
+	}
+	guaranteed[corev1.ResourceCPU] = *resource.NewQuantity(cores, resource.DecimalSI)
+
+	return corev1.ResourceRequirements{
+		Requests: guaranteed.DeepCopy(),
+		Limits:   guaranteed.DeepCopy(),
+	}, nil
+}
+
+// guaranteePod gives every container of the pod benchmark resources, since
+// a pod only has Guaranteed QoS if all of its containers have
+func guaranteePod(pod *corev1.Pod) error {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			resources, err := benchmarkResources(containers[i].Resources)
+			if err != nil {
+				return fmt.Errorf("container %s: %w", containers[i].Name, err)
+			}
+			containers[i].Resources = resources
+		}
+	}
+	return nil
+}
+
+// recordActorPlacement records the node, CPU model and resources of a scheduled actor, once
+func (a *actorReconciler) recordActorPlacement(ctx context.Context, room *hubv1.Room, actor *hubv1.Actor, pod *corev1.Pod) error {
+	if pod.Spec.NodeName == "" {
+		return nil
+	}
+	if _, ok := room.Status.ActorPlacements[actor.Name]; ok {
+		return nil
+	}
+
+	node, err := a.GetNode(ctx, pod.Spec.NodeName)
+	if err != nil {
+		return err
+	}
+
+	cpuModelLabel := name.CPUModelLabel()
+	if label := room.Spec.Setting.Benchmark.CPUModelLabel; label != "" {
+		cpuModelLabel = label
+	}
+
+	placement := &hubv1.ActorPlacement{
+		Node:     node.Name,
+		CPUModel: node.Labels[cpuModelLabel],
+		QOSClass: pod.Status.QOSClass,
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == name.ActorContainerName() {
+			placement.Resources = *container.Resources.DeepCopy()
+		}
+	}
+
+	if room.Status.ActorPlacements == nil {
+		room.Status.ActorPlacements = make(map[string]*hubv1.ActorPlacement)
+	}
+	room.Status.ActorPlacements[actor.Name] = placement
+	return nil
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+)
+
+func TestBenchmarkResources(t *testing.T) {
+	list := func(cpu, memory string) corev1.ResourceList {
+		l := corev1.ResourceList{}
+		if cpu != "" {
+			l[corev1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if memory != "" {
+			l[corev1.ResourceMemory] = resource.MustParse(memory)
+		}
+		return l
+	}
+
+	tests := []struct {
+		name      string
+		resources corev1.ResourceRequirements
+		cpu       string
+		memory    string
+		wantErr   bool
+	}{
+		{name: "fraction of a CPU is rounded up", resources: corev1.ResourceRequirements{Requests: list("1500m", "1Gi")}, cpu: "2", memory: "1Gi"},
+		{name: "whole CPUs are kept", resources: corev1.ResourceRequirements{Requests: list("2", "1Gi")}, cpu: "2", memory: "1Gi"},
+		{name: "no CPU gets one", resources: corev1.ResourceRequirements{Requests: list("", "1Gi")}, cpu: "1", memory: "1Gi"},
+		{name: "larger limits win", resources: corev1.ResourceRequirements{Requests: list("500m", "1Gi"), Limits: list("3", "2Gi")}, cpu: "3", memory: "2Gi"},
+		{name: "larger requests win", resources: corev1.ResourceRequirements{Requests: list("2500m", "4Gi"), Limits: list("1", "2Gi")}, cpu: "3", memory: "4Gi"},
+		{name: "missing memory", resources: corev1.ResourceRequirements{Requests: list("1", "")}, wantErr: true},
+		{name: "zero memory", resources: corev1.ResourceRequirements{Limits: list("1", "0")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := benchmarkResources(tt.resources)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("benchmarkResources() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, l := range []corev1.ResourceList{got.Requests, got.Limits} {
+				if cpu := l[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse(tt.cpu)) != 0 {
+					t.Errorf("cpu = %v, want %s", cpu.String(), tt.cpu)
+				}
+				if memory := l[corev1.ResourceMemory]; memory.Cmp(resource.MustParse(tt.memory)) != 0 {
+					t.Errorf("memory = %v, want %s", memory.String(), tt.memory)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileActorBenchmarkReason(t *testing.T) {
+	a, err := newActorReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{
+		ID:     "room-1",
+		Actors: []*hubv1.Actor{{Name: "alice", Role: "player", Image: "alice:v1"}},
+		Setting: &hubv1.Setting{
+			OutputVolumeSize: "0",
+			DefaultResources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}},
+			Benchmark:        &hubv1.BenchmarkSettings{},
+		},
+	}}
+
+	reason, err := a.reconcileActor(context.Background(), room, room.Spec.Actors[0])
+	if err != nil {
+		t.Fatalf("reconcileActor() returned error %v, want a reason", err)
+	}
+	if !strings.Contains(reason, "memory of the actor should be set") {
+		t.Errorf("reason = %q, want it to ask for the memory of the actor", reason)
+	}
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// mergeContainers returns containers of the role with containers of the actor or the director
+// replacing those of the same name and the rest appended
+func mergeContainers(base, overrides []corev1.Container) []corev1.Container {
+	merged := make([]corev1.Container, 0, len(base)+len(overrides))
+	replaced := make(map[string]bool)
+
+	for _, container := range base {
+		for _, override := range overrides {
+			if override.Name == container.Name {
+				container = override
+				replaced[override.Name] = true
+				break
+			}
+		}
+		merged = append(merged, *container.DeepCopy())
+	}
+	for _, override := range overrides {
+		if !replaced[override.Name] {
+			merged = append(merged, *override.DeepCopy())
+		}
+	}
+	return merged
+}
+
+// addContainers adds init containers and sidecars to a pod whose first container is its main container.
+// They get the volume mounts which they do not already have, and the environment variables of the main container
+// which they list without a value, so credentials like the Gimulator token only reach containers asking for them.
+func addContainers(pod *corev1.Pod, initContainers, sidecars []corev1.Container) error {
+	main := pod.Spec.Containers[0]
+	mainEnv := make(map[string]corev1.EnvVar)
+	for _, env := range main.Env {
+		mainEnv[env.Name] = env
+	}
+
+	names := make(map[string]bool)
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		names[container.Name] = true
+	}
+	share := func(container corev1.Container) (corev1.Container, error) {
+		if container.Name == "" || names[container.Name] {
+			return container, fmt.Errorf("container name %q is empty or used more than once", container.Name)
+		}
+		names[container.Name] = true
+
+		mounted := make(map[string]bool)
+		for _, mount := range container.VolumeMounts {
+			mounted[mount.Name] = true
+			mounted[mount.MountPath] = true
+		}
+		for _, mount := range main.VolumeMounts {
+			if !mounted[mount.Name] && !mounted[mount.MountPath] {
+				container.VolumeMounts = append(container.VolumeMounts, mount)
+			}
+		}
+
+		env := make([]corev1.EnvVar, 0, len(container.Env))
+		for _, v := range container.Env {
+			if inherited, ok := mainEnv[v.Name]; ok && v.Value == "" && v.ValueFrom == nil {
+				v = inherited
+			}
+			env = append(env, v)
+		}
+		container.Env = env
+
+		if container.ImagePullPolicy == "" {
+			container.ImagePullPolicy = pullPolicy(container.Image, corev1.PullIfNotPresent)
+		}
+		return container, nil
+	}
+
+	for _, container := range initContainers {
+		shared, err := share(container)
+		if err != nil {
+			return err
+		}
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, shared)
+	}
+	for _, container := range sidecars {
+		shared, err := share(container)
+		if err != nil {
+			return err
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, shared)
+	}
+	return nil
+}
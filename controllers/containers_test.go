@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+)
+
+func TestAddContainersEnv(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "actor",
+					Env: []corev1.EnvVar{
+						{Name: "GIMULATOR_HOST", Value: "gimulator:23579"},
+						{Name: "GIMULATOR_TOKEN", Value: "secret"},
+					},
+					VolumeMounts: []corev1.VolumeMount{{Name: "output", MountPath: "/output"}},
+				},
+			},
+		},
+	}
+	sidecars := []corev1.Container{
+		{
+			Name: "meter",
+			Env: []corev1.EnvVar{
+				{Name: "GIMULATOR_HOST"},
+				{Name: "MODE", Value: "fast"},
+				{Name: "MISSING"},
+			},
+		},
+	}
+	initContainers := []corev1.Container{{Name: "weights"}}
+
+	if err := addContainers(pod, initContainers, sidecars); err != nil {
+		t.Fatal(err)
+	}
+
+	if env := pod.Spec.InitContainers[0].Env; len(env) != 0 {
+		t.Errorf("init container env = %v, containers should get no variables they do not list", env)
+	}
+	if mounts := pod.Spec.InitContainers[0].VolumeMounts; len(mounts) != 1 || mounts[0].Name != "output" {
+		t.Errorf("init container mounts = %v, want the mounts of the main container", mounts)
+	}
+
+	env := make(map[string]string)
+	for _, v := range pod.Spec.Containers[1].Env {
+		env[v.Name] = v.Value
+	}
+	want := map[string]string{"GIMULATOR_HOST": "gimulator:23579", "MODE": "fast", "MISSING": ""}
+	if len(env) != len(want) {
+		t.Errorf("sidecar env = %v, want %v", env, want)
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("sidecar %s = %q, want %q", k, env[k], v)
+		}
+	}
+	if _, ok := env["GIMULATOR_TOKEN"]; ok {
+		t.Error("sidecar should not get the token it does not ask for")
+	}
+
+	if err := addContainers(pod, []corev1.Container{{Name: "actor"}}, nil); err == nil {
+		t.Error("addContainers() should reject a container named like the main container")
+	}
+}
+
+func TestReconcileDirectorContainersReason(t *testing.T) {
+	d, err := newDirectorReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for title, sidecars := range map[string][]corev1.Container{
+		"duplicate names": {{Name: "meter"}, {Name: "meter"}},
+		"empty name":      {{Image: "meter:v1"}},
+	} {
+		t.Run(title, func(t *testing.T) {
+			room := &hubv1.Room{Spec: hubv1.RoomSpec{
+				ID:       "room-1",
+				Director: &hubv1.Director{Name: "director", Image: "director:v1", Sidecars: sidecars},
+				Setting:  &hubv1.Setting{OutputVolumeSize: "0"},
+			}}
+
+			reason, err := d.reconcileDirector(context.Background(), room)
+			if err != nil {
+				t.Fatalf("reconcileDirector() returned error %v, want a reason", err)
+			}
+			if !strings.Contains(reason, "empty or used more than once") {
+				t.Errorf("reason = %q, want it to name the bad container", reason)
+			}
+		})
+	}
+}
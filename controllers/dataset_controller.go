@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/s3"
+	"github.com/Gimulator/hub/pkg/tracing"
+)
+
+var (
+	// DatasetPollInterval is how often a room waiting for its datasets is reconciled
+	DatasetPollInterval = time.Second * 10
+
+	// DatasetRetention is how long the PVC of a dataset is kept after the last room using it.
+	// A dataset which is not used for this long belongs to a retired problem, or to an older
+	// definition of the dataset.
+	DatasetRetention = time.Hour * 24 * 7
+
+	// datasetTouchInterval limits how often the last use of a dataset is recorded
+	datasetTouchInterval = time.Hour
+)
+
+// datasetReconciler materialises datasets of a Room into PVCs shared by rooms of the problem
+type datasetReconciler struct {
+	*client.Client
+	Log    logr.Logger
+	config *hubconfig.Config
+}
+
+// newDatasetReconciler returns new instance of datasetReconciler
+func newDatasetReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*datasetReconciler, error) {
+	return &datasetReconciler{
+		config: config,
+		Log:    log,
+		Client: client,
+	}, nil
+}
+
+// reconcileDatasets creates PVCs of datasets mounted by the room and populates them from the
+// object storage. It returns true once every PVC is populated, and a reason if the room should
+// be rejected because a dataset is unknown or could not be populated.
+func (d *datasetReconciler) reconcileDatasets(ctx context.Context, room *hubv1.Room) (_ bool, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "datasetReconciler.reconcileDatasets", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	ready := true
+
+	used := make(map[string]bool)
+	for _, volume := range room.Spec.Setting.Volumes {
+		if volume.Dataset == "" || used[volume.Dataset] {
+			continue
+		}
+		used[volume.Dataset] = true
+
+		dataset := findDataset(room, volume.Dataset)
+		if dataset == nil {
+			return false, fmt.Sprintf("Volume uses unknown dataset %q.", volume.Dataset), nil
+		}
+
+		logger := logging.Logger(ctx, d.Log).WithValues("reconciler", "Dataset", "dataset", dataset.Name)
+
+		logger.Info("starting to sync dataset PVC")
+		manifest, err := d.datasetPVCManifest(room, dataset)
+		if err != nil {
+			return false, fmt.Sprintf("Dataset %s is invalid: %v", dataset.Name, err), nil
+		}
+		pvc, err := d.SyncPVC(ctx, manifest, nil)
+		if err != nil {
+			return false, "", err
+		}
+
+		logger.Info("starting to record last use of dataset")
+		if err := d.touchDataset(ctx, pvc); err != nil {
+			return false, "", err
+		}
+
+		if pvc.Annotations[name.DatasetPopulatedAnnotation()] == "true" {
+			continue
+		}
+		ready = false
+
+		logger.Info("starting to populate dataset")
+		if reason, err := d.populate(ctx, dataset, pvc); err != nil {
+			return false, "", err
+		} else if reason != "" {
+			return false, reason, nil
+		}
+	}
+
+	return ready, "", nil
+}
+
+// populate runs the pod copying the dataset into its PVC and marks the PVC populated once it succeeds.
+// The pod of a failed copy is deleted, so the next room using the dataset tries again.
+func (d *datasetReconciler) populate(ctx context.Context, dataset *hubv1.Dataset, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	manifest := d.populatorPodManifest(dataset, pvc)
+	bucket, prefix := datasetBucket(d.config.BucketPrefix(pvc.Namespace), dataset), strings.TrimPrefix(dataset.Prefix, "/")
+	if err := syncS3Secret(ctx, d.Client, manifest, pvc, func(ctx context.Context) (*s3.ScopedCredentials, error) {
+		return s3.ReadCredentials(ctx, bucket, prefix, d.config.Runtime().ObjectStoreCredentialsDuration.Duration)
+	}); err != nil {
+		return "", err
+	}
+
+	pod, err := d.SyncPod(ctx, manifest, pvc)
+	if err != nil {
+		return "", err
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		if pvc.Annotations == nil {
+			pvc.Annotations = make(map[string]string)
+		}
+		pvc.Annotations[name.DatasetPopulatedAnnotation()] = "true"
+		if err := d.Update(ctx, pvc); err != nil {
+			return "", err
+		}
+		if err := d.DeletePod(ctx, pod); err != nil {
+			return "", err
+		}
+		return "", deleteS3Secret(ctx, d.Client, pod)
+	case corev1.PodFailed:
+		if err := d.DeletePod(ctx, pod); err != nil {
+			return "", err
+		}
+		if err := deleteS3Secret(ctx, d.Client, pod); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Dataset %s could not be populated.\n%s", dataset.Name, copyFailure(pod)), nil
+	default:
+		return "", nil
+	}
+}
+
+// touchDataset records the time a room used the dataset, which keeps it from being garbage collected
+func (d *datasetReconciler) touchDataset(ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+	if lastUsed, err := time.Parse(time.RFC3339, pvc.Annotations[name.DatasetLastUsedAnnotation()]); err == nil && time.Since(lastUsed) < datasetTouchInterval {
+		return nil
+	}
+
+	if pvc.Annotations == nil {
+		pvc.Annotations = make(map[string]string)
+	}
+	pvc.Annotations[name.DatasetLastUsedAnnotation()] = time.Now().UTC().Format(time.RFC3339)
+	return d.Update(ctx, pvc)
+}
+
+// datasetPVCManifest returns the PVC of a dataset, which lives in the namespace of rooms
+func (d *datasetReconciler) datasetPVCManifest(room *hubv1.Room, dataset *hubv1.Dataset) (*corev1.PersistentVolumeClaim, error) {
+	size, err := resource.ParseQuantity(dataset.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	storageClass := dataset.StorageClass
+	if storageClass == "" {
+		storageClass = room.Spec.Setting.StorageClass
+	}
+
+	accessModes := dataset.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      datasetPVCName(room, dataset),
+			Namespace: room.Namespace,
+			Labels: map[string]string{
+				name.ProblemLabel(): room.Spec.ProblemID,
+				name.DatasetLabel(): dataset.Name,
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		},
+	}
+	if storageClass != "" {
+		pvc.Spec.StorageClassName = &storageClass
+	}
+	return pvc, nil
+}
+
+// populatorPodManifest returns the pod mirroring the prefix of a dataset into its PVC
+func (d *datasetReconciler) populatorPodManifest(dataset *hubv1.Dataset, pvc *corev1.PersistentVolumeClaim) *corev1.Pod {
+	script := `set -e
+mc mirror --overwrite --remove "source/$DATASET_BUCKET/$DATASET_PREFIX" "$DATASET_DIR"`
+
+	podName := name.PopulatorPodName(pvc.Name)
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: pvc.Namespace,
+			Labels: map[string]string{
+				name.ProblemLabel(): pvc.Labels[name.ProblemLabel()],
+				name.DatasetLabel(): dataset.Name,
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Volumes: []corev1.Volume{
+				{
+					Name: name.DatasetVolumeName(),
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvc.Name,
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:            name.PopulatorContainerName(),
+					Image:           d.config.Runtime().Images.ObjectStoreClient,
+					ImagePullPolicy: corev1.PullIfNotPresent,
+					Command:         []string{"sh", "-c", script},
+					Env: append([]corev1.EnvVar{
+						{Name: "DATASET_DIR", Value: name.DatasetMountPath()},
+						{Name: "DATASET_BUCKET", Value: datasetBucket(d.config.BucketPrefix(pvc.Namespace), dataset)},
+						{Name: "DATASET_PREFIX", Value: strings.TrimPrefix(dataset.Prefix, "/")},
+					}, s3Envs(podName, "source")...),
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      name.DatasetVolumeName(),
+							MountPath: name.DatasetMountPath(),
+						},
+					},
+					TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+				},
+			},
+		},
+	}
+}
+
+// findDataset returns the dataset of the setting with the given name
+func findDataset(room *hubv1.Room, datasetName string) *hubv1.Dataset {
+	for i := range room.Spec.Setting.Datasets {
+		if room.Spec.Setting.Datasets[i].Name == datasetName {
+			return &room.Spec.Setting.Datasets[i]
+		}
+	}
+	return nil
+}
+
+// datasetBucket returns the bucket a dataset is copied from, given the bucket prefix of the tenant of the room
+func datasetBucket(prefix string, dataset *hubv1.Dataset) string {
+	if dataset.Bucket != "" {
+		return dataset.Bucket
+	}
+	return name.S3DatasetsBucket(prefix)
+}
+
+// datasetPVCName returns the name of the PVC of a dataset. It contains a hash of the definition of
+// the dataset, so changing the definition populates a new PVC and the old one is garbage collected.
+// The bucket prefix of the tenant is left out, it is implied by the namespace of the PVC.
+func datasetPVCName(room *hubv1.Room, dataset *hubv1.Dataset) string {
+	definition := []string{datasetBucket("", dataset), dataset.Prefix, dataset.Size, dataset.StorageClass}
+	for _, mode := range dataset.AccessModes {
+		definition = append(definition, string(mode))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(definition, "\n")))
+	return name.DatasetPVCName(room.Spec.ProblemID, dataset.Name, hex.EncodeToString(sum[:]))
+}
+
+// DatasetReconciler garbage collects PVCs of datasets which no room has used for DatasetRetention
+type DatasetReconciler struct {
+	*client.Client
+	Log    logr.Logger
+	config *hubconfig.Config
+}
+
+// NewDatasetReconciler returns new instance of DatasetReconciler
+func NewDatasetReconciler(log logr.Logger, client *client.Client, config *hubconfig.Config) (*DatasetReconciler, error) {
+	return &DatasetReconciler{
+		Log:    log,
+		Client: client,
+		config: config,
+	}, nil
+}
+
+// Reconcile deletes the PVC of a dataset if no room mounts it and its last use is older than DatasetRetention
+func (d *DatasetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Runtime().ReconcileTimeout.Duration)
+	defer cancel()
+
+	ctx = logging.WithReconcileID(ctx)
+	logger := logging.Logger(ctx, d.Log).WithValues("reconciler", "Dataset", "pvc", req.NamespacedName)
+	logger.Info("starting to reconcile dataset")
+
+	pvc, err := d.GetPVC(ctx, req.NamespacedName)
+	if errors.IsNotFound(err) {
+		logger.Info("dataset does not exist")
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		logger.Error(err, "could not get dataset PVC")
+		return ctrl.Result{}, err
+	}
+
+	if watched, err := watchesNamespace(ctx, d.Client, d.config.Hub(), pvc.Namespace); err != nil {
+		logger.Error(err, "could not check namespace of dataset")
+		return ctrl.Result{}, err
+	} else if !watched {
+		logger.Info("dataset is not in a watched namespace")
+		return ctrl.Result{}, nil
+	}
+
+	rooms := &hubv1.RoomList{}
+	if err := d.List(ctx, rooms); err != nil {
+		logger.Error(err, "could not list rooms")
+		return ctrl.Result{}, err
+	}
+	for i := range rooms.Items {
+		for _, pvcName := range roomPVCNames(&rooms.Items[i]) {
+			if pvcName == pvc.Name && rooms.Items[i].Namespace == pvc.Namespace {
+				logger.Info("dataset is used by a room", "room", rooms.Items[i].Name)
+				return ctrl.Result{RequeueAfter: DatasetRetention}, nil
+			}
+		}
+	}
+
+	lastUsed, err := time.Parse(time.RFC3339, pvc.Annotations[name.DatasetLastUsedAnnotation()])
+	if err != nil {
+		lastUsed = pvc.CreationTimestamp.Time
+	}
+	if unused := time.Since(lastUsed); unused < DatasetRetention {
+		return ctrl.Result{RequeueAfter: DatasetRetention - unused}, nil
+	}
+
+	logger.Info("starting to delete unused dataset")
+	if err := d.DeletePVC(ctx, pvc); err != nil {
+		logger.Error(err, "could not delete dataset PVC")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+func (d *DatasetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	isDataset := predicate.NewPredicateFuncs(func(obj ctrlclient.Object) bool {
+		_, ok := obj.GetLabels()[name.DatasetLabel()]
+		return ok
+	})
+
+	// rooms finishing may leave datasets unused
+	toDatasets := handler.EnqueueRequestsFromMapFunc(d.datasetsOfRoom)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("dataset").
+		For(&corev1.PersistentVolumeClaim{}, builder.WithPredicates(isDataset)).
+		Watches(&source.Kind{Type: &hubv1.Room{}}, toDatasets).
+		Complete(d)
+}
+
+// datasetsOfRoom maps a room to the dataset PVCs it mounts
+func (d *DatasetReconciler) datasetsOfRoom(obj ctrlclient.Object) []reconcile.Request {
+	room, ok := obj.(*hubv1.Room)
+	if !ok || room.Spec.Setting == nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0)
+	for _, volume := range roomVolumes(room) {
+		if volume.Dataset != "" {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: volume.PVCName, Namespace: room.Namespace},
+			})
+		}
+	}
+	return requests
+}
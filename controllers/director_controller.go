@@ -2,34 +2,46 @@ package controllers
 
 import (
 	"context"
-	"strings"
+	"fmt"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	hubv1 "github.com/Gimulator/hub/api/v1"
 	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
 	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/naming"
+	"github.com/Gimulator/hub/pkg/tracing"
 )
 
 // directorReconciler reconciles an director of a Room object
 type directorReconciler struct {
 	*client.Client
-	Log logr.Logger
+	Log    logr.Logger
+	config *hubconfig.Config
 }
 
 // newDirectorReconciler returns new instance of DirectorReconciler
-func newDirectorReconciler(client *client.Client, log logr.Logger) (*directorReconciler, error) {
+func newDirectorReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*directorReconciler, error) {
 	return &directorReconciler{
+		config: config,
 		Log:    log,
 		Client: client,
 	}, nil
 }
 
-func (a *directorReconciler) reconcileDirector(ctx context.Context, room *hubv1.Room) error {
-	logger := a.Log.WithValues("reconciler", "Director", "director", room.Spec.Director.Name, "room", room.Spec.ID)
+// reconcileDirector syncs the files and pod of the director. It returns a reason if the room
+// should be rejected because the pod of the director can not be created from its setting.
+func (a *directorReconciler) reconcileDirector(ctx context.Context, room *hubv1.Room) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "directorReconciler.reconcileDirector", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	logger := logging.Logger(ctx, a.Log).WithValues("reconciler", "Director", "director", room.Spec.Director.Name)
 
 	// logger.Info("starting to reconcile director's output PVC")
 	// if err := a.reconcileOutputPVC(ctx, room); err != nil {
@@ -37,11 +49,19 @@ func (a *directorReconciler) reconcileDirector(ctx context.Context, room *hubv1.
 	// 	return err
 	// }
 
+	logger.Info("starting to reconcile director's files")
+	if cm := filesConfigMap(room, naming.DirectorPodName(room), room.Spec.Director.Files); cm != nil {
+		if _, err := a.SyncConfigMap(ctx, cm, room); err != nil {
+			logger.Error(err, "could not reconcile director's files")
+			return "", err
+		}
+	}
+
 	logger.Info("starting to create director's manifest")
 	dirPod, err := a.directorPodManifest(room)
 	if err != nil {
-		logger.Error(err, "could not create director's manifest")
-		return err
+		logger.Info("could not create director's manifest", "error", err.Error())
+		return fmt.Sprintf("Pod of the director could not be created.\n%s", err), nil
 	}
 
 	if room.Status.GimulatorStatus != corev1.PodRunning {
@@ -51,14 +71,14 @@ func (a *directorReconciler) reconcileDirector(ctx context.Context, room *hubv1.
 		syncedDirPod, err := a.SyncPod(ctx, dirPod, room)
 		if err != nil {
 			logger.Error(err, "could not sync director's pod")
-			return err
+			return "", err
 		}
 
 		logger.Info("starting to update status of director")
 		a.updateDirectorStatus(room, syncedDirPod)
 	}
 
-	return nil
+	return "", nil
 }
 
 // func (a *directorReconciler) reconcileOutputPVC(ctx context.Context, room *hubv1.Room) error {
@@ -69,7 +89,7 @@ func (a *directorReconciler) reconcileDirector(ctx context.Context, room *hubv1.
 
 // 	pvc := &corev1.PersistentVolumeClaim{
 // 		ObjectMeta: metav1.ObjectMeta{
-// 			Name:      name.OutputPVCName(room.Spec.Director.ID),
+// 			Name:      naming.OutputPVCName(room.Spec.Director.ID),
 // 			Namespace: room.Namespace,
 // 		},
 // 		Spec: corev1.PersistentVolumeClaimSpec{
@@ -92,14 +112,11 @@ func (a *directorReconciler) directorPodManifest(room *hubv1.Room) (*corev1.Pod,
 	volumes := make([]corev1.Volume, 0)
 	volumeMounts := make([]corev1.VolumeMount, 0)
 
-	userId := int64(2000)
-	fsGroupChangePolicy := corev1.FSGroupChangeOnRootMismatch
-
 	// volumes = append(volumes, corev1.Volume{
 	// 	Name: name.OutputVolumeName(room.Spec.Director.ID),
 	// 	VolumeSource: corev1.VolumeSource{
 	// 		PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-	// 			ClaimName: name.OutputPVCName(room.Spec.Director.ID),
+	// 			ClaimName: naming.OutputPVCName(room.Spec.Director.ID),
 	// 		},
 	// 	},
 	// })
@@ -109,53 +126,6 @@ func (a *directorReconciler) directorPodManifest(room *hubv1.Room) (*corev1.Pod,
 	// 	MountPath: name.OutputVolumeMountPath(),
 	// })
 
-	if room.Spec.Setting.DataPVCNames != nil {
-		// Mounting Private PVCs
-		if room.Spec.Setting.DataPVCNames.Private != nil {
-			for _, pvcName := range room.Spec.Setting.DataPVCNames.Private {
-				fullName := strings.Join([]string{"private", pvcName}, "-")
-
-				volumes = append(volumes, corev1.Volume{
-					Name: name.DataVolumeName(fullName),
-					VolumeSource: corev1.VolumeSource{
-						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: pvcName,
-							ReadOnly:  true,
-						},
-					},
-				})
-				volumeMounts = append(volumeMounts, corev1.VolumeMount{
-					Name:      name.DataVolumeName(fullName),
-					MountPath: name.DataVolumeMountPath(fullName),
-					ReadOnly:  true,
-				})
-			}
-		}
-
-		// Mounting Public PVCs
-		// Comment/remove this part if you believe this functionality is unnecessary
-		if room.Spec.Setting.DataPVCNames.Public != nil {
-			for _, pvcName := range room.Spec.Setting.DataPVCNames.Public {
-				fullName := strings.Join([]string{"public", pvcName}, "-")
-
-				volumes = append(volumes, corev1.Volume{
-					Name: name.DataVolumeName(fullName),
-					VolumeSource: corev1.VolumeSource{
-						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: pvcName,
-							ReadOnly:  true,
-						},
-					},
-				})
-				volumeMounts = append(volumeMounts, corev1.VolumeMount{
-					Name:      name.DataVolumeName(fullName),
-					MountPath: name.DataVolumeMountPath(fullName),
-					ReadOnly:  true,
-				})
-			}
-		}
-	}
-
 	// if room.Spec.ProblemSettings.FactPVCName != "" {
 	// 	volumes = append(volumes, corev1.Volume{
 	// 		Name: name.FactVolumeName(),
@@ -177,20 +147,21 @@ func (a *directorReconciler) directorPodManifest(room *hubv1.Room) (*corev1.Pod,
 	if err != nil {
 		return nil, err
 	}
-	if !outputVolumeSize.IsZero() {
+	// only output PVCs are shared, other output volumes belong to actor pods
+	if !outputVolumeSize.IsZero() && outputVolumeType(room) == hubv1.OutputVolumePVC {
 		for _, actor := range room.Spec.Actors {
 			volumes = append(volumes, corev1.Volume{
 				Name: name.OutputVolumeName(actor.Name),
 				VolumeSource: corev1.VolumeSource{
 					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-						ClaimName: name.OutputPVCName(actor.Name),
+						ClaimName: naming.OutputPVCName(room, actor.Name),
 						ReadOnly:  true,
 					},
 				},
 			})
 			volumeMounts = append(volumeMounts, corev1.VolumeMount{
 				Name:      name.OutputVolumeName(actor.Name),
-				MountPath: name.ActorOutputVolumeMountPathForDirector(actor.Name),
+				MountPath: directorOutputMountPath(room, actor.Name),
 				ReadOnly:  true,
 			})
 		}
@@ -210,7 +181,7 @@ func (a *directorReconciler) directorPodManifest(room *hubv1.Room) (*corev1.Pod,
 	}
 	envs = append(envs, corev1.EnvVar{
 		Name:  "GIMULATOR_HOST",
-		Value: name.GimulatorHost(room.Spec.ID),
+		Value: name.GimulatorHost(room.Spec.ID, a.config.Hub().Gimulator.Port),
 	})
 	envs = append(envs, corev1.EnvVar{
 		Name:  "GIMULATOR_CHARACTER",
@@ -242,42 +213,59 @@ func (a *directorReconciler) directorPodManifest(room *hubv1.Room) (*corev1.Pod,
 		resources = *room.Spec.Director.Resources
 	}
 
-	return &corev1.Pod{
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name.DirectorPodName(room.Spec.Director.Name),
-			Namespace: room.Namespace,
+			Name:      naming.DirectorPodName(room),
+			Namespace: room.WorkloadNamespace(),
 			Labels:    labels,
 		},
 		Spec: corev1.PodSpec{
-			Volumes:       volumes,
-			RestartPolicy: corev1.RestartPolicyNever,
-			ImagePullSecrets: []corev1.LocalObjectReference{
-				{
-					Name: "registry-credentials",
-				},
-			},
+			Volumes:          volumes,
+			RestartPolicy:    corev1.RestartPolicyNever,
+			ImagePullSecrets: pullSecrets(room, a.config),
 			Containers: []corev1.Container{
 				{
 					Name:            name.DirectorContainerName(),
 					Image:           room.Spec.Director.Image,
-					ImagePullPolicy: corev1.PullAlways, // TODO Find a way to pull the image by requesting it on-demand. We don't always have access to the docker daemon to delete the old image.
+					ImagePullPolicy: pullPolicy(room.Spec.Director.Image, corev1.PullAlways),
+					Command:         room.Spec.Director.Command,
+					Args:            room.Spec.Director.Args,
+					WorkingDir:      room.Spec.Director.WorkingDir,
 					VolumeMounts:    volumeMounts,
 					Env:             envs,
 					Resources:       resources,
 				},
 			},
-			SecurityContext: &corev1.PodSecurityContext{
-				RunAsUser:           &userId,
-				RunAsGroup:          &userId,
-				FSGroup:             &userId,
-				FSGroupChangePolicy: &fsGroupChangePolicy,
-			},
 		},
-	}, nil
+	}
+
+	mountVolumes(room, pod)
+
+	if err := mountFiles(pod, room.Spec.Director.Files, allowedFileSources(room, a.config)); err != nil {
+		return nil, fmt.Errorf("could not mount files of director: %w", err)
+	}
+
+	initContainers, sidecars := room.Spec.Director.InitContainers, room.Spec.Director.Sidecars
+	if roleSettings, ok := room.Spec.Setting.Roles[name.CharacterDirector()]; ok && roleSettings != nil {
+		initContainers = mergeContainers(roleSettings.InitContainers, room.Spec.Director.InitContainers)
+		sidecars = mergeContainers(roleSettings.Sidecars, room.Spec.Director.Sidecars)
+	}
+	if err := addContainers(pod, initContainers, sidecars); err != nil {
+		return nil, fmt.Errorf("could not add containers of director: %w", err)
+	}
+
+	applySandbox(room, pod, a.config.Runtime().SandboxUserID)
+	applyPlacement(room, pod)
+	preferWarmNodes(room, pod)
+
+	return pod, nil
 }
 
 func (a *directorReconciler) updateDirectorStatus(room *hubv1.Room, pod *corev1.Pod) {
-	phase := pod.Status.DeepCopy().Phase
+	phase, reason := podPhase(room, pod)
 
 	room.Status.DirectorStatus = phase
+	if reason != "" {
+		room.Status.DirectorReason = reason
+	}
 }
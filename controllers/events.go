@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+// Reasons of events of rooms
+const (
+	EventSettingFetched   = "SettingFetched"
+	EventGimulatorStarted = "GimulatorStarted"
+	EventGimulatorFailed  = "GimulatorFailed"
+	EventDirectorFailed   = "DirectorFailed"
+	EventActorFailed      = "ActorFailed"
+	EventRejected         = "Rejected"
+	EventResultPublished  = "ResultPublished"
+	EventLogsUploaded     = "LogsUploaded"
+	EventRoomDeleted      = "RoomDeleted"
+)
+
+// eventRecorder records an event of a room once for each subject and message. Rooms are
+// reconciled every SyncPeriod, so the same transition would otherwise be recorded again.
+type eventRecorder struct {
+	record.EventRecorder
+
+	mutex    sync.Mutex
+	recorded map[types.NamespacedName]map[string]string // subject of an event of a room to its last message
+}
+
+// newEventRecorder returns new instance of eventRecorder
+func newEventRecorder(recorder record.EventRecorder) *eventRecorder {
+	return &eventRecorder{
+		EventRecorder: recorder,
+		recorded:      make(map[types.NamespacedName]map[string]string),
+	}
+}
+
+// event records an event of the room unless the last event of the subject had the same message.
+// The subject is the reason, and the participant for events of a single participant.
+func (e *eventRecorder) event(room *hubv1.Room, eventType, reason, subject, message string) {
+	key := types.NamespacedName{Name: room.Name, Namespace: room.Namespace}
+	subject = reason + "/" + subject
+
+	e.mutex.Lock()
+	if e.recorded[key] == nil {
+		e.recorded[key] = make(map[string]string)
+	}
+	if last, ok := e.recorded[key][subject]; ok && last == message {
+		e.mutex.Unlock()
+		return
+	}
+	e.recorded[key][subject] = message
+	e.mutex.Unlock()
+
+	e.Event(room, eventType, reason, message)
+}
+
+// forget drops the recorded events of a room which no longer exists
+func (e *eventRecorder) forget(key types.NamespacedName) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	delete(e.recorded, key)
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+func TestEventRecorderDeduplicates(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	recorder := newEventRecorder(fake)
+	room := &hubv1.Room{ObjectMeta: metav1.ObjectMeta{Name: "room-1", Namespace: "hub-system"}}
+	other := &hubv1.Room{ObjectMeta: metav1.ObjectMeta{Name: "room-2", Namespace: "hub-system"}}
+
+	recorded := func() []string {
+		events := make([]string, 0)
+		for {
+			select {
+			case event := <-fake.Events:
+				events = append(events, event)
+			default:
+				return events
+			}
+		}
+	}
+
+	recorder.event(room, corev1.EventTypeWarning, EventActorFailed, "alice", "Actor alice failed")
+	recorder.event(room, corev1.EventTypeWarning, EventActorFailed, "alice", "Actor alice failed")
+	if events := recorded(); len(events) != 1 || events[0] != "Warning ActorFailed Actor alice failed" {
+		t.Errorf("events = %v, want a repeated message recorded once", events)
+	}
+
+	recorder.event(room, corev1.EventTypeWarning, EventActorFailed, "bob", "Actor bob failed")
+	recorder.event(other, corev1.EventTypeWarning, EventActorFailed, "alice", "Actor alice failed")
+	if events := recorded(); len(events) != 2 {
+		t.Errorf("events = %v, want events of other subjects and rooms recorded", events)
+	}
+
+	recorder.event(room, corev1.EventTypeWarning, EventActorFailed, "alice", "Actor alice was evicted")
+	if events := recorded(); len(events) != 1 || events[0] != "Warning ActorFailed Actor alice was evicted" {
+		t.Errorf("events = %v, want a changed message recorded", events)
+	}
+
+	recorder.forget(types.NamespacedName{Name: "room-1", Namespace: "hub-system"})
+	recorder.event(room, corev1.EventTypeWarning, EventActorFailed, "alice", "Actor alice was evicted")
+	if events := recorded(); len(events) != 1 {
+		t.Errorf("events = %v, want the message recorded again once the room is forgotten", events)
+	}
+	recorder.event(other, corev1.EventTypeWarning, EventActorFailed, "alice", "Actor alice failed")
+	if events := recorded(); len(events) != 0 {
+		t.Errorf("events = %v, forgetting a room should keep the events of other rooms", events)
+	}
+}
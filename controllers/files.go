@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// fileSources are the Secrets and the ConfigMaps files of pods of a room may be taken from
+type fileSources struct {
+	secrets    map[string]bool
+	configMaps map[string]bool
+}
+
+// allowedFileSources returns the FileSecrets of the setting except the credentials of the hub,
+// and the FileConfigMaps of the setting except credentials and rules of rooms
+func allowedFileSources(room *hubv1.Room, config *hubconfig.Config) fileSources {
+	credentials := map[string]bool{
+		config.Hub().Rabbit.CredentialsSecret: true,
+		name.S3SecretName():                   true,
+		name.RegistrySecretName():             true,
+	}
+	for _, secretName := range pullSecretNames(room, config) {
+		credentials[secretName] = true
+	}
+	for _, template := range room.Spec.Setting.Templates {
+		if template != nil && template.PushSecret != "" {
+			credentials[template.PushSecret] = true
+		}
+	}
+
+	allowed := fileSources{
+		secrets:    make(map[string]bool),
+		configMaps: make(map[string]bool),
+	}
+	for _, secretName := range room.Spec.Setting.FileSecrets {
+		if !credentials[secretName] {
+			allowed.secrets[secretName] = true
+		}
+	}
+	for _, configMapName := range room.Spec.Setting.FileConfigMaps {
+		if !name.IsCredOrRulesConfigMapName(configMapName) && configMapName != name.ImageCacheConfigMapName() {
+			allowed.configMaps[configMapName] = true
+		}
+	}
+	return allowed
+}
+
+// filesConfigMap returns the ConfigMap holding inline contents of files of a pod,
+// or nil if none of the files has an inline content
+func filesConfigMap(room *hubv1.Room, podName string, files []hubv1.File) *corev1.ConfigMap {
+	data := make(map[string]string)
+	for i, file := range files {
+		if file.ConfigMap == nil && file.Secret == nil {
+			data[name.FileKey(i)] = file.Content
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.FilesConfigMapName(podName),
+			Namespace: room.WorkloadNamespace(),
+			Labels: map[string]string{
+				name.RoomLabel():    room.Spec.ID,
+				name.ProblemLabel(): room.Spec.ProblemID,
+			},
+		},
+		Data: data,
+	}
+}
+
+// mountFiles mounts files into the main container of the pod. Every file is projected
+// into one volume under its own key and mounted on its path by a sub path.
+func mountFiles(pod *corev1.Pod, files []hubv1.File, allowed fileSources) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	main := &pod.Spec.Containers[0]
+	mounted := make(map[string]bool)
+	for _, mount := range main.VolumeMounts {
+		mounted[mount.MountPath] = true
+	}
+
+	sources := make([]corev1.VolumeProjection, 0)
+	for i, file := range files {
+		if !path.IsAbs(file.Path) || path.Clean(file.Path) != file.Path {
+			return fmt.Errorf("path of file %q should be absolute and clean", file.Path)
+		}
+		if mounted[file.Path] {
+			return fmt.Errorf("path of file %q is already mounted", file.Path)
+		}
+		mounted[file.Path] = true
+
+		item := corev1.KeyToPath{Path: name.FileKey(i), Mode: file.Mode}
+		switch {
+		case file.ConfigMap != nil && file.Secret != nil:
+			return fmt.Errorf("file %q should not have both a ConfigMap and a Secret", file.Path)
+		case file.ConfigMap != nil:
+			if !allowed.configMaps[file.ConfigMap.Name] {
+				return fmt.Errorf("file %q can not be taken from ConfigMap %s, it is not one of the file ConfigMaps of the setting", file.Path, file.ConfigMap.Name)
+			}
+			item.Key = file.ConfigMap.Key
+			sources = append(sources, corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: file.ConfigMap.LocalObjectReference,
+					Items:                []corev1.KeyToPath{item},
+					Optional:             file.ConfigMap.Optional,
+				},
+			})
+		case file.Secret != nil:
+			if !allowed.secrets[file.Secret.Name] {
+				return fmt.Errorf("file %q can not be taken from secret %s, it is not one of the file secrets of the setting", file.Path, file.Secret.Name)
+			}
+			item.Key = file.Secret.Key
+			sources = append(sources, corev1.VolumeProjection{
+				Secret: &corev1.SecretProjection{
+					LocalObjectReference: file.Secret.LocalObjectReference,
+					Items:                []corev1.KeyToPath{item},
+					Optional:             file.Secret.Optional,
+				},
+			})
+		default:
+			item.Key = name.FileKey(i)
+			sources = append(sources, corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: name.FilesConfigMapName(pod.Name)},
+					Items:                []corev1.KeyToPath{item},
+				},
+			})
+		}
+
+		main.VolumeMounts = append(main.VolumeMounts, corev1.VolumeMount{
+			Name:      name.FilesVolumeName(),
+			MountPath: file.Path,
+			SubPath:   name.FileKey(i),
+			ReadOnly:  true,
+		})
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: name.FilesVolumeName(),
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: sources,
+			},
+		},
+	})
+	return nil
+}
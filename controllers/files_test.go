@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+func TestAllowedFileSources(t *testing.T) {
+	config := hubconfig.New(hubconfig.Default())
+	room := &hubv1.Room{
+		Spec: hubv1.RoomSpec{
+			Setting: &hubv1.Setting{
+				ImagePullSecrets: []string{"problem-registry"},
+				Templates:        map[string]*hubv1.RuntimeTemplate{"go": {PushSecret: "problem-push"}},
+				FileSecrets: []string{
+					"problem-keys",
+					"problem-registry",
+					"problem-push",
+					name.S3SecretName(),
+					name.RegistrySecretName(),
+					config.Hub().Rabbit.CredentialsSecret,
+				},
+				FileConfigMaps: []string{
+					"problem-maps",
+					name.CredConfigMapName("room-1"),
+					name.CredConfigMapName("other-room"),
+					name.RulesConfigMapName("problem"),
+					name.ImageCacheConfigMapName(),
+				},
+			},
+		},
+	}
+
+	allowed := allowedFileSources(room, config)
+	if len(allowed.secrets) != 1 || !allowed.secrets["problem-keys"] {
+		t.Errorf("secrets = %v, want only problem-keys", allowed.secrets)
+	}
+	if len(allowed.configMaps) != 1 || !allowed.configMaps["problem-maps"] {
+		t.Errorf("ConfigMaps = %v, want only problem-maps", allowed.configMaps)
+	}
+}
+
+func TestMountFiles(t *testing.T) {
+	secretFile := func(secretName string) hubv1.File {
+		return hubv1.File{
+			Path: "/etc/keys/key",
+			Secret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+				Key:                  "key",
+			},
+		}
+	}
+	configMapFile := func(configMapName string) hubv1.File {
+		return hubv1.File{
+			Path: "/etc/maps/map",
+			ConfigMap: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: configMapName},
+				Key:                  "map",
+			},
+		}
+	}
+	allowed := fileSources{
+		secrets:    map[string]bool{"problem-keys": true},
+		configMaps: map[string]bool{"problem-maps": true},
+	}
+
+	tests := []struct {
+		name  string
+		files []hubv1.File
+		err   string
+	}{
+		{name: "inline", files: []hubv1.File{{Path: "/etc/config.yaml", Content: "a: b"}}},
+		{name: "allowed secret", files: []hubv1.File{secretFile("problem-keys")}},
+		{name: "other secret", files: []hubv1.File{secretFile(name.S3SecretName())}, err: "not one of the file secrets"},
+		{name: "allowed ConfigMap", files: []hubv1.File{configMapFile("problem-maps")}},
+		{name: "credentials ConfigMap", files: []hubv1.File{configMapFile(name.CredConfigMapName("room-1"))}, err: "not one of the file ConfigMaps"},
+		{name: "relative path", files: []hubv1.File{{Path: "config.yaml"}}, err: "absolute"},
+		{name: "repeated path", files: []hubv1.File{{Path: "/a"}, {Path: "/a"}}, err: "already mounted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "actor"}}}}
+			err := mountFiles(pod, tt.files, allowed)
+			if tt.err == "" && err != nil {
+				t.Errorf("mountFiles() error = %v, want none", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("mountFiles() error = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReconcileActorFilesReason(t *testing.T) {
+	a, err := newActorReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actor := &hubv1.Actor{Name: "alice", Role: "player", Image: "alice:v1", Files: []hubv1.File{{
+		Path: "/etc/keys/key",
+		Secret: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name.S3SecretName()},
+			Key:                  "key",
+		},
+	}}}
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{
+		ID:      "room-1",
+		Actors:  []*hubv1.Actor{actor},
+		Setting: &hubv1.Setting{OutputVolumeSize: "0"},
+	}}
+
+	reason, err := a.reconcileActor(context.Background(), room, actor)
+	if err != nil {
+		t.Fatalf("reconcileActor() returned error %v, want a reason", err)
+	}
+	if !strings.Contains(reason, "not one of the file secrets") {
+		t.Errorf("reason = %q, want it to name the secret which is not allowed", reason)
+	}
+}
@@ -2,10 +2,10 @@ package controllers
 
 import (
 	"context"
-	"os"
 	"strconv"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,26 +15,34 @@ import (
 	hubv1 "github.com/Gimulator/hub/api/v1"
 	"github.com/Gimulator/hub/pkg/client"
 	"github.com/Gimulator/hub/pkg/config"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
 	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/tracing"
 	"github.com/Gimulator/protobuf/go/api"
 )
 
 // gimulatorReconciler reconciles Gimulator for a Room
 type gimulatorReconciler struct {
 	*client.Client
-	Log logr.Logger
+	Log    logr.Logger
+	config *hubconfig.Config
 }
 
 // newGimulatorReconciler returns new instance of GimulatorReconciler
-func newGimulatorReconciler(client *client.Client, log logr.Logger) (*gimulatorReconciler, error) {
+func newGimulatorReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*gimulatorReconciler, error) {
 	return &gimulatorReconciler{
+		config: config,
 		Log:    log,
 		Client: client,
 	}, nil
 }
 
-func (g *gimulatorReconciler) reconcileGimulator(ctx context.Context, room *hubv1.Room) error {
-	logger := g.Log.WithValues("reconciler", "Gimulator", "room", room.Spec.ID)
+func (g *gimulatorReconciler) reconcileGimulator(ctx context.Context, room *hubv1.Room) (err error) {
+	ctx, span := tracing.Start(ctx, "gimulatorReconciler.reconcileGimulator", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	logger := logging.Logger(ctx, g.Log).WithValues("reconciler", "Gimulator")
 
 	logger.Info("starting to reconcile rulse config map")
 	if err := g.reconcileRulesConfigMap(ctx, room); err != nil {
@@ -77,7 +85,7 @@ func (g *gimulatorReconciler) reconcileGimulator(ctx context.Context, room *hubv
 func (g *gimulatorReconciler) reconcileRulesConfigMap(ctx context.Context, room *hubv1.Room) error {
 	key := types.NamespacedName{
 		Name:      name.RulesConfigMapName(room.Spec.ProblemID),
-		Namespace: room.Namespace,
+		Namespace: room.WorkloadNamespace(),
 	}
 
 	_, err := g.GetConfigMap(ctx, key)
@@ -85,7 +93,7 @@ func (g *gimulatorReconciler) reconcileRulesConfigMap(ctx context.Context, room
 		return nil
 	}
 
-	rules, err := config.FetchRules(ctx, room)
+	rules, err := config.FetchRules(ctx, room, g.config.BucketPrefix(room.Namespace))
 	if err != nil {
 		return err
 	}
@@ -93,7 +101,7 @@ func (g *gimulatorReconciler) reconcileRulesConfigMap(ctx context.Context, room
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name.RulesConfigMapName(room.Spec.ProblemID),
-			Namespace: room.Namespace,
+			Namespace: room.WorkloadNamespace(),
 		},
 		Data: map[string]string{
 			"data": rules,
@@ -133,12 +141,11 @@ func (g *gimulatorReconciler) reconcileCredentialsConfigMap(ctx context.Context,
 		})
 	}
 
-	token := os.Getenv("HUB_GIMULATOR_TOKEN")
 	creds = append(creds, Cred{
 		Name:      "hub-manager",
 		Character: api.Character_name[int32(api.Character_operator)],
 		Role:      name.CharacterOperator(),
-		Token:     token,
+		Token:     g.config.Hub().Gimulator.Token,
 	})
 
 	bytes, err := yaml.Marshal(creds)
@@ -149,7 +156,7 @@ func (g *gimulatorReconciler) reconcileCredentialsConfigMap(ctx context.Context,
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name.CredConfigMapName(room.Spec.ID),
-			Namespace: room.Namespace,
+			Namespace: room.WorkloadNamespace(),
 		},
 		Data: map[string]string{
 			"data": string(bytes),
@@ -167,14 +174,14 @@ func (g *gimulatorReconciler) reconcileGimulatorService(ctx context.Context, roo
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name.GimulatorServiceName(room.Spec.ID),
-			Namespace: room.Namespace,
+			Namespace: room.WorkloadNamespace(),
 		},
 		Spec: corev1.ServiceSpec{
 			Ports: []corev1.ServicePort{
 				{
-					Port:       int32(name.GimulatorServicePort()),
+					Port:       g.config.Hub().Gimulator.Port,
 					Protocol:   corev1.ProtocolTCP,
-					TargetPort: intstr.FromInt(int(name.GimulatorServicePort())),
+					TargetPort: intstr.FromInt(int(g.config.Hub().Gimulator.Port)),
 				},
 			},
 			Selector: map[string]string{
@@ -192,16 +199,7 @@ func (g *gimulatorReconciler) reconcileGimulatorService(ctx context.Context, roo
 }
 
 func (g *gimulatorReconciler) gimulatorPodManifest(room *hubv1.Room) (*corev1.Pod, error) {
-	// Priorities for getting image name:
-	// 1. room.Spec.Gimulator.Image
-	// 2. room.Spec.Setting.Gimulator.Image
-
-	image := room.Spec.Setting.Gimulator.Image
-	if room.Spec.Gimulator != nil {
-		if room.Spec.Gimulator.Image != "" {
-			image = room.Spec.Gimulator.Image
-		}
-	}
+	image := gimulatorImage(room)
 
 	// Priorities for resource allocations:
 	// 1. room.Spec.Gimulator.Resources
@@ -218,10 +216,10 @@ func (g *gimulatorReconciler) gimulatorPodManifest(room *hubv1.Room) (*corev1.Po
 		}
 	}
 
-	return &corev1.Pod{
+	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name.GimulatorPodName(room.Spec.ID),
-			Namespace: room.Namespace,
+			Namespace: room.WorkloadNamespace(),
 			Labels: map[string]string{
 				name.CharacterLabel(): name.CharacterGimulator(),
 				name.RoleLabel():      name.CharacterGimulator(),
@@ -235,11 +233,11 @@ func (g *gimulatorReconciler) gimulatorPodManifest(room *hubv1.Room) (*corev1.Po
 				{
 					Name:            name.GimulatorContainerName(),
 					Image:           image,
-					ImagePullPolicy: corev1.PullIfNotPresent,
+					ImagePullPolicy: pullPolicy(image, corev1.PullIfNotPresent),
 					Env: []corev1.EnvVar{
 						{
 							Name:  "GIMULATOR_HOST",
-							Value: "0.0.0.0:" + strconv.Itoa(name.GimulatorServicePort()),
+							Value: "0.0.0.0:" + strconv.Itoa(int(g.config.Hub().Gimulator.Port)),
 						},
 						{
 							Name:  "GIMULATOR_ID",
@@ -258,7 +256,7 @@ func (g *gimulatorReconciler) gimulatorPodManifest(room *hubv1.Room) (*corev1.Po
 							ValueFrom: &corev1.EnvVarSource{
 								SecretKeyRef: &corev1.SecretKeySelector{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "rabbit-credentials",
+										Name: g.config.Hub().Rabbit.CredentialsSecret,
 									},
 									Key: "host",
 								},
@@ -269,7 +267,7 @@ func (g *gimulatorReconciler) gimulatorPodManifest(room *hubv1.Room) (*corev1.Po
 							ValueFrom: &corev1.EnvVarSource{
 								SecretKeyRef: &corev1.SecretKeySelector{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "rabbit-credentials",
+										Name: g.config.Hub().Rabbit.CredentialsSecret,
 									},
 									Key: "username",
 								},
@@ -280,23 +278,13 @@ func (g *gimulatorReconciler) gimulatorPodManifest(room *hubv1.Room) (*corev1.Po
 							ValueFrom: &corev1.EnvVarSource{
 								SecretKeyRef: &corev1.SecretKeySelector{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "rabbit-credentials",
+										Name: g.config.Hub().Rabbit.CredentialsSecret,
 									},
 									Key: "password",
 								},
 							},
 						},
-						{
-							Name: "GIMULATOR_RABBIT_RESULT_QUEUE",
-							ValueFrom: &corev1.EnvVarSource{
-								SecretKeyRef: &corev1.SecretKeySelector{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "rabbit-credentials",
-									},
-									Key: "result-queue",
-								},
-							},
-						},
+						g.resultQueueEnv(room),
 					},
 					VolumeMounts: []corev1.VolumeMount{
 						{
@@ -346,11 +334,52 @@ func (g *gimulatorReconciler) gimulatorPodManifest(room *hubv1.Room) (*corev1.Po
 				},
 			},
 		},
-	}, nil
+	}
+	mountVolumes(room, pod)
+	applyPlacement(room, pod)
+	preferWarmNodes(room, pod)
+
+	return pod, nil
+}
+
+// resultQueueEnv returns the queue the gimulator publishes the result to, which is the one of the
+// tenant of the room if it has one and the one of the rabbit secret otherwise
+func (g *gimulatorReconciler) resultQueueEnv(room *hubv1.Room) corev1.EnvVar {
+	if queue := g.config.TenantOf(room.Namespace).ResultQueue; queue != "" {
+		return corev1.EnvVar{Name: "GIMULATOR_RABBIT_RESULT_QUEUE", Value: queue}
+	}
+	return corev1.EnvVar{
+		Name: "GIMULATOR_RABBIT_RESULT_QUEUE",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: g.config.Hub().Rabbit.CredentialsSecret,
+				},
+				Key: "result-queue",
+			},
+		},
+	}
+}
+
+// gimulatorImage returns the image of the gimulator of the room.
+// Priorities for getting image name:
+// 1. room.Spec.Gimulator.Image
+// 2. room.Spec.Setting.Gimulator.Image
+func gimulatorImage(room *hubv1.Room) string {
+	if room.Spec.Gimulator != nil && room.Spec.Gimulator.Image != "" {
+		return room.Spec.Gimulator.Image
+	}
+	if room.Spec.Setting != nil && room.Spec.Setting.Gimulator != nil {
+		return room.Spec.Setting.Gimulator.Image
+	}
+	return ""
 }
 
 func (g *gimulatorReconciler) updateGimulatorStatus(room *hubv1.Room, pod *corev1.Pod) {
-	phase := pod.Status.DeepCopy().Phase
+	phase, reason := podPhase(room, pod)
 
 	room.Status.GimulatorStatus = phase
+	if reason != "" {
+		room.Status.GimulatorReason = reason
+	}
 }
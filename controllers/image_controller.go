@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/image"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/tracing"
+)
+
+// digestCacheTTL is how long rooms of a problem reuse the digests the images of its setting were pinned to
+const digestCacheTTL = time.Minute * 5
+
+// digestResolver resolves tags of images to the digests they point to, see image.Resolver
+type digestResolver interface {
+	Resolve(ctx context.Context, img string, keychain *image.Keychain) (string, error)
+}
+
+// imageReconciler checks and pins images of a Room
+type imageReconciler struct {
+	*client.Client
+	Log      logr.Logger
+	resolver digestResolver
+	digests  *digestCache
+	config   *hubconfig.Config
+}
+
+// newImageReconciler returns new instance of imageReconciler
+func newImageReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*imageReconciler, error) {
+	return &imageReconciler{
+		config:   config,
+		Log:      log,
+		Client:   client,
+		resolver: image.NewResolver(),
+		digests:  newDigestCache(digestCacheTTL),
+	}, nil
+}
+
+// reconcileImages checks images of actors against the image policy of the problem
+// and pins images of the room to digests. The returned reason is not empty if the
+// room should be rejected because of its images.
+func (i *imageReconciler) reconcileImages(ctx context.Context, room *hubv1.Room) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "imageReconciler.reconcileImages", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	policy := room.Spec.Setting.ImagePolicy
+
+	for _, actor := range room.Spec.Actors {
+		// containers of the actor are contestant code as well, unlike those of its role
+		images := []string{actor.Image}
+		for _, container := range append(append([]corev1.Container{}, actor.InitContainers...), actor.Sidecars...) {
+			images = append(images, container.Image)
+		}
+
+		for _, img := range images {
+			if err := image.CheckPolicy(img, policy); err != nil {
+				return fmt.Sprintf("Actor %s is not allowed to run.\n%s", actor.Name, err.Error()), nil
+			}
+		}
+	}
+
+	// images are pinned once in the life-cycle of a room, so a match is reproducible
+	if room.Status.ImagesPinned {
+		return "", nil
+	}
+
+	logger := logging.Logger(ctx, i.Log).WithValues("reconciler", "Image")
+
+	keychain, err := i.keychain(ctx, room)
+	if err != nil {
+		return "", err
+	}
+
+	// every image of an actor is pinned, since RequireDigest lets their tags through if digests are resolved
+	if policy != nil && policy.ResolveDigests {
+		for _, actor := range room.Spec.Actors {
+			images := []*string{&actor.Image}
+			for j := range actor.InitContainers {
+				images = append(images, &actor.InitContainers[j].Image)
+			}
+			for j := range actor.Sidecars {
+				images = append(images, &actor.Sidecars[j].Image)
+			}
+
+			for _, img := range images {
+				resolved, err := i.resolver.Resolve(ctx, *img, keychain)
+				if image.IsNotFound(err) || image.IsUnauthorized(err) {
+					return fmt.Sprintf("Image of actor %s could not be pinned to its digest.\n%s", actor.Name, err.Error()), nil
+				} else if err != nil {
+					return "", err
+				}
+
+				if resolved != *img {
+					logger.Info("pinned image of actor", "actor", actor.Name, "image", resolved)
+					*img = resolved
+				}
+			}
+		}
+	}
+
+	// Director and gimulator images are pinned on a best-effort basis,
+	// an image the registry does not have or serve to the hub is pulled on every start as before
+	images := []*string{&room.Spec.Director.Image}
+	if room.Spec.Gimulator != nil && room.Spec.Gimulator.Image != "" {
+		images = append(images, &room.Spec.Gimulator.Image)
+	} else if room.Spec.Setting.Gimulator != nil {
+		images = append(images, &room.Spec.Setting.Gimulator.Image)
+	}
+	for _, img := range images {
+		if *img, err = i.pin(ctx, room, *img, keychain, logger); err != nil {
+			return "", err
+		}
+	}
+
+	room.Status.ImagesPinned = true
+	return "", nil
+}
+
+// pin returns the image pinned to its digest, or the image itself if the registry
+// does not have it or refuses the credentials. Other errors are returned, so the step is retried.
+func (i *imageReconciler) pin(ctx context.Context, room *hubv1.Room, img string, keychain *image.Keychain, logger logr.Logger) (string, error) {
+	key := room.Namespace + "/" + room.Spec.ProblemID + "/" + img
+	if resolved, ok := i.digests.get(key, time.Now()); ok {
+		return resolved, nil
+	}
+
+	resolved, err := i.resolver.Resolve(ctx, img, keychain)
+	if image.IsNotFound(err) || image.IsUnauthorized(err) {
+		logger.Error(err, "could not pin image, falling back to its tag", "image", img)
+		return img, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if resolved != img {
+		logger.Info("pinned image", "image", resolved)
+	}
+	i.digests.add(key, resolved, time.Now())
+	return resolved, nil
+}
+
+// digestCache keeps the digests images of settings were pinned to,
+// so the rooms of a problem run the same images and do not query the registry each
+type digestCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedDigest
+}
+
+type cachedDigest struct {
+	image   string
+	expires time.Time
+}
+
+// newDigestCache returns new instance of digestCache
+func newDigestCache(ttl time.Duration) *digestCache {
+	return &digestCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedDigest),
+	}
+}
+
+func (c *digestCache) get(key string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expires) {
+		return "", false
+	}
+	return entry.image, true
+}
+
+func (c *digestCache) add(key, img string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedDigest{image: img, expires: now.Add(c.ttl)}
+}
+
+// keychain reads the credentials of the image pull secrets of the room
+func (i *imageReconciler) keychain(ctx context.Context, room *hubv1.Room) (*image.Keychain, error) {
+	secrets := make([]*corev1.Secret, 0)
+	for _, secretName := range pullSecretNames(room, i.config) {
+		secret, err := i.GetSecret(ctx, types.NamespacedName{Name: secretName, Namespace: room.Namespace})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return image.NewKeychain(secrets...)
+}
+
+// reconcileWarmNodes finds the nodes which have every image of the room in the image cache.
+// Warm nodes are refreshed until pods of the room start, since they only matter when pods of the room are created.
+func (i *imageReconciler) reconcileWarmNodes(ctx context.Context, room *hubv1.Room) (err error) {
+	ctx, span := tracing.Start(ctx, "imageReconciler.reconcileWarmNodes", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	if !isQueued(room) {
+		return nil
+	}
+
+	// the warmer keeps the image cache of rooms of every namespace in the namespace of the manager
+	cm, err := i.GetConfigMap(ctx, types.NamespacedName{Name: name.ImageCacheConfigMapName(), Namespace: i.config.Hub().Namespace})
+	if errors.IsNotFound(err) {
+		room.Status.WarmNodes = nil
+		room.Status.ImagesWarm = false
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	images := roomImages(room)
+	warmNodes := make([]string, 0)
+	for node, data := range cm.Data {
+		cached := make(map[string]bool)
+		for _, img := range strings.Split(data, "\n") {
+			cached[img] = true
+		}
+
+		warm := true
+		for _, img := range images {
+			if !cached[img] {
+				warm = false
+				break
+			}
+		}
+		if warm {
+			warmNodes = append(warmNodes, node)
+		}
+	}
+
+	sort.Strings(warmNodes)
+	room.Status.WarmNodes = warmNodes
+	room.Status.ImagesWarm = len(warmNodes) > 0
+	return nil
+}
+
+// preferWarmNodes makes the scheduler prefer the nodes which already have images of the room
+func preferWarmNodes(room *hubv1.Room, pod *corev1.Pod) {
+	if len(room.Status.WarmNodes) == 0 {
+		return
+	}
+
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+
+	nodeAffinity := pod.Spec.Affinity.NodeAffinity
+	nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, corev1.PreferredSchedulingTerm{
+		Weight: 50,
+		Preference: corev1.NodeSelectorTerm{
+			MatchFields: []corev1.NodeSelectorRequirement{
+				{
+					Key:      "metadata.name",
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   room.Status.WarmNodes,
+				},
+			},
+		},
+	})
+}
+
+// pullSecretNames returns names of the secrets used to pull images of the room.
+// Priorities:
+// 1. room.Spec.ImagePullSecrets
+// 2. room.Spec.Setting.ImagePullSecrets
+// 3. ImagePullSecrets of the tenant of the room
+// 4. name.RegistrySecretName()
+func pullSecretNames(room *hubv1.Room, config *hubconfig.Config) []string {
+	if len(room.Spec.ImagePullSecrets) > 0 {
+		return room.Spec.ImagePullSecrets
+	}
+	if room.Spec.Setting != nil && len(room.Spec.Setting.ImagePullSecrets) > 0 {
+		return room.Spec.Setting.ImagePullSecrets
+	}
+	if secrets := config.TenantOf(room.Namespace).ImagePullSecrets; len(secrets) > 0 {
+		return secrets
+	}
+	return []string{name.RegistrySecretName()}
+}
+
+// pullSecrets returns the image pull secrets of pods of the room
+func pullSecrets(room *hubv1.Room, config *hubconfig.Config) []corev1.LocalObjectReference {
+	refs := make([]corev1.LocalObjectReference, 0)
+	for _, secretName := range pullSecretNames(room, config) {
+		refs = append(refs, corev1.LocalObjectReference{Name: secretName})
+	}
+	return refs
+}
+
+// pullPolicy returns IfNotPresent for images pinned to a digest, since their content never changes,
+// and the given policy for images referenced by a tag
+func pullPolicy(img string, unpinned corev1.PullPolicy) corev1.PullPolicy {
+	if isPinned(img) {
+		return corev1.PullIfNotPresent
+	}
+	return unpinned
+}
+
+// isPinned returns true if the image is referenced by its digest
+func isPinned(img string) bool {
+	ref, err := image.ParseReference(img)
+	return err == nil && ref.Digest != ""
+}
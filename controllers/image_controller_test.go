@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/image"
+)
+
+func TestDigestCache(t *testing.T) {
+	cache := newDigestCache(time.Minute)
+	now := time.Now()
+
+	if _, ok := cache.get("hub/problem/director:v1", now); ok {
+		t.Fatal("get() of an empty cache should miss")
+	}
+
+	cache.add("hub/problem/director:v1", "director@sha256:a", now)
+	if got, ok := cache.get("hub/problem/director:v1", now.Add(time.Second*30)); !ok || got != "director@sha256:a" {
+		t.Errorf("get() = %q, %v, want the cached digest", got, ok)
+	}
+	if _, ok := cache.get("hub/other/director:v1", now); ok {
+		t.Error("get() of another problem should miss")
+	}
+	if _, ok := cache.get("hub/problem/director:v1", now.Add(time.Minute*2)); ok {
+		t.Error("get() of an expired entry should miss")
+	}
+
+	cache.add("hub/problem/gimulator:v1", "gimulator@sha256:b", now.Add(time.Minute*2))
+	if _, ok := cache.entries["hub/problem/director:v1"]; ok {
+		t.Error("add() should drop expired entries")
+	}
+}
+
+// fakeResolver pins images to the digests it knows and fails with the registry status of other images
+type fakeResolver struct {
+	digests map[string]string
+	status  int
+}
+
+func (f fakeResolver) Resolve(_ context.Context, img string, _ *image.Keychain) (string, error) {
+	if resolved, ok := f.digests[img]; ok {
+		return resolved, nil
+	}
+	return "", &image.StatusError{Image: img, StatusCode: f.status, Status: http.StatusText(f.status)}
+}
+
+func TestReconcileImagesResolveDigests(t *testing.T) {
+	digests := map[string]string{
+		"director:v1": "director@sha256:d",
+		"alice:v1":    "alice@sha256:a",
+		"weights:v1":  "weights@sha256:w",
+		"meter:v1":    "meter@sha256:m",
+	}
+	newRoom := func(sidecar string) *hubv1.Room {
+		return &hubv1.Room{Spec: hubv1.RoomSpec{
+			ID:       "room-1",
+			Director: &hubv1.Director{Name: "director", Image: "director:v1"},
+			Actors: []*hubv1.Actor{{
+				Name:           "alice",
+				Image:          "alice:v1",
+				InitContainers: []corev1.Container{{Name: "weights", Image: "weights:v1"}},
+				Sidecars:       []corev1.Container{{Name: "meter", Image: sidecar}},
+			}},
+			Setting: &hubv1.Setting{ImagePolicy: &hubv1.ImagePolicy{RequireDigest: true, ResolveDigests: true}},
+		}}
+	}
+
+	i, err := newImageReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.resolver = fakeResolver{digests: digests, status: http.StatusNotFound}
+
+	room := newRoom("meter:v1")
+	if reason, err := i.reconcileImages(context.Background(), room); reason != "" || err != nil {
+		t.Fatalf("reconcileImages() = %q, %v, want every image pinned", reason, err)
+	}
+	actor := room.Spec.Actors[0]
+	if actor.Image != "alice@sha256:a" || actor.InitContainers[0].Image != "weights@sha256:w" || actor.Sidecars[0].Image != "meter@sha256:m" {
+		t.Errorf("images = %s, %s, %s, want the containers of the actor pinned as well", actor.Image, actor.InitContainers[0].Image, actor.Sidecars[0].Image)
+	}
+
+	for _, status := range []int{http.StatusNotFound, http.StatusUnauthorized} {
+		i.resolver = fakeResolver{digests: digests, status: status}
+		reason, err := i.reconcileImages(context.Background(), newRoom("missing:v1"))
+		if err != nil {
+			t.Fatalf("reconcileImages() returned error %v, want a reason", err)
+		}
+		if !strings.Contains(reason, "missing:v1") || !strings.Contains(reason, http.StatusText(status)) {
+			t.Errorf("reason = %q, want the image and the response of the registry", reason)
+		}
+	}
+}
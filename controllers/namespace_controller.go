@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/tracing"
+)
+
+// namespaceReconciler reconciles the ephemeral namespace of a Room
+type namespaceReconciler struct {
+	*client.Client
+	Log    logr.Logger
+	config *hubconfig.Config
+}
+
+// newNamespaceReconciler returns new instance of namespaceReconciler
+func newNamespaceReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*namespaceReconciler, error) {
+	return &namespaceReconciler{
+		config: config,
+		Log:    log,
+		Client: client,
+	}, nil
+}
+
+// reconcileNamespace creates the ephemeral namespace of a room which asks for one and copies the
+// secrets its pods need. It returns a reason if the room should be rejected because its setting
+// can not run in its own namespace.
+func (n *namespaceReconciler) reconcileNamespace(ctx context.Context, room *hubv1.Room) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "namespaceReconciler.reconcileNamespace", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	logger := logging.Logger(ctx, n.Log).WithValues("reconciler", "Namespace")
+
+	if room.Spec.Setting.Namespace == nil {
+		logger.Info("starting to copy secrets of the manager")
+		return "", n.copyManagerSecrets(ctx, room)
+	}
+
+	if !n.config.Hub().AllowRoomNamespaces {
+		return fmt.Sprintf("Problem %s asks for room namespaces, but they are not allowed by the manager.", room.Spec.ProblemID), nil
+	}
+
+	if len(roomPVCNames(room)) > 0 || len(room.Spec.Setting.Datasets) > 0 {
+		return "Data PVCs and datasets can not be mounted by rooms running in their own namespace.", nil
+	}
+
+	if keepsOutputs(room) {
+		return "Output PVCs can not outlive rooms running in their own namespace.", nil
+	}
+
+	// the finalizer should be persisted before the namespace is created,
+	// otherwise deleting the room could leave the namespace behind
+	if !controllerutil.ContainsFinalizer(room, name.RoomNamespaceFinalizer()) {
+		logger.Info("starting to add namespace finalizer")
+		controllerutil.AddFinalizer(room, name.RoomNamespaceFinalizer())
+		room.Status.Namespace = name.RoomNamespaceName(room.Spec.ID)
+
+		syncedRoom, err := n.SyncRoom(ctx, room)
+		if err != nil {
+			return "", err
+		}
+		room.ObjectMeta = syncedRoom.ObjectMeta
+	}
+
+	logger.Info("starting to sync namespace")
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: room.Status.Namespace,
+			Labels: map[string]string{
+				name.RoomLabel():    room.Spec.ID,
+				name.ProblemLabel(): room.Spec.ProblemID,
+			},
+		},
+	}
+	if _, err := n.SyncNamespace(ctx, ns); err != nil {
+		return "", err
+	}
+
+	logger.Info("starting to sync resource quota")
+	if err := n.reconcileResourceQuota(ctx, room); err != nil {
+		return "", err
+	}
+
+	logger.Info("starting to sync limit range")
+	if err := n.reconcileLimitRange(ctx, room); err != nil {
+		return "", err
+	}
+
+	logger.Info("starting to copy secrets")
+	secretNames := pullSecretNames(room, n.config)
+	for _, template := range room.Spec.Setting.Templates {
+		if template != nil && template.PushSecret != "" {
+			secretNames = append(secretNames, template.PushSecret)
+		}
+	}
+	for _, secretName := range secretNames {
+		if n.isManagerSecret(room, secretName) {
+			continue
+		}
+		if err := n.copySecret(ctx, room, room.Namespace, secretName); err != nil {
+			return "", err
+		}
+	}
+
+	logger.Info("starting to copy secrets of the manager")
+	return "", n.copyManagerSecrets(ctx, room)
+}
+
+// copyManagerSecrets copies the secrets of the manager which pods of the room reference into the
+// namespace they run in, unless it is the namespace of the manager: the credentials of RabbitMQ
+// and the registry secret, if the room pulls its images with it
+func (n *namespaceReconciler) copyManagerSecrets(ctx context.Context, room *hubv1.Room) error {
+	managerNamespace := n.config.Hub().Namespace
+	if room.WorkloadNamespace() == managerNamespace {
+		return nil
+	}
+
+	secretNames := []string{n.config.Hub().Rabbit.CredentialsSecret}
+	for _, secretName := range pullSecretNames(room, n.config) {
+		if n.isManagerSecret(room, secretName) {
+			secretNames = append(secretNames, secretName)
+		}
+	}
+	for _, secretName := range secretNames {
+		if err := n.copySecret(ctx, room, managerNamespace, secretName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isManagerSecret returns true for the secrets of the manager namespace which pods of the room use,
+// rather than secrets of the namespace of the room
+func (n *namespaceReconciler) isManagerSecret(room *hubv1.Room, secretName string) bool {
+	if secretName == n.config.Hub().Rabbit.CredentialsSecret {
+		return true
+	}
+	// the registry secret is the default of rooms, tenants and settings setting none
+	return secretName == name.RegistrySecretName() &&
+		len(room.Spec.ImagePullSecrets) == 0 &&
+		len(room.Spec.Setting.ImagePullSecrets) == 0 &&
+		len(n.config.TenantOf(room.Namespace).ImagePullSecrets) == 0
+}
+
+func (n *namespaceReconciler) reconcileResourceQuota(ctx context.Context, room *hubv1.Room) error {
+	if room.Spec.Setting.Namespace.ResourceQuota == nil {
+		return nil
+	}
+
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.ResourceQuotaName(),
+			Namespace: room.WorkloadNamespace(),
+		},
+		Spec: *room.Spec.Setting.Namespace.ResourceQuota.DeepCopy(),
+	}
+
+	_, err := n.SyncResourceQuota(ctx, quota, room)
+	return err
+}
+
+func (n *namespaceReconciler) reconcileLimitRange(ctx context.Context, room *hubv1.Room) error {
+	if room.Spec.Setting.Namespace.LimitRange == nil {
+		return nil
+	}
+
+	limitRange := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.LimitRangeName(),
+			Namespace: room.WorkloadNamespace(),
+		},
+		Spec: *room.Spec.Setting.Namespace.LimitRange.DeepCopy(),
+	}
+
+	_, err := n.SyncLimitRange(ctx, limitRange, room)
+	return err
+}
+
+// copySecret copies a secret of namespace into the namespace pods of the room run in, since pods
+// can not reference secrets of other namespaces. Copies are shared by rooms of their namespace,
+// so they are not owned by the room.
+func (n *namespaceReconciler) copySecret(ctx context.Context, room *hubv1.Room, namespace, secretName string) error {
+	secret, err := n.GetSecret(ctx, types.NamespacedName{Name: secretName, Namespace: namespace})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	copied := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName,
+			Namespace: room.WorkloadNamespace(),
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}
+
+	_, err = n.SyncSecret(ctx, copied, nil)
+	return err
+}
+
+// finalizeNamespace deletes the ephemeral namespace of a room which is being deleted
+// and removes the finalizer, so the room can go away
+func (n *namespaceReconciler) finalizeNamespace(ctx context.Context, room *hubv1.Room) error {
+	if !controllerutil.ContainsFinalizer(room, name.RoomNamespaceFinalizer()) {
+		return nil
+	}
+
+	if room.Status.Namespace != "" && room.Status.Namespace != room.Namespace {
+		ns, err := n.GetNamespace(ctx, room.Status.Namespace)
+		if err == nil {
+			if err := n.DeleteNamespace(ctx, ns); err != nil {
+				return err
+			}
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	controllerutil.RemoveFinalizer(room, name.RoomNamespaceFinalizer())
+	return n.Update(ctx, room)
+}
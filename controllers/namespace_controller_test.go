@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+)
+
+func TestReconcileNamespaceReason(t *testing.T) {
+	tests := map[string]struct {
+		allow   bool
+		setting hubv1.Setting
+	}{
+		"room namespaces are not allowed": {
+			allow: false,
+		},
+		"datasets": {
+			allow:   true,
+			setting: hubv1.Setting{Datasets: []hubv1.Dataset{{Name: "maps", Prefix: "maps/"}}},
+		},
+		"data PVCs": {
+			allow:   true,
+			setting: hubv1.Setting{Volumes: []hubv1.Volume{{PVCName: "maps", MountPath: "/maps"}}},
+		},
+		"outputs are kept": {
+			allow: true,
+			setting: hubv1.Setting{
+				OutputVolumeSize: "1Gi",
+				Output:           &hubv1.OutputSettings{Retention: &hubv1.OutputRetention{Policy: hubv1.OutputRetentionKeep}},
+			},
+		},
+	}
+
+	for title, test := range tests {
+		t.Run(title, func(t *testing.T) {
+			hub := hubconfig.Default()
+			hub.AllowRoomNamespaces = test.allow
+			n, err := newNamespaceReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hub))
+			if err != nil {
+				t.Fatal(err)
+			}
+			setting := test.setting
+			setting.Namespace = &hubv1.NamespaceSettings{}
+			room := &hubv1.Room{Spec: hubv1.RoomSpec{ID: "room-1", ProblemID: "problem-1", Setting: &setting}}
+
+			reason, err := n.reconcileNamespace(context.Background(), room)
+			if err != nil {
+				t.Fatalf("reconcileNamespace() returned error %v, want a reason", err)
+			}
+			if reason == "" {
+				t.Error("reconcileNamespace() returned no reason, the room can never run")
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/image"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/tracing"
+)
+
+// networkReconciler reconciles network policies isolating a Room
+type networkReconciler struct {
+	*client.Client
+	Log    logr.Logger
+	config *hubconfig.Config
+}
+
+// newNetworkReconciler returns new instance of networkReconciler
+func newNetworkReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*networkReconciler, error) {
+	return &networkReconciler{
+		config: config,
+		Log:    log,
+		Client: client,
+	}, nil
+}
+
+// reconcileNetwork isolates the pods of a room from the rest of the cluster:
+// 1. every pod of the room is denied all traffic
+// 2. the gimulator accepts connections from the pods of its room and from the manager
+// 3. actors and the director can reach their gimulator, DNS and the allowed egress destinations
+// 4. pods fetching source code can reach the object store
+// 5. pods building submissions can reach the registries of the templates
+func (n *networkReconciler) reconcileNetwork(ctx context.Context, room *hubv1.Room) (err error) {
+	ctx, span := tracing.Start(ctx, "networkReconciler.reconcileNetwork", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	if !isolated(room) {
+		return nil
+	}
+
+	logger := logging.Logger(ctx, n.Log).WithValues("reconciler", "Network")
+
+	logger.Info("starting to sync deny-all network policy")
+	if _, err := n.SyncNetworkPolicy(ctx, n.denyAllPolicyManifest(room), room); err != nil {
+		logger.Error(err, "could not sync deny-all network policy")
+		return err
+	}
+
+	logger.Info("starting to sync gimulator's network policy")
+	if _, err := n.SyncNetworkPolicy(ctx, n.gimulatorPolicyManifest(room), room); err != nil {
+		logger.Error(err, "could not sync gimulator's network policy")
+		return err
+	}
+
+	logger.Info("starting to sync participants' network policy")
+	if _, err := n.SyncNetworkPolicy(ctx, n.participantsPolicyManifest(room), room); err != nil {
+		logger.Error(err, "could not sync participants' network policy")
+		return err
+	}
+
+	if policy := n.objectStorePolicyManifest(room); policy != nil {
+		logger.Info("starting to sync object store network policy")
+		if _, err := n.SyncNetworkPolicy(ctx, policy, room); err != nil {
+			logger.Error(err, "could not sync object store network policy")
+			return err
+		}
+	}
+
+	if policy := n.builderPolicyManifest(room); policy != nil {
+		logger.Info("starting to sync builder network policy")
+		if _, err := n.SyncNetworkPolicy(ctx, policy, room); err != nil {
+			logger.Error(err, "could not sync builder network policy")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isolated returns whether the pods of a room are isolated by network policies
+func isolated(room *hubv1.Room) bool {
+	return room.Spec.Setting.Network == nil || !room.Spec.Setting.Network.Disabled
+}
+
+// isolationReason returns why the pods of an isolated room could not reach the services
+// they need, or an empty string if they can
+func isolationReason(room *hubv1.Room, config *hubconfig.Config) string {
+	if !isolated(room) {
+		return ""
+	}
+	network := config.Hub().Network
+	for _, actor := range room.Spec.Actors {
+		if actor.Source == nil {
+			continue
+		}
+		if len(network.ObjectStore) == 0 {
+			return fmt.Sprintf("Source code of actor %s can not be fetched in an isolated room, network.objectStore of the hub is not set.", actor.Name)
+		}
+		template := room.Spec.Setting.Templates[actor.Source.Template]
+		if template != nil && template.Mode == hubv1.SubmissionModeBuild && len(network.Registry) == 0 {
+			return fmt.Sprintf("Source code of actor %s can not be built in an isolated room, network.registry of the hub is not set.", actor.Name)
+		}
+	}
+	return ""
+}
+
+func (n *networkReconciler) denyAllPolicyManifest(room *hubv1.Room) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.DenyAllNetworkPolicyName(room.Spec.ID),
+			Namespace: room.WorkloadNamespace(),
+			Labels:    n.policyLabels(room),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					name.RoomLabel(): room.Spec.ID,
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+				networkingv1.PolicyTypeEgress,
+			},
+		},
+	}
+}
+
+func (n *networkReconciler) gimulatorPolicyManifest(room *hubv1.Room) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.GimulatorNetworkPolicyName(room.Spec.ID),
+			Namespace: room.WorkloadNamespace(),
+			Labels:    n.policyLabels(room),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					name.CharacterLabel(): name.CharacterGimulator(),
+					name.RoomLabel():      room.Spec.ID,
+				},
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: n.gimulatorPorts(),
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									name.RoomLabel(): room.Spec.ID,
+								},
+							},
+						},
+						{
+							// The manager reports statuses of pods to the gimulator
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									name.NamespaceNameLabel(): n.config.Hub().Namespace,
+								},
+							},
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									name.ManagerLabel(): name.ManagerLabelValue(),
+								},
+							},
+						},
+					},
+				},
+			},
+			// The gimulator publishes results to the message queue
+			Egress: []networkingv1.NetworkPolicyEgressRule{{}},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+				networkingv1.PolicyTypeEgress,
+			},
+		},
+	}
+}
+
+func (n *networkReconciler) participantsPolicyManifest(room *hubv1.Room) *networkingv1.NetworkPolicy {
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: n.gimulatorPorts(),
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							name.CharacterLabel(): name.CharacterGimulator(),
+							name.RoomLabel():      room.Spec.ID,
+						},
+					},
+				},
+			},
+		},
+		{
+			// The gimulator is addressed by the name of its service
+			Ports: n.dnsPorts(),
+			To:    n.dnsPeers(),
+		},
+	}
+	if room.Spec.Setting.Network != nil {
+		for _, rule := range room.Spec.Setting.Network.Egress {
+			egress = append(egress, *rule.DeepCopy())
+		}
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.ParticipantsNetworkPolicyName(room.Spec.ID),
+			Namespace: room.WorkloadNamespace(),
+			Labels:    n.policyLabels(room),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					name.RoomLabel(): room.Spec.ID,
+				},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      name.CharacterLabel(),
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   []string{name.CharacterActor(), name.CharacterDirector()},
+					},
+				},
+			},
+			Egress: egress,
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeEgress,
+			},
+		},
+	}
+}
+
+// objectStorePolicyManifest allows pods labeled by name.ObjectStoreLabel to reach the object store.
+// It returns nil if network.objectStore is not set, since a rule without peers allows every address.
+func (n *networkReconciler) objectStorePolicyManifest(room *hubv1.Room) *networkingv1.NetworkPolicy {
+	if len(n.config.Hub().Network.ObjectStore) == 0 {
+		return nil
+	}
+
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(objectStorePort(n.config.Hub().S3.URL))
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.ObjectStoreNetworkPolicyName(room.Spec.ID),
+			Namespace: room.WorkloadNamespace(),
+			Labels:    n.policyLabels(room),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					name.RoomLabel():        room.Spec.ID,
+					name.ObjectStoreLabel(): name.ObjectStoreLabelValue(),
+				},
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+					To:    deepCopyPeers(n.config.Hub().Network.ObjectStore),
+				},
+				{
+					// The object store is addressed by name
+					Ports: n.dnsPorts(),
+					To:    n.dnsPeers(),
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeEgress,
+			},
+		},
+	}
+}
+
+// builderPolicyManifest allows builders to reach the registries images are pulled from and pushed to.
+// It returns nil if no template of the room builds images, or if network.registry is not set since
+// a rule without peers allows every address.
+func (n *networkReconciler) builderPolicyManifest(room *hubv1.Room) *networkingv1.NetworkPolicy {
+	if len(n.config.Hub().Network.Registry) == 0 {
+		return nil
+	}
+
+	tcp := corev1.ProtocolTCP
+	ports := make([]networkingv1.NetworkPolicyPort, 0)
+	seen := make(map[int]bool)
+
+	names := make([]string, 0, len(room.Spec.Setting.Templates))
+	for templateName := range room.Spec.Setting.Templates {
+		names = append(names, templateName)
+	}
+	sort.Strings(names)
+
+	for _, templateName := range names {
+		template := room.Spec.Setting.Templates[templateName]
+		if template == nil || template.Mode != hubv1.SubmissionModeBuild {
+			continue
+		}
+		// builds of invalid repositories fail before they reach the network
+		port, err := image.RegistryPort(template.Repository)
+		if err != nil || seen[port] {
+			continue
+		}
+		seen[port] = true
+		p := intstr.FromInt(port)
+		ports = append(ports, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &p})
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.BuilderNetworkPolicyName(room.Spec.ID),
+			Namespace: room.WorkloadNamespace(),
+			Labels:    n.policyLabels(room),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					name.CharacterLabel(): name.CharacterBuilder(),
+					name.RoomLabel():      room.Spec.ID,
+				},
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					Ports: ports,
+					To:    deepCopyPeers(n.config.Hub().Network.Registry),
+				},
+				{
+					// Registries are addressed by name
+					Ports: n.dnsPorts(),
+					To:    n.dnsPeers(),
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeEgress,
+			},
+		},
+	}
+}
+
+// objectStorePort returns the port of the object store at url, which may lack a scheme
+func objectStorePort(url string) int {
+	port := 80
+	if strings.HasPrefix(url, "https://") {
+		port = 443
+	}
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	url = strings.SplitN(url, "/", 2)[0]
+
+	if _, p, err := net.SplitHostPort(url); err == nil {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			port = parsed
+		}
+	}
+	return port
+}
+
+func (n *networkReconciler) dnsPorts() []networkingv1.NetworkPolicyPort {
+	udp := corev1.ProtocolUDP
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(name.DNSPort())
+
+	return []networkingv1.NetworkPolicyPort{
+		{Protocol: &udp, Port: &port},
+		{Protocol: &tcp, Port: &port},
+	}
+}
+
+func (n *networkReconciler) dnsPeers() []networkingv1.NetworkPolicyPeer {
+	return deepCopyPeers(n.config.Hub().Network.DNS)
+}
+
+func deepCopyPeers(peers []networkingv1.NetworkPolicyPeer) []networkingv1.NetworkPolicyPeer {
+	if len(peers) == 0 {
+		return nil
+	}
+	copied := make([]networkingv1.NetworkPolicyPeer, 0, len(peers))
+	for _, peer := range peers {
+		copied = append(copied, *peer.DeepCopy())
+	}
+	return copied
+}
+
+func (n *networkReconciler) gimulatorPorts() []networkingv1.NetworkPolicyPort {
+	tcp := corev1.ProtocolTCP
+	port := intstr.FromInt(int(n.config.Hub().Gimulator.Port))
+
+	return []networkingv1.NetworkPolicyPort{
+		{Protocol: &tcp, Port: &port},
+	}
+}
+
+func (n *networkReconciler) policyLabels(room *hubv1.Room) map[string]string {
+	return map[string]string{
+		name.RoomLabel():    room.Spec.ID,
+		name.ProblemLabel(): room.Spec.ProblemID,
+	}
+}
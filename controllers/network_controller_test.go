@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+func TestParticipantsPolicyDNS(t *testing.T) {
+	n, err := newNetworkReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{ID: "room-1", Setting: &hubv1.Setting{}}}
+
+	egress := n.participantsPolicyManifest(room).Spec.Egress
+	if len(egress) != 2 {
+		t.Fatalf("egress = %v, want the gimulator and DNS", egress)
+	}
+	peers := egress[1].To
+	if len(peers) != 1 || peers[0].NamespaceSelector == nil || peers[0].PodSelector == nil {
+		t.Fatalf("DNS peers = %v, want only the DNS pods", peers)
+	}
+	if got := peers[0].NamespaceSelector.MatchLabels[name.NamespaceNameLabel()]; got != "kube-system" {
+		t.Errorf("DNS namespace = %q, want kube-system", got)
+	}
+	if got := peers[0].PodSelector.MatchLabels["k8s-app"]; got != "kube-dns" {
+		t.Errorf("DNS pods = %q, want kube-dns", got)
+	}
+}
+
+func TestObjectStorePolicy(t *testing.T) {
+	hub := hubconfig.Default()
+	hub.S3.URL = "minio.storage:9000"
+	minio := metav1.LabelSelector{MatchLabels: map[string]string{name.NamespaceNameLabel(): "storage"}}
+	n, err := newNetworkReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{ID: "room-1", Setting: &hubv1.Setting{}}}
+
+	if policy := n.objectStorePolicyManifest(room); policy != nil {
+		t.Errorf("objectStorePolicyManifest() = %v, want nil without network.objectStore", policy)
+	}
+
+	hub.Network.ObjectStore = []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &minio}}
+	policy := n.objectStorePolicyManifest(room)
+	if got := policy.Spec.PodSelector.MatchLabels[name.ObjectStoreLabel()]; got != name.ObjectStoreLabelValue() {
+		t.Errorf("pod selector = %v, want only pods fetching from the object store", policy.Spec.PodSelector)
+	}
+	rule := policy.Spec.Egress[0]
+	if len(rule.Ports) != 1 || rule.Ports[0].Port.IntValue() != 9000 {
+		t.Errorf("ports = %v, want the port of s3.url", rule.Ports)
+	}
+	if len(rule.To) != 1 || rule.To[0].NamespaceSelector.MatchLabels[name.NamespaceNameLabel()] != "storage" {
+		t.Errorf("peers = %v, want network.objectStore", rule.To)
+	}
+}
+
+func TestObjectStorePort(t *testing.T) {
+	tests := map[string]int{
+		"minio:9000":         9000,
+		"http://minio:9000":  9000,
+		"minio":              80,
+		"https://s3.example": 443,
+		"https://s3:8443/":   8443,
+	}
+	for url, want := range tests {
+		if got := objectStorePort(url); got != want {
+			t.Errorf("objectStorePort(%q) = %d, want %d", url, got, want)
+		}
+	}
+}
+
+func TestIsolationReason(t *testing.T) {
+	hub := hubconfig.Default()
+	config := hubconfig.New(hub)
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{
+		Actors:  []*hubv1.Actor{{Name: "alice", Source: &hubv1.Source{Template: "python"}}},
+		Setting: &hubv1.Setting{},
+	}}
+
+	if reason := isolationReason(room, config); reason == "" {
+		t.Error("isolationReason() is empty, source code can not be fetched without network.objectStore")
+	}
+
+	room.Spec.Setting.Network = &hubv1.NetworkSettings{Disabled: true}
+	if reason := isolationReason(room, config); reason != "" {
+		t.Errorf("isolationReason() = %q, rooms which are not isolated need no peers", reason)
+	}
+
+	room.Spec.Setting.Network = nil
+	hub.Network.ObjectStore = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/24"}}}
+	if reason := isolationReason(room, config); reason != "" {
+		t.Errorf("isolationReason() = %q, want no reason with network.objectStore", reason)
+	}
+
+	room.Spec.Setting.Templates = map[string]*hubv1.RuntimeTemplate{"python": {Mode: hubv1.SubmissionModeBuild}}
+	if reason := isolationReason(room, config); reason == "" {
+		t.Error("isolationReason() is empty, images can not be built without network.registry")
+	}
+	hub.Network.Registry = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.12.0/24"}}}
+	if reason := isolationReason(room, config); reason != "" {
+		t.Errorf("isolationReason() = %q, want no reason with network.registry", reason)
+	}
+}
+
+func TestBuilderPolicy(t *testing.T) {
+	hub := hubconfig.Default()
+	n, err := newNetworkReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{ID: "room-1", Setting: &hubv1.Setting{
+		Templates: map[string]*hubv1.RuntimeTemplate{
+			"python": {Mode: hubv1.SubmissionModeInterpret},
+		},
+	}}}
+	if policy := n.builderPolicyManifest(room); policy != nil {
+		t.Errorf("builderPolicyManifest() = %v, want nil without build templates", policy)
+	}
+
+	room.Spec.Setting.Templates["cpp"] = &hubv1.RuntimeTemplate{Mode: hubv1.SubmissionModeBuild, Repository: "registry.example.com/cpp"}
+	room.Spec.Setting.Templates["go"] = &hubv1.RuntimeTemplate{Mode: hubv1.SubmissionModeBuild, Repository: "registry.example.com/go"}
+	room.Spec.Setting.Templates["rust"] = &hubv1.RuntimeTemplate{Mode: hubv1.SubmissionModeBuild, Repository: "localhost:5000/rust"}
+
+	if policy := n.builderPolicyManifest(room); policy != nil {
+		t.Errorf("builderPolicyManifest() = %v, want nil without network.registry", policy)
+	}
+
+	hub.Network.Registry = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.12.0/24"}}}
+	policy := n.builderPolicyManifest(room)
+	if policy == nil {
+		t.Fatal("builderPolicyManifest() = nil, want a policy of the builders")
+	}
+	if policy.Spec.PodSelector.MatchLabels[name.CharacterLabel()] != name.CharacterBuilder() {
+		t.Errorf("pod selector = %v, want only builders", policy.Spec.PodSelector)
+	}
+	ports := policy.Spec.Egress[0].Ports
+	if len(ports) != 2 || ports[0].Port.IntValue() != 443 || ports[1].Port.IntValue() != 5000 {
+		t.Errorf("ports = %v, want the distinct ports of the registries", ports)
+	}
+	if peers := policy.Spec.Egress[0].To; len(peers) != 1 || peers[0].IPBlock.CIDR != "10.0.12.0/24" {
+		t.Errorf("peers = %v, want network.registry", peers)
+	}
+}
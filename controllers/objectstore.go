@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/s3"
+)
+
+// syncS3Secret creates the secret of the credentials a pod copying from or to the object storage uses.
+// Credentials are issued once for each pod and only allow what the pod copies; the secret should be
+// deleted along with the pod by deleteS3Secret, so a pod created again gets new credentials.
+func syncS3Secret(ctx context.Context, c *client.Client, pod *corev1.Pod, owner metav1.Object, issue func(context.Context) (*s3.ScopedCredentials, error)) error {
+	key := types.NamespacedName{Name: name.S3CredentialsSecretName(pod.Name), Namespace: pod.Namespace}
+	if _, err := c.GetSecret(ctx, key); err == nil || !errors.IsNotFound(err) {
+		return err
+	}
+
+	credentials, err := issue(ctx)
+	if err != nil {
+		return err
+	}
+	mcHost, err := credentials.MCHost()
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels:    pod.Labels,
+		},
+		Data: map[string][]byte{
+			"mc-host": []byte(mcHost),
+		},
+	}
+	_, err = c.SyncSecret(ctx, secret, owner)
+	return err
+}
+
+// deleteS3Secret deletes the secret of the credentials of a pod copying from or to the object storage
+func deleteS3Secret(ctx context.Context, c *client.Client, pod *corev1.Pod) error {
+	return c.DeleteSecret(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.S3CredentialsSecretName(pod.Name),
+			Namespace: pod.Namespace,
+		},
+	})
+}
+
+// s3Envs returns the environment variable making mc reach the object storage as alias
+// with the credentials of syncS3Secret of the pod
+func s3Envs(podName, alias string) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name: "MC_HOST_" + alias,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: name.S3CredentialsSecretName(podName)},
+					Key:                  "mc-host",
+				},
+			},
+		},
+	}
+}
+
+// copyFailure returns the termination message of a failed pod copying from or to the object storage
+func copyFailure(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Sprintf("%s exited with %d: %s", status.Name, terminated.ExitCode, terminated.Message)
+		}
+	}
+	if pod.Status.Message != "" {
+		return pod.Status.Message
+	}
+	return "copy failed"
+}
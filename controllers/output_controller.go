@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/naming"
+	"github.com/Gimulator/hub/pkg/s3"
+)
+
+var (
+	// OutputUploadPollInterval is how often the upload of an output PVC is checked, and a failed one retried
+	OutputUploadPollInterval = time.Minute
+)
+
+// OutputReconciler applies the retention policy of output PVCs which outlive their room
+type OutputReconciler struct {
+	*client.Client
+	Log    logr.Logger
+	config *hubconfig.Config
+}
+
+// NewOutputReconciler returns new instance of OutputReconciler
+func NewOutputReconciler(log logr.Logger, client *client.Client, config *hubconfig.Config) (*OutputReconciler, error) {
+	return &OutputReconciler{
+		Log:    log,
+		Client: client,
+		config: config,
+	}, nil
+}
+
+// Reconcile deletes an output PVC whose room is deleted once it has been kept for long enough,
+// or once it is uploaded to the object storage
+func (o *OutputReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.config.Runtime().ReconcileTimeout.Duration)
+	defer cancel()
+
+	ctx = logging.WithReconcileID(ctx)
+	logger := logging.Logger(ctx, o.Log).WithValues("reconciler", "Output", "pvc", req.NamespacedName)
+	logger.Info("starting to reconcile output")
+
+	pvc, err := o.GetPVC(ctx, req.NamespacedName)
+	if errors.IsNotFound(err) {
+		logger.Info("output does not exist")
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		logger.Error(err, "could not get output PVC")
+		return ctrl.Result{}, err
+	}
+
+	if watched, err := watchesNamespace(ctx, o.Client, o.config.Hub(), pvc.Namespace); err != nil {
+		logger.Error(err, "could not check namespace of output")
+		return ctrl.Result{}, err
+	} else if !watched {
+		logger.Info("output is not in a watched namespace")
+		return ctrl.Result{}, nil
+	}
+
+	policy := hubv1.OutputRetentionPolicy(pvc.Annotations[name.OutputRetentionAnnotation()])
+	if policy == "" || policy == hubv1.OutputRetentionDelete {
+		logger.Info("output is deleted along with its room")
+		return ctrl.Result{}, nil
+	}
+
+	if deleted, err := o.isRoomDeleted(ctx, pvc); err != nil {
+		logger.Error(err, "could not check room of output")
+		return ctrl.Result{}, err
+	} else if !deleted {
+		logger.Info("room of output is not deleted yet")
+		return ctrl.Result{}, nil
+	}
+
+	roomDeleted, err := time.Parse(time.RFC3339, pvc.Annotations[name.OutputRoomDeletedAnnotation()])
+	if err != nil {
+		logger.Info("starting to record deletion of room of output")
+		roomDeleted = time.Now().UTC()
+		pvc.Annotations[name.OutputRoomDeletedAnnotation()] = roomDeleted.Format(time.RFC3339)
+		if err := o.Update(ctx, pvc); err != nil {
+			logger.Error(err, "could not record deletion of room of output")
+			return ctrl.Result{}, err
+		}
+	}
+
+	switch policy {
+	case hubv1.OutputRetentionKeep:
+		hours, _ := strconv.Atoi(pvc.Annotations[name.OutputKeepForHoursAnnotation()])
+		if remaining := time.Until(roomDeleted.Add(time.Duration(hours) * time.Hour)); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+	case hubv1.OutputRetentionUntilUploaded:
+		logger.Info("starting to upload output")
+		if uploaded, err := o.upload(ctx, pvc); err != nil {
+			logger.Error(err, "could not upload output")
+			return ctrl.Result{}, err
+		} else if !uploaded {
+			return ctrl.Result{RequeueAfter: OutputUploadPollInterval}, nil
+		}
+	}
+
+	logger.Info("starting to delete output")
+	if err := o.DeletePVC(ctx, pvc); err != nil {
+		logger.Error(err, "could not delete output PVC")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// isRoomDeleted returns true if no room which is not being deleted has the ID of the room of the output
+func (o *OutputReconciler) isRoomDeleted(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	rooms := &hubv1.RoomList{}
+	if err := o.List(ctx, rooms, ctrlclient.InNamespace(pvc.Namespace)); err != nil {
+		return false, err
+	}
+	for _, room := range rooms.Items {
+		if room.Spec.ID == pvc.Labels[name.RoomLabel()] && room.DeletionTimestamp.IsZero() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// upload runs the pod copying an output PVC to the object storage. It returns true once
+// the copy succeeds; the pod of a failed copy is deleted so the copy is retried.
+func (o *OutputReconciler) upload(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	manifest := o.uploaderPodManifest(pvc)
+	bucket := name.S3OutputsBucket(o.config.BucketPrefix(pvc.Namespace))
+	prefix := name.S3OutputObjectPrefix(pvc.Labels[name.RoomLabel()], pvc.Labels[name.OutputLabel()])
+	if err := syncS3Secret(ctx, o.Client, manifest, pvc, func(ctx context.Context) (*s3.ScopedCredentials, error) {
+		return s3.WriteCredentials(ctx, bucket, prefix, o.config.Runtime().ObjectStoreCredentialsDuration.Duration)
+	}); err != nil {
+		return false, err
+	}
+
+	pod, err := o.SyncPod(ctx, manifest, pvc)
+	if err != nil {
+		return false, err
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return true, nil
+	case corev1.PodFailed:
+		logging.Logger(ctx, o.Log).Info("upload of output failed", "pvc", pvc.Name, "reason", copyFailure(pod))
+		if err := o.DeletePod(ctx, pod); err != nil {
+			return false, err
+		}
+		return false, deleteS3Secret(ctx, o.Client, pod)
+	default:
+		return false, nil
+	}
+}
+
+// uploaderPodManifest returns the pod mirroring an output PVC into the outputs bucket
+func (o *OutputReconciler) uploaderPodManifest(pvc *corev1.PersistentVolumeClaim) *corev1.Pod {
+	script := `set -e
+mc mirror --overwrite "$OUTPUT_DIR" "target/$OUTPUT_BUCKET/$OUTPUT_PREFIX"`
+
+	roomID, actorName := pvc.Labels[name.RoomLabel()], pvc.Labels[name.OutputLabel()]
+	podName := name.UploaderPodName(pvc.Name)
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: pvc.Namespace,
+			Labels: map[string]string{
+				name.ProblemLabel(): pvc.Labels[name.ProblemLabel()],
+				name.OutputLabel():  actorName,
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Volumes: []corev1.Volume{
+				{
+					Name: name.OutputVolumeName(actorName),
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvc.Name,
+							ReadOnly:  true,
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:            name.UploaderContainerName(),
+					Image:           o.config.Runtime().Images.ObjectStoreClient,
+					ImagePullPolicy: corev1.PullIfNotPresent,
+					Command:         []string{"sh", "-c", script},
+					Env: append([]corev1.EnvVar{
+						{Name: "OUTPUT_DIR", Value: name.OutputVolumeMountPath()},
+						{Name: "OUTPUT_BUCKET", Value: name.S3OutputsBucket(o.config.BucketPrefix(pvc.Namespace))},
+						{Name: "OUTPUT_PREFIX", Value: name.S3OutputObjectPrefix(roomID, actorName)},
+					}, s3Envs(podName, "target")...),
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      name.OutputVolumeName(actorName),
+							MountPath: name.OutputVolumeMountPath(),
+							ReadOnly:  true,
+						},
+					},
+					TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+				},
+			},
+		},
+	}
+}
+
+func (o *OutputReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// outputs deleted along with their room are left to the garbage collector
+	isKeptOutput := predicate.NewPredicateFuncs(func(obj ctrlclient.Object) bool {
+		_, ok := obj.GetLabels()[name.OutputLabel()]
+		policy := obj.GetAnnotations()[name.OutputRetentionAnnotation()]
+		return ok && policy != "" && policy != string(hubv1.OutputRetentionDelete)
+	})
+
+	// deleting a room starts the retention of its outputs
+	toOutputs := handler.EnqueueRequestsFromMapFunc(o.outputsOfRoom)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("output").
+		For(&corev1.PersistentVolumeClaim{}, builder.WithPredicates(isKeptOutput)).
+		Watches(&source.Kind{Type: &hubv1.Room{}}, toOutputs).
+		Complete(o)
+}
+
+// outputsOfRoom maps a room to its kept output PVCs
+func (o *OutputReconciler) outputsOfRoom(obj ctrlclient.Object) []reconcile.Request {
+	room, ok := obj.(*hubv1.Room)
+	if !ok || room.Spec.Setting == nil || !keepsOutputs(room) {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0)
+	for _, actor := range room.Spec.Actors {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: naming.OutputPVCName(room, actor.Name), Namespace: room.Namespace},
+		})
+	}
+	return requests
+}
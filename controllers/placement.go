@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// applyPlacement sets scheduling constraints of a pod of the room. Placements are applied
+// in this order, node selectors and tolerations are merged and the last affinity wins:
+// 1. room.Spec.Setting.Placement
+// 2. room.Spec.Setting.Roles[role].Placement
+// 3. room.Spec.Placement
+func applyPlacement(room *hubv1.Room, pod *corev1.Pod) {
+	placements := []*hubv1.Placement{room.Spec.Setting.Placement}
+	if roleSettings, ok := room.Spec.Setting.Roles[pod.Labels[name.RoleLabel()]]; ok && roleSettings != nil {
+		placements = append(placements, roleSettings.Placement)
+	}
+	placements = append(placements, room.Spec.Placement)
+
+	colocate := true
+	for _, placement := range placements {
+		if placement == nil {
+			continue
+		}
+
+		for key, value := range placement.NodeSelector {
+			if pod.Spec.NodeSelector == nil {
+				pod.Spec.NodeSelector = make(map[string]string)
+			}
+			pod.Spec.NodeSelector[key] = value
+		}
+		pod.Spec.Tolerations = append(pod.Spec.Tolerations, placement.Tolerations...)
+		if placement.Affinity != nil {
+			pod.Spec.Affinity = placement.Affinity.DeepCopy()
+		}
+		if placement.DisableColocation {
+			colocate = false
+		}
+	}
+
+	if colocate {
+		colocateRoom(room, pod)
+	}
+}
+
+// colocateRoom makes the scheduler prefer the node of other pods of the room, so traffic
+// to the gimulator stays on one node, and nodes without pods of other rooms or the manager
+func colocateRoom(room *hubv1.Room, pod *corev1.Pod) {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.PodAffinity == nil {
+		pod.Spec.Affinity.PodAffinity = &corev1.PodAffinity{}
+	}
+	if pod.Spec.Affinity.PodAntiAffinity == nil {
+		pod.Spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+
+	podAffinity := pod.Spec.Affinity.PodAffinity
+	podAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(podAffinity.PreferredDuringSchedulingIgnoredDuringExecution, corev1.WeightedPodAffinityTerm{
+		Weight: 100,
+		PodAffinityTerm: corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					name.RoomLabel(): room.Spec.ID,
+				},
+			},
+			TopologyKey: name.HostnameLabel(),
+		},
+	})
+
+	// other rooms and the manager may run in other namespaces
+	podAntiAffinity := pod.Spec.Affinity.PodAntiAffinity
+	podAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(podAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.WeightedPodAffinityTerm{
+			Weight: 50,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{
+							Key:      name.RoomLabel(),
+							Operator: metav1.LabelSelectorOpExists,
+						},
+						{
+							Key:      name.RoomLabel(),
+							Operator: metav1.LabelSelectorOpNotIn,
+							Values:   []string{room.Spec.ID},
+						},
+					},
+				},
+				NamespaceSelector: &metav1.LabelSelector{},
+				TopologyKey:       name.HostnameLabel(),
+			},
+		},
+		corev1.WeightedPodAffinityTerm{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						name.ManagerLabel(): name.ManagerLabelValue(),
+					},
+				},
+				NamespaceSelector: &metav1.LabelSelector{},
+				TopologyKey:       name.HostnameLabel(),
+			},
+		},
+	)
+}
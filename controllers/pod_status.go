@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+var (
+	// DefaultPendingGracePeriod is used when the setting of a problem does not specify PendingGracePeriod
+	DefaultPendingGracePeriod = time.Second * 120
+
+	// startupFailureReasons are waiting reasons of a container which won't be resolved without changing the pod
+	startupFailureReasons = map[string]bool{
+		"ErrImagePull":               true,
+		"ImagePullBackOff":           true,
+		"InvalidImageName":           true,
+		"CreateContainerConfigError": true,
+	}
+)
+
+// pendingGracePeriod returns how long a pod of the room may stay pending on a startup failure
+func pendingGracePeriod(room *hubv1.Room) time.Duration {
+	if room.Spec.Setting == nil || room.Spec.Setting.PendingGracePeriod == 0 {
+		return DefaultPendingGracePeriod
+	}
+	return time.Duration(room.Spec.Setting.PendingGracePeriod) * time.Second
+}
+
+// podPhase returns the phase of a pod, treating a pod which is stuck in Pending
+// for longer than the grace period as Failed. The second return value is the
+// reason of the failure and is empty if the pod is not stuck.
+func podPhase(room *hubv1.Room, pod *corev1.Pod) (corev1.PodPhase, string) {
+	phase := pod.Status.DeepCopy().Phase
+	if phase == corev1.PodRunning {
+		return mainContainerPhase(pod), ""
+	}
+	if phase != corev1.PodPending {
+		return phase, ""
+	}
+
+	if gracePeriodLeft(room, pod) > 0 {
+		return phase, ""
+	}
+
+	if reason := podStartupFailure(pod); reason != "" {
+		return corev1.PodFailed, reason
+	}
+	return phase, ""
+}
+
+// gracePeriodLeft returns how long a pending pod may still wait on a startup failure
+// before podPhase considers it failed, zero if it is not pending or its grace period is over
+func gracePeriodLeft(room *hubv1.Room, pod *corev1.Pod) time.Duration {
+	if pod.Status.Phase != corev1.PodPending {
+		return 0
+	}
+	if left := pendingGracePeriod(room) - time.Since(pod.CreationTimestamp.Time); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// nextGracePeriodEnd returns the time until the grace period of the first pending pod is over, zero if no pod is
+// pending. A pod stuck on a startup failure may not change again, so nothing else would reconcile its room then.
+func nextGracePeriodEnd(room *hubv1.Room, pods []corev1.Pod) time.Duration {
+	var next time.Duration
+	for i := range pods {
+		if left := gracePeriodLeft(room, &pods[i]); left > 0 && (next == 0 || left < next) {
+			next = left
+		}
+	}
+	return next
+}
+
+// mainContainerPhase returns the phase of a running pod by its first container,
+// since sidecars keep the pod running after the main container has exited
+func mainContainerPhase(pod *corev1.Pod) corev1.PodPhase {
+	if len(pod.Spec.Containers) < 2 {
+		return corev1.PodRunning
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != pod.Spec.Containers[0].Name || status.State.Terminated == nil {
+			continue
+		}
+		if status.State.Terminated.ExitCode == 0 {
+			return corev1.PodSucceeded
+		}
+		return corev1.PodFailed
+	}
+	return corev1.PodRunning
+}
+
+// podStartupFailure looks for container waiting reasons and scheduling conditions
+// that keep a pod pending and returns a human readable description of the first one found
+func podStartupFailure(pod *corev1.Pod) string {
+	statuses := make([]corev1.ContainerStatus, 0)
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		waiting := status.State.Waiting
+		if waiting == nil || !startupFailureReasons[waiting.Reason] {
+			continue
+		}
+		return fmt.Sprintf("container %s of pod %s is waiting: %s: %s", status.Name, pod.Name, waiting.Reason, waiting.Message)
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return fmt.Sprintf("pod %s could not be scheduled: %s: %s", pod.Name, condition.Reason, condition.Message)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+// pendingPod returns a pod created age ago which is pending with the given container statuses and conditions
+func pendingPod(age time.Duration, statuses []corev1.ContainerStatus, conditions ...corev1.PodCondition) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "actor-1", CreationTimestamp: metav1.NewTime(time.Now().Add(-age))},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "actor"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodPending, ContainerStatuses: statuses, Conditions: conditions},
+	}
+}
+
+func waiting(container, reason string) []corev1.ContainerStatus {
+	return []corev1.ContainerStatus{{
+		Name:  container,
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "details"}},
+	}}
+}
+
+func TestPodPhase(t *testing.T) {
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{Setting: &hubv1.Setting{PendingGracePeriod: 60}}}
+	unschedulable := corev1.PodCondition{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: "0/3 nodes are available"}
+
+	tests := []struct {
+		name   string
+		pod    *corev1.Pod
+		phase  corev1.PodPhase
+		reason string
+	}{
+		{name: "image pull failure within the grace period", pod: pendingPod(59*time.Second, waiting("actor", "ImagePullBackOff")), phase: corev1.PodPending},
+		{name: "image pull failure after the grace period", pod: pendingPod(61*time.Second, waiting("actor", "ImagePullBackOff")), phase: corev1.PodFailed, reason: "ImagePullBackOff"},
+		{name: "ErrImagePull", pod: pendingPod(time.Hour, waiting("actor", "ErrImagePull")), phase: corev1.PodFailed, reason: "ErrImagePull"},
+		{name: "InvalidImageName", pod: pendingPod(time.Hour, waiting("actor", "InvalidImageName")), phase: corev1.PodFailed, reason: "InvalidImageName"},
+		{name: "CreateContainerConfigError", pod: pendingPod(time.Hour, waiting("actor", "CreateContainerConfigError")), phase: corev1.PodFailed, reason: "CreateContainerConfigError"},
+		{name: "ContainerCreating is not a failure", pod: pendingPod(time.Hour, waiting("actor", "ContainerCreating")), phase: corev1.PodPending},
+		{name: "unschedulable within the grace period", pod: pendingPod(time.Second, nil, unschedulable), phase: corev1.PodPending},
+		{name: "unschedulable after the grace period", pod: pendingPod(time.Hour, nil, unschedulable), phase: corev1.PodFailed, reason: "could not be scheduled: Unschedulable"},
+		{name: "pending without a failure", pod: pendingPod(time.Hour, nil), phase: corev1.PodPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phase, reason := podPhase(room, tt.pod)
+			if phase != tt.phase {
+				t.Errorf("podPhase() phase = %s, want %s", phase, tt.phase)
+			}
+			if tt.reason == "" && reason != "" {
+				t.Errorf("podPhase() reason = %q, want none", reason)
+			}
+			if tt.reason != "" && !strings.Contains(reason, tt.reason) {
+				t.Errorf("podPhase() reason = %q, want it to contain %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestPodStartupFailureInitContainer(t *testing.T) {
+	pod := pendingPod(time.Hour, nil)
+	pod.Status.InitContainerStatuses = waiting("weights", "ErrImagePull")
+
+	if reason := podStartupFailure(pod); !strings.Contains(reason, "container weights") {
+		t.Errorf("podStartupFailure() = %q, want the failing init container", reason)
+	}
+}
+
+func TestMainContainerPhase(t *testing.T) {
+	terminated := func(container string, exitCode int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name:  container,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode}},
+		}
+	}
+	running := corev1.ContainerStatus{Name: "meter", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+
+	tests := []struct {
+		name       string
+		containers []string
+		statuses   []corev1.ContainerStatus
+		want       corev1.PodPhase
+	}{
+		{name: "no sidecars", containers: []string{"actor"}, statuses: []corev1.ContainerStatus{terminated("actor", 1)}, want: corev1.PodRunning},
+		{name: "main container running", containers: []string{"actor", "meter"}, statuses: []corev1.ContainerStatus{running}, want: corev1.PodRunning},
+		{name: "main container succeeded", containers: []string{"actor", "meter"}, statuses: []corev1.ContainerStatus{terminated("actor", 0), running}, want: corev1.PodSucceeded},
+		{name: "main container failed", containers: []string{"actor", "meter"}, statuses: []corev1.ContainerStatus{running, terminated("actor", 2)}, want: corev1.PodFailed},
+		{name: "sidecar exited", containers: []string{"actor", "meter"}, statuses: []corev1.ContainerStatus{terminated("meter", 1)}, want: corev1.PodRunning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: tt.statuses}}
+			for _, container := range tt.containers {
+				pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+			}
+
+			if got := mainContainerPhase(pod); got != tt.want {
+				t.Errorf("mainContainerPhase() = %s, want %s", got, tt.want)
+			}
+			if got, _ := podPhase(&hubv1.Room{}, pod); got != tt.want {
+				t.Errorf("podPhase() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextGracePeriodEnd(t *testing.T) {
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{Setting: &hubv1.Setting{PendingGracePeriod: 60}}}
+	running := *pendingPod(time.Second, nil)
+	running.Status.Phase = corev1.PodRunning
+
+	if next := nextGracePeriodEnd(room, []corev1.Pod{running, *pendingPod(time.Hour, nil)}); next != 0 {
+		t.Errorf("nextGracePeriodEnd() = %v, want zero without pods in their grace period", next)
+	}
+
+	next := nextGracePeriodEnd(room, []corev1.Pod{*pendingPod(10*time.Second, nil), *pendingPod(40*time.Second, nil), running})
+	if next <= 19*time.Second || next > 20*time.Second {
+		t.Errorf("nextGracePeriodEnd() = %v, want the 20s left to the oldest pending pod", next)
+	}
+}
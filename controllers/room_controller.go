@@ -18,29 +18,38 @@ package controllers
 
 import (
 	"context"
-	"time"
+	"fmt"
 
 	"github.com/go-logr/logr"
 	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlbuilder "sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	hubv1 "github.com/Gimulator/hub/api/v1"
 	"github.com/Gimulator/hub/pkg/client"
 	"github.com/Gimulator/hub/pkg/config"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/metrics"
+	"github.com/Gimulator/hub/pkg/name"
 	"github.com/Gimulator/hub/pkg/reporter"
+	"github.com/Gimulator/hub/pkg/sharding"
 	"github.com/Gimulator/hub/pkg/timer"
-)
-
-var (
-	ReconcilationTimeout = time.Second * 20
+	"github.com/Gimulator/hub/pkg/tracing"
 )
 
 // RoomReconciler reconciles a Room object
@@ -49,46 +58,87 @@ type RoomReconciler struct {
 	*actorReconciler
 	*gimulatorReconciler
 	*directorReconciler
+	*namespaceReconciler
+	*networkReconciler
+	*imageReconciler
+	*submissionReconciler
+	*datasetReconciler
 
 	Log       logr.Logger
 	Scheme    *runtime.Scheme
 	clientSet *kubernetes.Clientset
 	reporter  *reporter.Reporter
 	timer     *timer.Timer
+	recorder  *eventRecorder
+	config    *hubconfig.Config
 }
 
 // NewRoomReconciler returns new instance of RoomReconciler
-func NewRoomReconciler(mgr manager.Manager, log logr.Logger, reporter *reporter.Reporter, client *client.Client, clientSet *kubernetes.Clientset) (*RoomReconciler, error) {
-	gimulatorReconciler, err := newGimulatorReconciler(client, log)
+func NewRoomReconciler(mgr manager.Manager, log logr.Logger, reporter *reporter.Reporter, client *client.Client, clientSet *kubernetes.Clientset, config *hubconfig.Config) (*RoomReconciler, error) {
+	gimulatorReconciler, err := newGimulatorReconciler(client, log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	directorReconciler, err := newDirectorReconciler(client, log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	actorReconciler, err := newActorReconciler(client, log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceReconciler, err := newNamespaceReconciler(client, log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	networkReconciler, err := newNetworkReconciler(client, log, config)
 	if err != nil {
 		return nil, err
 	}
 
-	directorReconciler, err := newDirectorReconciler(client, log)
+	imageReconciler, err := newImageReconciler(client, log, config)
 	if err != nil {
 		return nil, err
 	}
 
-	actorReconciler, err := newActorReconciler(client, log)
+	submissionReconciler, err := newSubmissionReconciler(client, log, config)
 	if err != nil {
 		return nil, err
 	}
 
-	roomTimer, err := timer.NewTimer(clientSet, ctrl.Log.WithName("timer"), reporter, client)
+	datasetReconciler, err := newDatasetReconciler(client, log, config)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := newEventRecorder(mgr.GetEventRecorderFor("room-controller"))
+
+	roomTimer, err := timer.NewTimer(ctrl.Log.WithName("timer"), reporter, client, recorder)
 	if err != nil {
 		return nil, err
 	}
 
 	return &RoomReconciler{
-		Log:                 log,
-		Scheme:              mgr.GetScheme(),
-		Client:              client,
-		clientSet:           clientSet,
-		actorReconciler:     actorReconciler,
-		gimulatorReconciler: gimulatorReconciler,
-		directorReconciler:  directorReconciler,
-		reporter:            reporter,
-		timer:               roomTimer,
+		Log:                  log,
+		Scheme:               mgr.GetScheme(),
+		Client:               client,
+		clientSet:            clientSet,
+		actorReconciler:      actorReconciler,
+		gimulatorReconciler:  gimulatorReconciler,
+		directorReconciler:   directorReconciler,
+		namespaceReconciler:  namespaceReconciler,
+		networkReconciler:    networkReconciler,
+		imageReconciler:      imageReconciler,
+		submissionReconciler: submissionReconciler,
+		datasetReconciler:    datasetReconciler,
+		reporter:             reporter,
+		timer:                roomTimer,
+		recorder:             recorder,
+		config:               config,
 	}, nil
 }
 
@@ -101,25 +151,80 @@ func NewRoomReconciler(mgr manager.Manager, log logr.Logger, reporter *reporter.
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=resourcequotas,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=core,resources=limitranges,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;create;update
 
-// Reconcile reconciles a request for a Room object
-func (r *RoomReconciler) Reconcile(_ context.Context, req ctrl.Request) (ctrl.Result, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), ReconcilationTimeout)
+// Reconcile reconciles a request for a Room object. Reconciles failing with a transient error are retried
+// after the backoff of the rate limiter of the work queue, see newRateLimiter. Retrying can not fix other
+// errors, so they are logged and dropped: errors which will never let the room finish are turned into
+// reasons the room is rejected with by reconcile.
+func (r *RoomReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Runtime().ReconcileTimeout.Duration)
 	defer cancel()
 
-	logger := r.Log.WithValues("reconciler", "Room", "room", req.NamespacedName)
+	ctx = logging.WithReconcileID(ctx)
+	logger := logging.Logger(ctx, r.Log).WithValues("reconciler", "Room", "room", req.NamespacedName)
+
+	result, err := r.reconcile(ctx, req)
+	if err == nil {
+		return result, nil
+	}
+	if isTransient(err) {
+		logger.Info("reconcile failed with a transient error, starting to back off", "error", err.Error())
+		return result, err
+	}
+	logger.Error(err, "reconcile failed with a permanent error, dropping the request")
+	return ctrl.Result{}, nil
+}
+
+func (r *RoomReconciler) reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "RoomReconciler.Reconcile", attribute.String("request", req.String()))
+	defer tracing.End(span, &err)
+
+	logger := logging.Logger(ctx, r.Log).WithValues("reconciler", "Room", "room", req.NamespacedName)
 	logger.Info("starting to reconcile room")
 
 	room, err := r.GetRoom(ctx, req.NamespacedName)
 	if errors.IsNotFound(err) {
 		logger.Info("room does not exist")
+		r.recorder.forget(req.NamespacedName)
 		return ctrl.Result{}, nil
 	} else if err != nil {
 		logger.Error(err, "could not get room object")
 		return ctrl.Result{}, err
 	}
 
+	if watched, err := watchesNamespace(ctx, r.Client, r.config.Hub(), room.Namespace); err != nil {
+		logger.Error(err, "could not check namespace of room")
+		return ctrl.Result{}, err
+	} else if !watched {
+		logger.Info("room is not in a watched namespace")
+		return ctrl.Result{}, nil
+	}
+
+	if !sharding.Owns(r.config.Hub().Sharding, room.Spec.ID) {
+		logger.V(1).Info("room belongs to another shard")
+		return ctrl.Result{}, nil
+	}
+
+	span.SetAttributes(attribute.String("room", room.Spec.ID))
+	ctx = logging.WithRoom(ctx, room)
+	logger = logging.Logger(ctx, r.Log).WithValues("reconciler", "Room", "room", req.NamespacedName)
+
+	if !room.DeletionTimestamp.IsZero() {
+		logger.Info("starting to finalize room")
+		if err := r.finalizeNamespace(ctx, room); err != nil {
+			logger.Error(err, "could not finalize room")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// tokens should be generated one time in the life-cycle of a room,
 	// so we update room with generated tokens and then for next call of reconcile,
 	// we will do nothing
@@ -141,13 +246,99 @@ func (r *RoomReconciler) Reconcile(_ context.Context, req ctrl.Request) (ctrl.Re
 			logger.Error(err, "could not update room after generating tokens")
 			return ctrl.Result{}, err
 		}
+		metrics.RoomCreated(room)
+	}
+
+	logger.Info("starting to find naming of room")
+	if err := r.reconcileNaming(ctx, room); err != nil {
+		logger.Error(err, "could not find naming of room")
+		return ctrl.Result{}, err
 	}
 
 	logger.Info("starting to fetch setting")
-	if err := config.FetchSetting(ctx, room); err != nil {
+	fetched := room.Spec.Setting == nil
+	stepCtx, cancel := withStepTimeout(ctx, r.config.Runtime().StepTimeout.Duration)
+	err = config.FetchSetting(stepCtx, room, r.config.BucketPrefix(room.Namespace))
+	cancel()
+	if err != nil {
 		logger.Error(err, "could not fetch setting", "problem", room.Spec.ProblemID)
 		return ctrl.Result{}, err
 	}
+	if fetched {
+		r.recorder.event(room, corev1.EventTypeNormal, EventSettingFetched, "", fmt.Sprintf("Setting of problem %s was fetched", room.Spec.ProblemID))
+	}
+
+	if r.config.Hub().Local != nil {
+		if reason := localModeReason(room); reason != "" {
+			return r.reject(ctx, room, reason)
+		}
+	}
+
+	logger.Info("starting to reconcile namespace")
+	if reason, err := r.reconcileNamespace(ctx, room); err != nil {
+		logger.Error(err, "could not reconcile namespace")
+		return ctrl.Result{}, err
+	} else if reason != "" {
+		return r.reject(ctx, room, reason)
+	}
+
+	logger.Info("starting to reconcile network policies")
+	if err := r.reconcileNetwork(ctx, room); err != nil {
+		logger.Error(err, "could not reconcile network policies")
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("starting to reconcile datasets")
+	if ready, reason, err := r.reconcileDatasets(ctx, room); err != nil {
+		logger.Error(err, "could not reconcile datasets")
+		return ctrl.Result{}, err
+	} else if reason != "" {
+		return r.reject(ctx, room, reason)
+	} else if !ready {
+		// populator pods are not owned by the room, so the room polls them
+		logger.Info("starting to sync room while datasets are being populated")
+		if _, err := r.SyncRoom(ctx, room); err != nil {
+			logger.Error(err, "could not sync room")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: DatasetPollInterval}, nil
+	}
+
+	logger.Info("starting to reconcile submissions")
+	stepCtx, cancel = withStepTimeout(ctx, r.config.Runtime().StepTimeout.Duration)
+	ready, reason, err := r.reconcileSubmissions(stepCtx, room)
+	cancel()
+	if err != nil {
+		logger.Error(err, "could not reconcile submissions")
+		return ctrl.Result{}, err
+	} else if reason != "" {
+		return r.reject(ctx, room, reason)
+	} else if !ready {
+		// pods of the room wait for the builds, which trigger a reconcile when they finish
+		logger.Info("starting to sync room while submissions are being built")
+		if _, err := r.SyncRoom(ctx, room); err != nil {
+			logger.Error(err, "could not sync room")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("starting to reconcile images")
+	stepCtx, cancel = withStepTimeout(ctx, r.config.Runtime().StepTimeout.Duration)
+	reason, err = r.reconcileImages(stepCtx, room)
+	cancel()
+	if err != nil {
+		logger.Error(err, "could not reconcile images")
+		return ctrl.Result{}, err
+	} else if reason != "" {
+		return r.reject(ctx, room, reason)
+	}
+
+	logger.Info("starting to find warm nodes")
+	if err := r.reconcileWarmNodes(ctx, room); err != nil {
+		logger.Error(err, "could not find warm nodes")
+		return ctrl.Result{}, err
+	}
 
 	logger.Info("starting to checkup needed PVCs")
 	if err := r.checkPVCs(ctx, room); err != nil {
@@ -156,27 +347,45 @@ func (r *RoomReconciler) Reconcile(_ context.Context, req ctrl.Request) (ctrl.Re
 	}
 
 	logger.Info("starting to reconcile Gimulator")
-	if err := r.reconcileGimulator(ctx, room); err != nil {
+	stepCtx, cancel = withStepTimeout(ctx, r.config.Runtime().StepTimeout.Duration)
+	err = r.reconcileGimulator(stepCtx, room)
+	cancel()
+	if err != nil {
 		logger.Error(err, "could not reconcile gimulator")
 		return ctrl.Result{}, err
 	}
 
 	logger.Info("starting to reconcile director")
-	if err := r.reconcileDirector(ctx, room); err != nil {
+	if reason, err := r.reconcileDirector(ctx, room); err != nil {
 		logger.Error(err, "could not reconcile director")
 		return ctrl.Result{}, err
+	} else if reason != "" {
+		return r.reject(ctx, room, reason)
 	}
 
 	logger.Info("starting to reconcile actors")
 	for _, actor := range room.Spec.Actors {
-		if err := r.reconcileActor(ctx, room, actor); err != nil {
+		if reason, err := r.reconcileActor(ctx, room, actor); err != nil {
 			logger.Error(err, "could not reconcile actor", "actor", actor.Name)
 			return ctrl.Result{}, err
+		} else if reason != "" {
+			return r.reject(ctx, room, reason)
 		}
 	}
 
-	logger.Info("starting to sync timers")
-	r.timer.SyncTimers(room)
+	logger.Info("starting to check timeout")
+	stepCtx, cancel = withStepTimeout(ctx, r.config.Runtime().StepTimeout.Duration)
+	untilTimeout, terminated, err := r.timer.Check(stepCtx, room)
+	cancel()
+	if err != nil {
+		logger.Error(err, "could not check timeout")
+		return ctrl.Result{}, err
+	} else if terminated {
+		return ctrl.Result{}, nil
+	}
+
+	r.recordPodEvents(room)
+	started, running := recordProgress(room)
 
 	logger.Info("starting to sync room")
 	if _, err := r.SyncRoom(ctx, room); err != nil {
@@ -184,21 +393,187 @@ func (r *RoomReconciler) Reconcile(_ context.Context, req ctrl.Request) (ctrl.Re
 		return ctrl.Result{}, err
 	}
 
+	if started {
+		metrics.RoomStarted(room)
+	}
+	if running {
+		metrics.RoomRunning(room)
+	}
+
 	logger.Info("starting to reconcile status and report it")
-	if shouldDelete, err := r.reporter.Report(ctx, room); err != nil {
+	stepCtx, cancel = withStepTimeout(ctx, r.config.Runtime().StepTimeout.Duration)
+	shouldDelete, err := r.reporter.Report(stepCtx, room)
+	cancel()
+	if err != nil {
 		logger.Error(err, "could not report")
 		return ctrl.Result{}, err
 	} else if shouldDelete {
+		if room.Status.GimulatorStatus == corev1.PodSucceeded {
+			r.recorder.event(room, corev1.EventTypeNormal, EventLogsUploaded, "", "Logs of the room were uploaded")
+		} else {
+			r.recorder.event(room, corev1.EventTypeNormal, EventResultPublished, "", "Result of the room was published")
+		}
+
 		if err := r.DeleteRoom(ctx, room); err != nil {
 			logger.Error(err, "could not reconcile statuses")
 			return ctrl.Result{}, err
 		}
+		r.recorder.event(room, corev1.EventTypeNormal, EventRoomDeleted, "", "Room was deleted")
+
+		outcome := metrics.OutcomeFailed
+		if room.Status.GimulatorStatus == corev1.PodSucceeded {
+			outcome = metrics.OutcomeSucceeded
+		}
+		metrics.RoomFinished(room, outcome)
+	}
+
+	logger.Info("starting to check grace periods of pending pods")
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, ctrlclient.InNamespace(room.WorkloadNamespace()), ctrlclient.MatchingLabels{name.RoomLabel(): room.Spec.ID}); err != nil {
+		logger.Error(err, "could not list pods of room")
+		return ctrl.Result{}, err
 	}
+	untilGracePeriodEnd := nextGracePeriodEnd(room, pods.Items)
 
 	logger.Info("end of reconciling")
+	// the timeout is checked again once the first running actor would reach it,
+	// and pending pods once their grace period is over
+	requeueAfter := untilTimeout
+	if untilGracePeriodEnd > 0 && (requeueAfter == 0 || untilGracePeriodEnd < requeueAfter) {
+		requeueAfter = untilGracePeriodEnd
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// reject reports a room which can not be run and deletes it
+func (r *RoomReconciler) reject(ctx context.Context, room *hubv1.Room, reason string) (ctrl.Result, error) {
+	logger := logging.Logger(ctx, r.Log).WithValues("reconciler", "Room")
+
+	logger.Info("room is rejected", "reason", reason)
+	r.recorder.event(room, corev1.EventTypeWarning, EventRejected, "", reason)
+	if err := r.reporter.ReportRejection(ctx, room, reason); err != nil {
+		logger.Error(err, "could not report rejection")
+		return ctrl.Result{}, err
+	}
+	r.recorder.event(room, corev1.EventTypeNormal, EventResultPublished, "", "Result of the room was published")
+
+	if err := r.DeleteRoom(ctx, room); err != nil {
+		logger.Error(err, "could not delete rejected room")
+		return ctrl.Result{}, err
+	}
+	r.recorder.event(room, corev1.EventTypeNormal, EventRoomDeleted, "", "Room was deleted")
+	metrics.RoomFinished(room, metrics.OutcomeRejected)
 	return ctrl.Result{}, nil
 }
 
+// localModeReason returns why room can not run in local mode, where pods can not reach the
+// object store, or an empty string if it can
+func localModeReason(room *hubv1.Room) string {
+	setting := room.Spec.Setting
+	if len(setting.Datasets) > 0 {
+		return "Datasets are not supported in local mode."
+	}
+	if setting.Output != nil && setting.Output.Retention != nil && setting.Output.Retention.Policy == hubv1.OutputRetentionUntilUploaded {
+		return fmt.Sprintf("Output retention policy %s is not supported in local mode.", hubv1.OutputRetentionUntilUploaded)
+	}
+	for _, actor := range room.Spec.Actors {
+		if actor.Source != nil {
+			return fmt.Sprintf("Actor %s has a source, which is not supported in local mode.", actor.Name)
+		}
+	}
+	return ""
+}
+
+// recordPodEvents records the gimulator starting and pods of the room failing
+func (r *RoomReconciler) recordPodEvents(room *hubv1.Room) {
+	switch room.Status.GimulatorStatus {
+	case corev1.PodRunning:
+		r.recorder.event(room, corev1.EventTypeNormal, EventGimulatorStarted, "", "Gimulator is running")
+	case corev1.PodFailed:
+		r.recorder.event(room, corev1.EventTypeWarning, EventGimulatorFailed, "", failureMessage("Gimulator failed", room.Status.GimulatorReason))
+	}
+
+	if room.Status.DirectorStatus == corev1.PodFailed {
+		r.recorder.event(room, corev1.EventTypeWarning, EventDirectorFailed, "", failureMessage("Director failed", room.Status.DirectorReason))
+	}
+
+	for _, actor := range room.Spec.Actors {
+		if room.Status.ActorStatuses[actor.Name] == corev1.PodFailed {
+			message := failureMessage(fmt.Sprintf("Actor %s failed", actor.Name), room.Status.ActorReasons[actor.Name])
+			r.recorder.event(room, corev1.EventTypeWarning, EventActorFailed, actor.Name, message)
+		}
+	}
+}
+
+// failureMessage appends the reason of a failure to its message if it is known
+func failureMessage(message, reason string) string {
+	if reason == "" {
+		return message
+	}
+	return message + ": " + reason
+}
+
+// recordProgress sets the time the room leaves the queue and the time all of its pods are running.
+// It returns which of them were set, so they are observed once the room is synced.
+func recordProgress(room *hubv1.Room) (bool, bool) {
+	now := metav1.Now()
+	started, running := false, false
+
+	if room.Status.StartTime == nil && room.Status.GimulatorStatus == corev1.PodRunning {
+		room.Status.StartTime = &now
+		started = true
+	}
+
+	if room.Status.RunningTime != nil || room.Status.GimulatorStatus != corev1.PodRunning {
+		return started, running
+	}
+	if room.Spec.Director != nil && room.Status.DirectorStatus != corev1.PodRunning {
+		return started, running
+	}
+	for _, actor := range room.Spec.Actors {
+		if room.Status.ActorStatuses[actor.Name] != corev1.PodRunning {
+			return started, running
+		}
+	}
+	room.Status.RunningTime = &now
+	running = true
+	return started, running
+}
+
+// reconcileNaming keeps names of objects of rooms which were started before names were scoped
+// by the room ID, so their pods are not created again under new names. Rooms which already
+// have a naming keep it, new rooms get RoomNamingHashed.
+func (r *RoomReconciler) reconcileNaming(ctx context.Context, room *hubv1.Room) error {
+	if room.Status.Naming != "" {
+		return nil
+	}
+
+	legacyPodNames := make([]string, 0, len(room.Spec.Actors)+1)
+	if room.Spec.Director != nil {
+		legacyPodNames = append(legacyPodNames, name.LegacyDirectorPodName(room.Spec.Director.Name))
+	}
+	for _, actor := range room.Spec.Actors {
+		legacyPodNames = append(legacyPodNames, name.LegacyActorPodName(actor.Name))
+	}
+
+	room.Status.Naming = hubv1.RoomNamingHashed
+	for _, podName := range legacyPodNames {
+		pod, err := r.GetPod(ctx, types.NamespacedName{Name: podName, Namespace: room.WorkloadNamespace()})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// a pod of another room with the same participant does not make this room legacy
+		if pod.Labels[name.RoomLabel()] == room.Spec.ID {
+			room.Status.Naming = hubv1.RoomNamingLegacy
+			return nil
+		}
+	}
+	return nil
+}
+
 func (r *RoomReconciler) generateTokens(room *hubv1.Room) (bool, error) {
 	flag := false
 
@@ -217,30 +592,17 @@ func (r *RoomReconciler) generateTokens(room *hubv1.Room) (bool, error) {
 	return flag, nil
 }
 
-func (r *RoomReconciler) checkPVCs(ctx context.Context, room *hubv1.Room) error {
-	if room.Spec.Setting.DataPVCNames == nil {
-		return nil
-	}
-	if room.Spec.Setting.DataPVCNames.Public != nil {
-		for _, pvcName := range room.Spec.Setting.DataPVCNames.Public {
-			key := types.NamespacedName{
-				Name:      pvcName,
-				Namespace: room.Namespace,
-			}
-			if _, err := r.GetPVC(ctx, key); err != nil {
-				return err
-			}
+func (r *RoomReconciler) checkPVCs(ctx context.Context, room *hubv1.Room) (err error) {
+	ctx, span := tracing.Start(ctx, "RoomReconciler.checkPVCs", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	for _, pvcName := range roomPVCNames(room) {
+		key := types.NamespacedName{
+			Name:      pvcName,
+			Namespace: room.WorkloadNamespace(),
 		}
-	}
-	if room.Spec.Setting.DataPVCNames.Private != nil {
-		for _, pvcName := range room.Spec.Setting.DataPVCNames.Private {
-			key := types.NamespacedName{
-				Name:      pvcName,
-				Namespace: room.Namespace,
-			}
-			if _, err := r.GetPVC(ctx, key); err != nil {
-				return err
-			}
+		if _, err := r.GetPVC(ctx, key); err != nil {
+			return err
 		}
 	}
 
@@ -258,14 +620,109 @@ func (r *RoomReconciler) checkPVCs(ctx context.Context, room *hubv1.Room) error
 }
 
 func (r *RoomReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// every event of a pod in an ephemeral namespace looks up the room of the namespace
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &hubv1.Room{}, roomNamespaceIndex, func(obj ctrlclient.Object) []string {
+		room, ok := obj.(*hubv1.Room)
+		if !ok || room.Status.Namespace == "" || room.Status.Namespace == room.Namespace {
+			return nil
+		}
+		return []string{room.Status.Namespace}
+	}); err != nil {
+		return err
+	}
+
+	if err := metrics.RegisterRoomCollector(r.ownedRooms); err != nil {
+		return err
+	}
+
 	builder := ctrl.NewControllerManagedBy(mgr)
 	builder = builder.For(&hubv1.Room{})
+	builder = builder.WithOptions(controller.Options{
+		RateLimiter: newRateLimiter(r.config.Hub().RateLimiter),
+	})
 	builder = builder.Watches(
 		&source.Kind{Type: &corev1.Pod{}},
 		&handler.EnqueueRequestForOwner{
 			OwnerType: &hubv1.Room{},
 		},
 	)
+	// pods of rooms running in their own namespace can not be owned by the room
+	builder = builder.Watches(
+		&source.Kind{Type: &corev1.Pod{}},
+		handler.EnqueueRequestsFromMapFunc(r.roomsOfNamespace),
+	)
+	// warm nodes of queued rooms are refreshed when the warmer updates the image cache
+	builder = builder.Watches(
+		&source.Kind{Type: &corev1.ConfigMap{}},
+		handler.EnqueueRequestsFromMapFunc(r.queuedRooms),
+		ctrlbuilder.WithPredicates(predicate.NewPredicateFuncs(func(obj ctrlclient.Object) bool {
+			return obj.GetName() == name.ImageCacheConfigMapName() && obj.GetNamespace() == r.config.Hub().Namespace
+		})),
+	)
 
 	return builder.Complete(r)
 }
+
+// queuedRooms maps an object to the rooms whose pods have not started yet
+func (r *RoomReconciler) queuedRooms(_ ctrlclient.Object) []reconcile.Request {
+	rooms := &hubv1.RoomList{}
+	if err := r.List(context.Background(), rooms); err != nil {
+		r.Log.Error(err, "could not list rooms")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0)
+	for i := range rooms.Items {
+		if isQueued(&rooms.Items[i]) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: rooms.Items[i].Name, Namespace: rooms.Items[i].Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// ownedRooms returns the rooms of the watched namespaces which belong to the shard of this replica
+func (r *RoomReconciler) ownedRooms(ctx context.Context) ([]hubv1.Room, error) {
+	rooms := &hubv1.RoomList{}
+	if err := r.List(ctx, rooms); err != nil {
+		return nil, err
+	}
+
+	namespaces := make(map[string]bool)
+	owned := make([]hubv1.Room, 0, len(rooms.Items))
+	for _, room := range rooms.Items {
+		watched, checked := namespaces[room.Namespace]
+		if !checked {
+			var err error
+			if watched, err = watchesNamespace(ctx, r.Client, r.config.Hub(), room.Namespace); err != nil {
+				return nil, err
+			}
+			namespaces[room.Namespace] = watched
+		}
+		if watched && sharding.Owns(r.config.Hub().Sharding, room.Spec.ID) {
+			owned = append(owned, room)
+		}
+	}
+	return owned, nil
+}
+
+// roomNamespaceIndex indexes rooms by their ephemeral namespace
+const roomNamespaceIndex = "status.namespace"
+
+// roomsOfNamespace maps an object to the room whose ephemeral namespace contains it
+func (r *RoomReconciler) roomsOfNamespace(obj ctrlclient.Object) []reconcile.Request {
+	rooms := &hubv1.RoomList{}
+	if err := r.List(context.Background(), rooms, ctrlclient.MatchingFields{roomNamespaceIndex: obj.GetNamespace()}); err != nil {
+		r.Log.Error(err, "could not list rooms")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(rooms.Items))
+	for _, room := range rooms.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: room.Name, Namespace: room.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+)
+
+// failingClient fails every Get with err
+type failingClient struct {
+	ctrlclient.Client
+	err error
+}
+
+func (f failingClient) Get(context.Context, ctrlclient.ObjectKey, ctrlclient.Object) error {
+	return f.err
+}
+
+func TestReconcileOutcome(t *testing.T) {
+	rooms := schema.GroupResource{Group: "hub.roboepics.com", Resource: "rooms"}
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "transient error backs off", err: errors.NewServiceUnavailable("down"), wantErr: true},
+		{name: "wrapped transient error backs off", err: fmt.Errorf("could not get room: %w", context.DeadlineExceeded), wantErr: true},
+		{name: "permanent error is dropped", err: errors.NewForbidden(rooms, "room-1", fmt.Errorf("denied")), wantErr: false},
+		{name: "plain error is dropped", err: fmt.Errorf("unknown template"), wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeClient(t)
+			c, err := client.NewClient(failingClient{Client: fake.Client, err: tt.err}, fake.Scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &RoomReconciler{Client: c, Log: logr.Discard(), config: hubconfig.New(hubconfig.Default())}
+
+			result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "hub-system", Name: "room-1"}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Reconcile() returned error %v, want error: %v", err, tt.wantErr)
+			}
+			if result != (ctrl.Result{}) {
+				t.Errorf("Reconcile() = %v, want no requeue", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// applySandbox restricts a pod running contestant code according to the sandbox settings of the room.
+// Contestant code runs as userID.
+func applySandbox(room *hubv1.Room, pod *corev1.Pod, userID int64) {
+	sandbox := &hubv1.SandboxSettings{Profile: hubv1.SandboxProfileDefault}
+	if room.Spec.Setting.Sandbox != nil {
+		sandbox = room.Spec.Setting.Sandbox
+	}
+
+	runAsNonRoot := true
+	fsGroupChangePolicy := corev1.FSGroupChangeOnRootMismatch
+
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{
+		RunAsUser:           &userID,
+		RunAsGroup:          &userID,
+		RunAsNonRoot:        &runAsNonRoot,
+		FSGroup:             &userID,
+		FSGroupChangePolicy: &fsGroupChangePolicy,
+	}
+	if sandbox.RuntimeClassName != nil {
+		runtimeClassName := *sandbox.RuntimeClassName
+		pod.Spec.RuntimeClassName = &runtimeClassName
+	}
+
+	var containerContext *corev1.SecurityContext
+	var automountToken *bool
+	mountTmp := false
+
+	switch sandbox.Profile {
+	case hubv1.SandboxProfileCustom:
+		containerContext = &corev1.SecurityContext{
+			ReadOnlyRootFilesystem:   sandbox.ReadOnlyRootFilesystem,
+			AllowPrivilegeEscalation: sandbox.AllowPrivilegeEscalation,
+			SeccompProfile:           sandbox.SeccompProfile.DeepCopy(),
+		}
+		if len(sandbox.DropCapabilities) > 0 {
+			containerContext.Capabilities = &corev1.Capabilities{
+				Drop: append([]corev1.Capability{}, sandbox.DropCapabilities...),
+			}
+		}
+		automountToken = sandbox.AutomountServiceAccountToken
+		mountTmp = sandbox.ReadOnlyRootFilesystem != nil && *sandbox.ReadOnlyRootFilesystem
+	case hubv1.SandboxProfileStrict:
+		containerContext = restrictedSecurityContext()
+		readOnly := true
+		containerContext.ReadOnlyRootFilesystem = &readOnly
+		automountToken = new(bool)
+		mountTmp = true
+	default:
+		containerContext = restrictedSecurityContext()
+		automountToken = new(bool)
+	}
+
+	pod.Spec.AutomountServiceAccountToken = automountToken
+
+	// A read-only root filesystem leaves most programs without a place for temporary files
+	if mountTmp {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: name.TmpVolumeName(),
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			container := &containers[i]
+			container.SecurityContext = containerContext.DeepCopy()
+			if mountTmp {
+				container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+					Name:      name.TmpVolumeName(),
+					MountPath: name.TmpVolumeMountPath(),
+				})
+			}
+		}
+	}
+}
+
+// restrictedSecurityContext returns the container security context shared by the default and strict profiles
+func restrictedSecurityContext() *corev1.SecurityContext {
+	allowPrivilegeEscalation := false
+
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// applyBuilderSandbox restricts a pod fetching or building contestant code. Kaniko runs the RUN steps of the
+// Dockerfile as root, so the builder keeps only the capabilities of unpacking images and runs in the
+// runtime class of the room. The other containers run as userID.
+func applyBuilderSandbox(room *hubv1.Room, pod *corev1.Pod, userID int64) {
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{
+		RunAsUser:  &userID,
+		RunAsGroup: &userID,
+		FSGroup:    &userID,
+	}
+	if sandbox := room.Spec.Setting.Sandbox; sandbox != nil && sandbox.RuntimeClassName != nil {
+		runtimeClassName := *sandbox.RuntimeClassName
+		pod.Spec.RuntimeClassName = &runtimeClassName
+	}
+	pod.Spec.AutomountServiceAccountToken = new(bool)
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			container := &containers[i]
+			if container.Name == name.BuilderContainerName() {
+				container.SecurityContext = builderSecurityContext()
+				continue
+			}
+			runAsNonRoot := true
+			container.SecurityContext = restrictedSecurityContext()
+			container.SecurityContext.RunAsNonRoot = &runAsNonRoot
+		}
+	}
+}
+
+// builderSecurityContext returns the security context of kaniko, which needs root to build images
+func builderSecurityContext() *corev1.SecurityContext {
+	root := int64(0)
+	runAsNonRoot := false
+
+	context := restrictedSecurityContext()
+	context.RunAsUser = &root
+	context.RunAsGroup = &root
+	context.RunAsNonRoot = &runAsNonRoot
+	context.Capabilities.Add = []corev1.Capability{"CHOWN", "DAC_OVERRIDE", "FOWNER", "SETGID", "SETUID"}
+	return context
+}
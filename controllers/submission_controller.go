@@ -0,0 +1,539 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/image"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/naming"
+	"github.com/Gimulator/hub/pkg/s3"
+	"github.com/Gimulator/hub/pkg/tracing"
+)
+
+var (
+	// SourceURLExpiry is how long the URL of the source code of a submission is valid
+	SourceURLExpiry = time.Hour * 24
+
+	// BuildTimeout is the maximum time an image of a submission may take to build
+	BuildTimeout = time.Minute * 15
+)
+
+// submissionReconciler builds or mounts source code of actors of a Room
+type submissionReconciler struct {
+	*client.Client
+	Log      logr.Logger
+	resolver *image.Resolver
+	config   *hubconfig.Config
+}
+
+// newSubmissionReconciler returns new instance of submissionReconciler
+func newSubmissionReconciler(client *client.Client, log logr.Logger, config *hubconfig.Config) (*submissionReconciler, error) {
+	return &submissionReconciler{
+		config:   config,
+		Log:      log,
+		Client:   client,
+		resolver: image.NewResolver(),
+	}, nil
+}
+
+// reconcileSubmissions sets images of actors with source code. Images built in the cluster are
+// cached by the digest of the source code and the template. It returns true once every actor has
+// an image, and a reason if the room should be rejected because a submission can not be run.
+func (s *submissionReconciler) reconcileSubmissions(ctx context.Context, room *hubv1.Room) (_ bool, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "submissionReconciler.reconcileSubmissions", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	if reason := isolationReason(room, s.config); reason != "" {
+		return false, reason, nil
+	}
+
+	ready := true
+
+	for _, actor := range room.Spec.Actors {
+		if actor.Source == nil || actor.Image != "" {
+			continue
+		}
+
+		logger := logging.Logger(ctx, s.Log).WithValues("reconciler", "Submission", "actor", actor.Name)
+
+		template, ok := room.Spec.Setting.Templates[actor.Source.Template]
+		if !ok || template == nil {
+			return false, fmt.Sprintf("Actor %s uses unknown template %q.", actor.Name, actor.Source.Template), nil
+		}
+		if !strings.HasPrefix(actor.Source.Digest, "sha256:") {
+			return false, fmt.Sprintf("Digest of source code of actor %s should be a sha256 digest.", actor.Name), nil
+		}
+
+		switch template.Mode {
+		case hubv1.SubmissionModeInterpret:
+			logger.Info("starting to fetch source code of actor")
+			fetched, reason, err := s.fetch(ctx, room, actor, naming.ActorPodName(room, actor.Name), "")
+			if err != nil || reason != "" {
+				return false, reason, err
+			}
+			if !fetched {
+				ready = false
+				continue
+			}
+			actor.Image = template.Image
+		case hubv1.SubmissionModeBuild:
+			if template.Dockerfile == "" {
+				return false, fmt.Sprintf("Template %q builds images without a Dockerfile.", actor.Source.Template), nil
+			}
+			logger.Info("starting to build image of actor")
+			built, reason, err := s.build(ctx, room, actor, template)
+			if err != nil || reason != "" {
+				return false, reason, err
+			}
+			if !built {
+				ready = false
+			}
+		default:
+			return false, fmt.Sprintf("Template %q has unknown mode %q.", actor.Source.Template, template.Mode), nil
+		}
+	}
+
+	return ready, "", nil
+}
+
+// build sets the image of the actor once it is built, or found in the repository from an earlier build
+func (s *submissionReconciler) build(ctx context.Context, room *hubv1.Room, actor *hubv1.Actor, template *hubv1.RuntimeTemplate) (bool, string, error) {
+	destination := template.Repository + ":" + buildTag(actor.Source, template)
+	podName := naming.BuildPodName(room, actor.Name)
+
+	// the repository is looked up before the build starts, a running build is not interrupted
+	_, err := s.GetPod(ctx, types.NamespacedName{Name: podName, Namespace: room.WorkloadNamespace()})
+	if errors.IsNotFound(err) {
+		keychain, err := s.pushKeychain(ctx, room, template)
+		if err != nil {
+			return false, "", err
+		}
+
+		if resolved, err := s.resolver.Resolve(ctx, destination, keychain); err == nil {
+			actor.Image = resolved
+			return true, "", nil
+		}
+	} else if err != nil {
+		return false, "", err
+	}
+
+	if fetched, reason, err := s.fetch(ctx, room, actor, podName, template.Dockerfile); err != nil || reason != "" || !fetched {
+		return false, reason, err
+	}
+
+	pod, err := s.SyncPod(ctx, s.buildPodManifest(room, actor, template, destination), room)
+	if err != nil {
+		return false, "", err
+	}
+
+	phase, reason := podPhase(room, pod)
+	if room.Status.Builds == nil {
+		room.Status.Builds = make(map[string]corev1.PodPhase)
+	}
+	room.Status.Builds[actor.Name] = phase
+
+	switch phase {
+	case corev1.PodSucceeded:
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == name.PusherContainerName() && status.State.Terminated != nil {
+				if digest := strings.TrimSpace(status.State.Terminated.Message); strings.HasPrefix(digest, "sha256:") {
+					actor.Image = template.Repository + "@" + digest
+					return true, "", nil
+				}
+			}
+		}
+		actor.Image = destination
+		return true, "", nil
+	case corev1.PodFailed:
+		if reason == "" {
+			reason = buildFailure(pod)
+		}
+		return false, fmt.Sprintf("Source code of actor %s could not be built.\n%s", actor.Name, reason), nil
+	default:
+		return false, "", nil
+	}
+}
+
+// fetch runs a pod fetching the source code of an actor into the PVC mounted by podName, and returns
+// true once it is fetched. The PVC is marked fetched and the fetcher is deleted once it succeeds.
+// A dockerfile replaces the Dockerfile of the source code unless it is empty.
+func (s *submissionReconciler) fetch(ctx context.Context, room *hubv1.Room, actor *hubv1.Actor, podName, dockerfile string) (bool, string, error) {
+	pvc, err := s.SyncPVC(ctx, s.sourcePVCManifest(room, actor, podName), room)
+	if err != nil {
+		return false, "", err
+	}
+	if pvc.Annotations[name.SourceFetchedAnnotation()] == "true" {
+		return true, "", nil
+	}
+
+	if err := s.syncSourceSecret(ctx, room, podName, actor.Source); err != nil {
+		return false, "", err
+	}
+
+	pod, err := s.SyncPod(ctx, s.fetcherPodManifest(room, actor, podName, dockerfile), room)
+	if err != nil {
+		return false, "", err
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		if pvc.Annotations == nil {
+			pvc.Annotations = make(map[string]string)
+		}
+		pvc.Annotations[name.SourceFetchedAnnotation()] = "true"
+		if err := s.Update(ctx, pvc); err != nil {
+			return false, "", err
+		}
+		return true, "", s.DeletePod(ctx, pod)
+	case corev1.PodFailed:
+		return false, fmt.Sprintf("Source code of actor %s could not be fetched.\n%s", actor.Name, buildFailure(pod)), nil
+	default:
+		return false, "", nil
+	}
+}
+
+// sourcePVCManifest returns the PVC source code of the actor running in podName is fetched into
+func (s *submissionReconciler) sourcePVCManifest(room *hubv1.Room, actor *hubv1.Actor, podName string) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.SourcePVCName(podName),
+			Namespace: room.WorkloadNamespace(),
+			Labels: map[string]string{
+				name.RoomLabel():    room.Spec.ID,
+				name.ProblemLabel(): room.Spec.ProblemID,
+				name.IDLabel():      actor.Name,
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: s.config.Runtime().SourceVolumeSize,
+				},
+			},
+		},
+	}
+	if storageClass := room.Spec.Setting.StorageClass; storageClass != "" {
+		pvc.Spec.StorageClassName = &storageClass
+	}
+	return pvc
+}
+
+// fetcherPodManifest returns the pod fetching source code into the PVC of podName. It is the only
+// pod of the room allowed to reach the object store, no contestant code runs in it.
+func (s *submissionReconciler) fetcherPodManifest(room *hubv1.Room, actor *hubv1.Actor, podName, dockerfile string) *corev1.Pod {
+	fetcher := sourceFetcherContainer(s.config.Runtime().Images.SourceFetcher, podName, dockerfile)
+	fetcher.VolumeMounts = []corev1.VolumeMount{
+		{
+			Name:      name.SourceVolumeName(),
+			MountPath: name.SourceMountPath(),
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.FetcherPodName(podName),
+			Namespace: room.WorkloadNamespace(),
+			Labels: map[string]string{
+				name.CharacterLabel():   name.CharacterFetcher(),
+				name.RoomLabel():        room.Spec.ID,
+				name.ProblemLabel():     room.Spec.ProblemID,
+				name.IDLabel():          actor.Name,
+				name.ObjectStoreLabel(): name.ObjectStoreLabelValue(),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Volumes:       []corev1.Volume{sourceVolume(podName)},
+			Containers:    []corev1.Container{fetcher},
+		},
+	}
+
+	applyBuilderSandbox(room, pod, s.config.Runtime().SandboxUserID)
+	return pod
+}
+
+// sourceVolume returns the volume of the PVC source code of podName is fetched into
+func sourceVolume(podName string) corev1.Volume {
+	return corev1.Volume{
+		Name: name.SourceVolumeName(),
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: name.SourcePVCName(podName),
+			},
+		},
+	}
+}
+
+// pushKeychain reads the credentials of the repository of the template
+func (s *submissionReconciler) pushKeychain(ctx context.Context, room *hubv1.Room, template *hubv1.RuntimeTemplate) (*image.Keychain, error) {
+	if template.PushSecret == "" {
+		return image.NewKeychain()
+	}
+
+	secret, err := s.GetSecret(ctx, types.NamespacedName{Name: template.PushSecret, Namespace: room.Namespace})
+	if errors.IsNotFound(err) {
+		return image.NewKeychain()
+	} else if err != nil {
+		return nil, err
+	}
+	return image.NewKeychain(secret)
+}
+
+// syncSourceSecret keeps a URL of the source code in a secret of the pod fetching it.
+// The URL is created once, since a new one would not reach a pod which already exists.
+func (s *submissionReconciler) syncSourceSecret(ctx context.Context, room *hubv1.Room, podName string, source *hubv1.Source) error {
+	key := types.NamespacedName{Name: name.SourceSecretName(podName), Namespace: room.WorkloadNamespace()}
+	if _, err := s.GetSecret(ctx, key); err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	url, err := s3.PresignedGetURL(ctx, name.S3SubmissionsBucket(s.config.BucketPrefix(room.Namespace)), source.Object, SourceURLExpiry)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels: map[string]string{
+				name.RoomLabel():    room.Spec.ID,
+				name.ProblemLabel(): room.Spec.ProblemID,
+			},
+		},
+		StringData: map[string]string{
+			"url":    url,
+			"digest": strings.TrimPrefix(source.Digest, "sha256:"),
+		},
+	}
+	_, err = s.SyncSecret(ctx, secret, room)
+	return err
+}
+
+// buildPodManifest returns a pod building the fetched source code of an actor. The builder runs the Dockerfile
+// without credentials and leaves the image as a tarball, which the pusher pushes with the push secret.
+func (s *submissionReconciler) buildPodManifest(room *hubv1.Room, actor *hubv1.Actor, template *hubv1.RuntimeTemplate, destination string) *corev1.Pod {
+	podName := naming.BuildPodName(room, actor.Name)
+	tarball := name.ImageMountPath() + "/image.tar"
+
+	workspace := corev1.VolumeMount{
+		Name:      name.SourceVolumeName(),
+		MountPath: name.SourceMountPath(),
+	}
+	output := corev1.VolumeMount{
+		Name:      name.ImageVolumeName(),
+		MountPath: name.ImageMountPath(),
+	}
+	volumes := []corev1.Volume{
+		sourceVolume(podName),
+		{
+			Name: name.ImageVolumeName(),
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+	pusherMounts := []corev1.VolumeMount{output}
+
+	if template.PushSecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: name.DockerConfigVolumeName(),
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: template.PushSecret,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  corev1.DockerConfigJsonKey,
+							Path: "config.json",
+						},
+					},
+				},
+			},
+		})
+		pusherMounts = append(pusherMounts, corev1.VolumeMount{
+			Name:      name.DockerConfigVolumeName(),
+			MountPath: name.DockerConfigMountPath(),
+			ReadOnly:  true,
+		})
+	}
+
+	resources := corev1.ResourceRequirements{}
+	if template.Resources != nil {
+		resources = *template.Resources
+	}
+
+	// the pusher writes the digest of the pushed image as its termination message
+	script := `set -e
+ref=$(crane push "$IMAGE_TARBALL" "$DESTINATION")
+printf '%s' "${ref#*@}" > /dev/termination-log`
+
+	deadline := int64(BuildTimeout.Seconds())
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: room.WorkloadNamespace(),
+			Labels: map[string]string{
+				name.CharacterLabel(): name.CharacterBuilder(),
+				name.RoomLabel():      room.Spec.ID,
+				name.ProblemLabel():   room.Spec.ProblemID,
+				name.IDLabel():        actor.Name,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Volumes:               volumes,
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &deadline,
+			InitContainers: []corev1.Container{
+				{
+					Name:            name.BuilderContainerName(),
+					Image:           s.config.Runtime().Images.Builder,
+					ImagePullPolicy: corev1.PullIfNotPresent,
+					Args: []string{
+						"--context=dir://" + name.SourceMountPath(),
+						"--dockerfile=" + name.SourceMountPath() + "/Dockerfile",
+						"--destination=" + destination,
+						"--no-push",
+						"--tarPath=" + tarball,
+					},
+					VolumeMounts:             []corev1.VolumeMount{workspace, output},
+					Resources:                resources,
+					TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:            name.PusherContainerName(),
+					Image:           s.config.Runtime().Images.Pusher,
+					ImagePullPolicy: corev1.PullIfNotPresent,
+					Command:         []string{"sh", "-c", script},
+					Env: []corev1.EnvVar{
+						{Name: "IMAGE_TARBALL", Value: tarball},
+						{Name: "DESTINATION", Value: destination},
+						{Name: "DOCKER_CONFIG", Value: name.DockerConfigMountPath()},
+					},
+					VolumeMounts:             pusherMounts,
+					TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+				},
+			},
+		},
+	}
+
+	applyBuilderSandbox(room, pod, s.config.Runtime().SandboxUserID)
+	return pod
+}
+
+// mountSource mounts the fetched source code of an actor in interpret mode into the pod,
+// and runs the command of the template unless the actor has its own
+func mountSource(room *hubv1.Room, actor *hubv1.Actor, pod *corev1.Pod) error {
+	if actor.Source == nil {
+		return nil
+	}
+
+	template, ok := room.Spec.Setting.Templates[actor.Source.Template]
+	if !ok || template == nil {
+		return fmt.Errorf("unknown template %q", actor.Source.Template)
+	}
+	if template.Mode != hubv1.SubmissionModeInterpret {
+		return nil
+	}
+
+	mount := corev1.VolumeMount{
+		Name:      name.SourceVolumeName(),
+		MountPath: name.SourceMountPath(),
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, sourceVolume(pod.Name))
+
+	main := &pod.Spec.Containers[0]
+	main.VolumeMounts = append(main.VolumeMounts, mount)
+	if len(main.Command) == 0 && len(main.Args) == 0 {
+		main.Command = template.Command
+		main.Args = template.Args
+	}
+	if main.WorkingDir == "" {
+		main.WorkingDir = template.WorkingDir
+	}
+	if main.WorkingDir == "" {
+		main.WorkingDir = name.SourceMountPath()
+	}
+	return nil
+}
+
+// sourceFetcherContainer returns a container downloading the source code of a pod,
+// verifying its digest and extracting it into name.SourceMountPath(). A dockerfile
+// replaces the Dockerfile of the source code unless it is empty.
+func sourceFetcherContainer(image, podName, dockerfile string) corev1.Container {
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name.SourceSecretName(podName)},
+				Key:                  key,
+			},
+		}
+	}
+
+	steps := []string{
+		"set -e",
+		`wget -q -O "$SOURCE_DIR/.source.tar.gz" "$SOURCE_URL"`,
+		`echo "$SOURCE_DIGEST  $SOURCE_DIR/.source.tar.gz" | sha256sum -c -`,
+		`tar -xzf "$SOURCE_DIR/.source.tar.gz" -C "$SOURCE_DIR"`,
+		`rm "$SOURCE_DIR/.source.tar.gz"`,
+	}
+	env := []corev1.EnvVar{
+		{Name: "SOURCE_DIR", Value: name.SourceMountPath()},
+		{Name: "SOURCE_URL", ValueFrom: secretKey("url")},
+		{Name: "SOURCE_DIGEST", ValueFrom: secretKey("digest")},
+	}
+	if dockerfile != "" {
+		steps = append(steps, `printf '%s' "$DOCKERFILE" > "$SOURCE_DIR/Dockerfile"`)
+		env = append(env, corev1.EnvVar{Name: "DOCKERFILE", Value: dockerfile})
+	}
+
+	return corev1.Container{
+		Name:                     name.SourceContainerName(),
+		Image:                    image,
+		ImagePullPolicy:          corev1.PullIfNotPresent,
+		Command:                  []string{"sh", "-c", strings.Join(steps, "\n")},
+		Env:                      env,
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+}
+
+// buildTag returns the tag of the image of a source code built by a template
+func buildTag(source *hubv1.Source, template *hubv1.RuntimeTemplate) string {
+	sum := sha256.Sum256([]byte(source.Digest + "\n" + template.Dockerfile))
+	return hex.EncodeToString(sum[:])
+}
+
+// buildFailure returns the termination message of the container which failed the build
+func buildFailure(pod *corev1.Pod) string {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return fmt.Sprintf("container %s exited with %d: %s", status.Name, terminated.ExitCode, terminated.Message)
+		}
+	}
+	if pod.Status.Message != "" {
+		return pod.Status.Message
+	}
+	return "build failed"
+}
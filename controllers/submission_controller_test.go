@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+func TestBuildPodManifest(t *testing.T) {
+	s, err := newSubmissionReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &hubv1.RuntimeTemplate{
+		Mode:       hubv1.SubmissionModeBuild,
+		Dockerfile: "FROM gcc:11",
+		Repository: "registry.example.com/submissions",
+		PushSecret: "registry-credentials",
+	}
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{ID: "room-1", ProblemID: "problem", Setting: &hubv1.Setting{}}}
+	actor := &hubv1.Actor{Name: "alice"}
+
+	pod := s.buildPodManifest(room, actor, template, "registry.example.com/submissions:tag")
+
+	if pod.Labels[name.RoomLabel()] != "room-1" {
+		t.Errorf("labels = %v, want the room label", pod.Labels)
+	}
+	if _, ok := pod.Labels[name.ObjectStoreLabel()]; ok {
+		t.Errorf("labels = %v, the builder should not reach the object store", pod.Labels)
+	}
+	if claim := pod.Spec.Volumes[0].PersistentVolumeClaim; claim == nil || claim.ClaimName != name.SourcePVCName(pod.Name) {
+		t.Errorf("volumes = %v, want the fetched source code as the context", pod.Spec.Volumes)
+	}
+	if pod.Spec.AutomountServiceAccountToken == nil || *pod.Spec.AutomountServiceAccountToken {
+		t.Error("the service account token should not be mounted")
+	}
+	if len(pod.Spec.InitContainers) != 1 || len(pod.Spec.Containers) != 1 {
+		t.Fatalf("containers = %d init, %d, want the builder before the pusher", len(pod.Spec.InitContainers), len(pod.Spec.Containers))
+	}
+
+	// only the pusher reads the push secret
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		mountsSecret := false
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == name.DockerConfigVolumeName() {
+				mountsSecret = true
+			}
+		}
+		if mountsSecret != (container.Name == name.PusherContainerName()) {
+			t.Errorf("container %s mounts the push secret: %v", container.Name, mountsSecret)
+		}
+
+		context := container.SecurityContext
+		if context == nil || context.AllowPrivilegeEscalation == nil || *context.AllowPrivilegeEscalation {
+			t.Errorf("container %s may escalate privileges", container.Name)
+			continue
+		}
+		if container.Name == name.BuilderContainerName() {
+			if len(context.Capabilities.Drop) != 1 || context.Capabilities.Drop[0] != "ALL" || len(context.Capabilities.Add) == 0 {
+				t.Errorf("builder capabilities = %v, want only the ones of building images", context.Capabilities)
+			}
+		} else if context.RunAsNonRoot == nil || !*context.RunAsNonRoot {
+			t.Errorf("container %s should not run as root", container.Name)
+		}
+	}
+
+	builder := pod.Spec.InitContainers[0]
+	if !strings.Contains(strings.Join(builder.Args, " "), "--no-push") {
+		t.Errorf("builder args = %v, the builder should not push", builder.Args)
+	}
+}
+
+func TestSourceFetcherContainer(t *testing.T) {
+	fetcher := sourceFetcherContainer("busybox", "pod", "FROM gcc:11")
+	script := fetcher.Command[2]
+	if strings.Count(script, "Dockerfile") != 1 || !strings.HasSuffix(script, `> "$SOURCE_DIR/Dockerfile"`) {
+		t.Errorf("script = %q, want the Dockerfile written after extracting the source code", script)
+	}
+	if env := fetcher.Env[len(fetcher.Env)-1]; env.Name != "DOCKERFILE" || env.Value != "FROM gcc:11" {
+		t.Errorf("env = %v, want the Dockerfile", fetcher.Env)
+	}
+
+	fetcher = sourceFetcherContainer("busybox", "pod", "")
+	if strings.Contains(fetcher.Command[2], "Dockerfile") {
+		t.Errorf("script = %q, the Dockerfile of the source code should be kept", fetcher.Command[2])
+	}
+	for _, env := range fetcher.Env {
+		if env.Name == "DOCKERFILE" {
+			t.Errorf("env = %v, want no Dockerfile", fetcher.Env)
+		}
+	}
+	if got := fetcher.Env[1].ValueFrom; got == nil || got.SecretKeyRef.Name != name.SourceSecretName("pod") {
+		t.Errorf("source url = %v, want the source secret of the pod", got)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	room := &hubv1.Room{
+		ObjectMeta: metav1.ObjectMeta{Name: "room-1", Namespace: "hub-system"},
+		Spec: hubv1.RoomSpec{ID: "room-1", ProblemID: "problem", Setting: &hubv1.Setting{
+			Templates: map[string]*hubv1.RuntimeTemplate{"python": {Mode: hubv1.SubmissionModeInterpret}},
+		}},
+	}
+	actor := &hubv1.Actor{Name: "alice", Source: &hubv1.Source{Template: "python", Digest: "sha256:abc"}}
+	podName := name.ActorPodName(room.Spec.ID, actor.Name)
+
+	// the URL of the source code is presigned once, an existing secret is kept
+	c := newFakeClient(t, room, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name.SourceSecretName(podName), Namespace: room.Namespace}})
+	s, err := newSubmissionReconciler(c, logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if fetched, reason, err := s.fetch(ctx, room, actor, podName, ""); err != nil || reason != "" || fetched {
+		t.Fatalf("fetch() = %v, %q, %v, want to wait for the fetcher", fetched, reason, err)
+	}
+	fetcher, err := c.GetPod(ctx, types.NamespacedName{Name: name.FetcherPodName(podName), Namespace: room.Namespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.Labels[name.ObjectStoreLabel()] != name.ObjectStoreLabelValue() || fetcher.Labels[name.RoomLabel()] != room.Spec.ID {
+		t.Errorf("fetcher labels = %v, want the room and the object store labels", fetcher.Labels)
+	}
+
+	fetcher.Status.Phase = corev1.PodSucceeded
+	if err := c.Status().Update(ctx, fetcher); err != nil {
+		t.Fatal(err)
+	}
+	if fetched, reason, err := s.fetch(ctx, room, actor, podName, ""); err != nil || reason != "" || !fetched {
+		t.Fatalf("fetch() = %v, %q, %v, want the source code fetched", fetched, reason, err)
+	}
+	if _, err := c.GetPod(ctx, types.NamespacedName{Name: fetcher.Name, Namespace: room.Namespace}); !errors.IsNotFound(err) {
+		t.Errorf("fetcher should be deleted once it succeeds, got %v", err)
+	}
+	pvc, err := c.GetPVC(ctx, types.NamespacedName{Name: name.SourcePVCName(podName), Namespace: room.Namespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pvc.Annotations[name.SourceFetchedAnnotation()] != "true" {
+		t.Errorf("annotations = %v, the PVC should be marked fetched", pvc.Annotations)
+	}
+}
+
+func TestMountSource(t *testing.T) {
+	room := &hubv1.Room{Spec: hubv1.RoomSpec{Setting: &hubv1.Setting{
+		Templates: map[string]*hubv1.RuntimeTemplate{"python": {Mode: hubv1.SubmissionModeInterpret, Command: []string{"python3", "main.py"}}},
+	}}}
+	actor := &hubv1.Actor{Name: "alice", Source: &hubv1.Source{Template: "python"}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "actor-pod", Labels: map[string]string{name.RoomLabel(): "room-1"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "actor"}}},
+	}
+
+	if err := mountSource(room, actor, pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pod.Labels[name.ObjectStoreLabel()]; ok {
+		t.Errorf("labels = %v, contestant pods should not reach the object store", pod.Labels)
+	}
+	if len(pod.Spec.InitContainers) != 0 {
+		t.Errorf("init containers = %v, the source code is fetched by another pod", pod.Spec.InitContainers)
+	}
+	if claim := pod.Spec.Volumes[0].PersistentVolumeClaim; claim == nil || claim.ClaimName != name.SourcePVCName("actor-pod") {
+		t.Errorf("volumes = %v, want the PVC of the fetched source code", pod.Spec.Volumes)
+	}
+	if main := pod.Spec.Containers[0]; main.WorkingDir != name.SourceMountPath() || len(main.Command) != 2 {
+		t.Errorf("actor = %+v, want the command of the template in the source code", main)
+	}
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"path"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/naming"
+)
+
+// roomVolumes returns the data volumes of the room. Volumes of datasets get the PVC
+// of the dataset and are always read-only. Deprecated PVCNames are converted
+// to volumes with the layout they used to have:
+// 1. public PVCs are mounted on /data/<pvc> for actors and /data/public-<pvc> for the director
+// 2. private PVCs are mounted on /data/private-<pvc> for the director
+func roomVolumes(room *hubv1.Room) []hubv1.Volume {
+	volumes := make([]hubv1.Volume, 0, len(room.Spec.Setting.Volumes))
+	for _, volume := range room.Spec.Setting.Volumes {
+		if volume.Dataset != "" {
+			dataset := findDataset(room, volume.Dataset)
+			if dataset == nil {
+				continue
+			}
+			if volume.MountPath == "" {
+				volume.MountPath = name.DataVolumeMountPath(dataset.Name)
+			}
+			readOnly := true
+			volume.PVCName = datasetPVCName(room, dataset)
+			volume.ReadOnly = &readOnly
+		}
+		volumes = append(volumes, volume)
+	}
+
+	pvcNames := room.Spec.Setting.DataPVCNames
+	if pvcNames == nil {
+		return volumes
+	}
+
+	actorRoles := make(map[string]bool)
+	for _, actor := range room.Spec.Actors {
+		actorRoles[actor.Role] = true
+	}
+
+	for _, pvcName := range pvcNames.Public {
+		volumes = append(volumes,
+			hubv1.Volume{
+				PVCName: pvcName,
+				Roles:   sortedKeys(actorRoles),
+			},
+			hubv1.Volume{
+				PVCName:   pvcName,
+				MountPath: name.DataVolumeMountPath("public-" + pvcName),
+				Roles:     []string{name.CharacterDirector()},
+			},
+		)
+	}
+	for _, pvcName := range pvcNames.Private {
+		volumes = append(volumes, hubv1.Volume{
+			PVCName:   pvcName,
+			MountPath: name.DataVolumeMountPath("private-" + pvcName),
+			Roles:     []string{name.CharacterDirector()},
+		})
+	}
+	return volumes
+}
+
+// roomPVCNames returns the sorted names of data PVCs of the room
+func roomPVCNames(room *hubv1.Room) []string {
+	pvcNames := make(map[string]bool)
+	for _, volume := range roomVolumes(room) {
+		pvcNames[volume.PVCName] = true
+	}
+	return sortedKeys(pvcNames)
+}
+
+// mountVolumes mounts the data volumes of the room which are visible to the role of the pod
+// into its main container. A PVC is a single volume of the pod however many times it is mounted.
+func mountVolumes(room *hubv1.Room, pod *corev1.Pod) {
+	role := pod.Labels[name.RoleLabel()]
+	main := &pod.Spec.Containers[0]
+
+	// volumes are named by their index, since names of PVCs may not fit in a volume name
+	claimed := make(map[string]string)
+	for _, volume := range roomVolumes(room) {
+		if !visibleTo(volume, role) {
+			continue
+		}
+
+		volumeName, ok := claimed[volume.PVCName]
+		if !ok {
+			volumeName = name.DataVolumeName(strconv.Itoa(len(claimed)))
+			claimed[volume.PVCName] = volumeName
+			pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+				Name: volumeName,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: volume.PVCName,
+					},
+				},
+			})
+		}
+
+		mountPath := volume.MountPath
+		if mountPath == "" {
+			mountPath = name.DataVolumeMountPath(volume.PVCName)
+		}
+		readOnly := volume.ReadOnly == nil || *volume.ReadOnly
+
+		main.VolumeMounts = append(main.VolumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: mountPath,
+			SubPath:   volume.SubPath,
+			ReadOnly:  readOnly,
+		})
+	}
+
+	// a volume mounted read-only everywhere is claimed read-only as well
+	for i := range pod.Spec.Volumes {
+		claim := pod.Spec.Volumes[i].PersistentVolumeClaim
+		if claim == nil || claimed[claim.ClaimName] != pod.Spec.Volumes[i].Name {
+			continue
+		}
+		claim.ReadOnly = true
+		for _, mount := range main.VolumeMounts {
+			if mount.Name == pod.Spec.Volumes[i].Name && !mount.ReadOnly {
+				claim.ReadOnly = false
+			}
+		}
+	}
+}
+
+// visibleTo returns true if the volume is mounted into pods of the role
+func visibleTo(volume hubv1.Volume, role string) bool {
+	if len(volume.Roles) == 0 {
+		return role != name.CharacterGimulator()
+	}
+	for _, r := range volume.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// outputMountPath returns where an actor finds its output volume
+func outputMountPath(room *hubv1.Room) string {
+	if output := room.Spec.Setting.Output; output != nil && output.MountPath != "" {
+		return output.MountPath
+	}
+	return name.OutputVolumeMountPath()
+}
+
+// directorOutputMountPath returns where the director finds the output volume of an actor
+func directorOutputMountPath(room *hubv1.Room, actorName string) string {
+	if output := room.Spec.Setting.Output; output != nil && output.DirectorMountPath != "" {
+		return path.Join(output.DirectorMountPath, actorName)
+	}
+	return name.ActorOutputVolumeMountPathForDirector(actorName)
+}
+
+// outputVolumeType returns the kind of volume outputs of actors are written to
+func outputVolumeType(room *hubv1.Room) hubv1.OutputVolumeType {
+	if output := room.Spec.Setting.Output; output != nil && output.Volume != "" {
+		return output.Volume
+	}
+	return hubv1.OutputVolumePVC
+}
+
+// outputRetention returns how long output PVCs of the room outlive it
+func outputRetention(room *hubv1.Room) hubv1.OutputRetention {
+	if output := room.Spec.Setting.Output; output != nil && output.Retention != nil && output.Retention.Policy != "" {
+		return *output.Retention
+	}
+	return hubv1.OutputRetention{Policy: hubv1.OutputRetentionDelete}
+}
+
+// keepsOutputs returns true if output PVCs of the room outlive it
+func keepsOutputs(room *hubv1.Room) bool {
+	size, err := resource.ParseQuantity(room.Spec.Setting.OutputVolumeSize)
+	if err != nil || size.IsZero() {
+		return false
+	}
+	return outputVolumeType(room) == hubv1.OutputVolumePVC && outputRetention(room).Policy != hubv1.OutputRetentionDelete
+}
+
+// outputVolume returns the volume an actor writes its output to
+func outputVolume(room *hubv1.Room, actorName string, size resource.Quantity) corev1.Volume {
+	volume := corev1.Volume{Name: name.OutputVolumeName(actorName)}
+
+	switch outputVolumeType(room) {
+	case hubv1.OutputVolumeEmptyDir:
+		volume.EmptyDir = &corev1.EmptyDirVolumeSource{SizeLimit: &size}
+	case hubv1.OutputVolumeEphemeral:
+		spec := corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: size,
+				},
+			},
+		}
+		if room.Spec.Setting.StorageClass != "" {
+			storageClass := room.Spec.Setting.StorageClass
+			spec.StorageClassName = &storageClass
+		}
+		volume.Ephemeral = &corev1.EphemeralVolumeSource{
+			VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{Spec: spec},
+		}
+	default:
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: naming.OutputPVCName(room, actorName),
+		}
+	}
+	return volume
+}
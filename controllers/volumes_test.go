@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+)
+
+func TestReconcileActorReservedRoleReason(t *testing.T) {
+	a, err := newActorReconciler(newFakeClient(t), logr.Discard(), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []string{"director", "gimulator"} {
+		room := &hubv1.Room{Spec: hubv1.RoomSpec{
+			ID:     "room-1",
+			Actors: []*hubv1.Actor{{Name: "alice", Role: role, Image: "alice:v1"}},
+			Setting: &hubv1.Setting{
+				OutputVolumeSize: "0",
+				DataPVCNames:     &hubv1.PVCNames{Private: []string{"answers"}},
+			},
+		}}
+
+		reason, err := a.reconcileActor(context.Background(), room, room.Spec.Actors[0])
+		if err != nil {
+			t.Fatalf("reconcileActor() returned error %v, want a reason", err)
+		}
+		if !strings.Contains(reason, "role "+role+" is reserved") {
+			t.Errorf("reason = %q, want actors with the role %s rejected", reason, role)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/image"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// WarmerReconciler keeps images of rooms pulled on every node by a DaemonSet.
+// Every image is an init container of the DaemonSet, so the kubelet pulls it
+// on each node; a copied `true` binary makes the container exit immediately.
+// It also records which images of rooms each node has in the image cache ConfigMap,
+// so rooms can prefer nodes which already have their images.
+type WarmerReconciler struct {
+	*client.Client
+	Log       logr.Logger
+	Namespace string
+	config    *hubconfig.Config
+}
+
+// NewWarmerReconciler returns new instance of WarmerReconciler
+func NewWarmerReconciler(log logr.Logger, client *client.Client, config *hubconfig.Config) (*WarmerReconciler, error) {
+	return &WarmerReconciler{
+		Log:       log,
+		Client:    client,
+		Namespace: config.Hub().Namespace,
+		config:    config,
+	}, nil
+}
+
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+
+// Reconcile syncs the image warmer DaemonSet with images of the rooms asking for pre-pulling
+// and the image cache with images pulled on each node
+func (w *WarmerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.config.Runtime().ReconcileTimeout.Duration)
+	defer cancel()
+
+	ctx = logging.WithReconcileID(ctx)
+	logger := logging.Logger(ctx, w.Log).WithValues("reconciler", "Warmer")
+	logger.Info("starting to reconcile image warmer")
+
+	rooms, err := w.watchedRooms(ctx)
+	if err != nil {
+		logger.Error(err, "could not list rooms")
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("starting to reconcile image warmer daemonset")
+	wait, err := w.reconcileDaemonSet(ctx, rooms, time.Now())
+	if err != nil {
+		logger.Error(err, "could not reconcile image warmer daemonset")
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("starting to sync image cache")
+	if err := w.reconcileImageCache(ctx, rooms); err != nil {
+		logger.Error(err, "could not sync image cache")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: wait}, nil
+}
+
+// watchedRooms returns the rooms of the namespaces reconciled by the manager
+func (w *WarmerReconciler) watchedRooms(ctx context.Context) (*hubv1.RoomList, error) {
+	rooms := &hubv1.RoomList{}
+	if err := w.List(ctx, rooms); err != nil {
+		return nil, err
+	}
+
+	namespaces := make(map[string]bool)
+	watched := rooms.Items[:0]
+	for _, room := range rooms.Items {
+		ok, checked := namespaces[room.Namespace]
+		if !checked {
+			var err error
+			if ok, err = watchesNamespace(ctx, w.Client, w.config.Hub(), room.Namespace); err != nil {
+				return nil, err
+			}
+			namespaces[room.Namespace] = ok
+		}
+		if ok {
+			watched = append(watched, room)
+		}
+	}
+	rooms.Items = watched
+	return rooms, nil
+}
+
+// reconcileDaemonSet syncs the DaemonSet with the images of the rooms. Every change of its template
+// restarts its pods on every node, so changes are applied at most once in ImageWarmerUpdateInterval
+// and the time to wait for the next one is returned. The time of the last change is kept in an
+// annotation of the DaemonSet, so it survives restarts of the manager.
+func (w *WarmerReconciler) reconcileDaemonSet(ctx context.Context, rooms *hubv1.RoomList, now time.Time) (time.Duration, error) {
+	images, pullSecretNames, placements := w.warmImages(rooms)
+	desired := w.warmerManifest(images, pullSecretNames, placements)
+	desired.Annotations = map[string]string{name.WarmerUpdatedAnnotation(): now.UTC().Format(time.RFC3339)}
+
+	ds, err := w.GetDaemonSet(ctx, types.NamespacedName{Name: name.ImageWarmerName(), Namespace: w.Namespace})
+	if errors.IsNotFound(err) {
+		if len(images) == 0 {
+			return 0, nil
+		}
+		_, err := w.SyncDaemonSet(ctx, desired, nil)
+		return 0, err
+	} else if err != nil {
+		return 0, err
+	}
+
+	if len(images) > 0 && !warmerChanged(desired, ds) {
+		return 0, nil
+	}
+
+	// a DaemonSet without a valid annotation is updated at once
+	lastUpdate, _ := time.Parse(time.RFC3339, ds.Annotations[name.WarmerUpdatedAnnotation()])
+	if wait := lastUpdate.Add(w.config.Runtime().ImageWarmerUpdateInterval.Duration).Sub(now); wait > 0 {
+		return wait, nil
+	}
+
+	if len(images) == 0 {
+		return 0, w.DeleteDaemonSet(ctx, ds)
+	}
+	ds.Labels = desired.Labels
+	ds.Annotations = desired.Annotations
+	ds.Spec = desired.Spec
+	return 0, w.Update(ctx, ds)
+}
+
+// warmerChanged returns true if the desired DaemonSet differs from the current one.
+// Unset fields are defaulted by the API server, but an affinity is unset on purpose.
+func warmerChanged(desired, current *appsv1.DaemonSet) bool {
+	return !equality.Semantic.DeepDerivative(desired.Spec, current.Spec) ||
+		!equality.Semantic.DeepEqual(desired.Spec.Template.Spec.Affinity, current.Spec.Template.Spec.Affinity) ||
+		!equality.Semantic.DeepEqual(desired.Labels, current.Labels)
+}
+
+// reconcileImageCache records the images of rooms pulled on each node. Images are
+// taken from the status of nodes and from warm-up containers which have finished,
+// since the kubelet reports only a limited number of images of a node.
+func (w *WarmerReconciler) reconcileImageCache(ctx context.Context, rooms *hubv1.RoomList) error {
+	tracked := make(map[string]bool)
+	for i := range rooms.Items {
+		for _, img := range roomImages(&rooms.Items[i]) {
+			tracked[img] = true
+		}
+	}
+
+	cached := make(map[string]map[string]bool)
+	addImage := func(node, img string) {
+		img = image.Normalize(img)
+		if !tracked[img] {
+			return
+		}
+		if cached[node] == nil {
+			cached[node] = make(map[string]bool)
+		}
+		cached[node][img] = true
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		return err
+	}
+	for _, node := range nodes.Items {
+		for _, nodeImage := range node.Status.Images {
+			for _, img := range nodeImage.Names {
+				addImage(node.Name, img)
+			}
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := w.List(ctx, pods, ctrlclient.InNamespace(w.Namespace), ctrlclient.MatchingLabels{name.IDLabel(): name.ImageWarmerName()}); err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			continue
+		}
+		for _, status := range pod.Status.InitContainerStatuses {
+			if status.State.Terminated != nil && status.State.Terminated.ExitCode == 0 {
+				addImage(pod.Spec.NodeName, status.Image)
+			}
+		}
+	}
+
+	data := make(map[string]string)
+	for node, images := range cached {
+		data[node] = strings.Join(sortedKeys(images), "\n")
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.ImageCacheConfigMapName(),
+			Namespace: w.Namespace,
+		},
+		Data: data,
+	}
+	_, err := w.SyncConfigMap(ctx, cm, nil)
+	return err
+}
+
+// warmImages returns the sorted images to be pre-pulled, the pull secrets needed for them
+// and the placements of the rooms they belong to. Init containers of the DaemonSet run one
+// after another, so an image the kubelet can not pull would hold back every image after it.
+// Only images pinned to a digest are pre-pulled, since the registry has served them to the hub.
+func (w *WarmerReconciler) warmImages(rooms *hubv1.RoomList) ([]string, []string, []*hubv1.Placement) {
+	images := make(map[string]bool)
+	addImage := func(img string) {
+		if isPinned(img) {
+			images[img] = true
+		}
+	}
+	secrets := make(map[string]bool)
+	placements := make([]*hubv1.Placement, 0)
+
+	for i := range rooms.Items {
+		room := &rooms.Items[i]
+		if room.Spec.Setting == nil || !room.Spec.Setting.PrePullImages {
+			continue
+		}
+
+		// the DaemonSet runs in the namespace of the manager, so images of rooms of other
+		// namespaces are only pulled if the registry secret of the manager is their pull secret
+		roomSecrets := pullSecretNames(room, w.config)
+		if room.Namespace != w.Namespace && (len(roomSecrets) != 1 || roomSecrets[0] != name.RegistrySecretName()) {
+			continue
+		}
+
+		if room.Spec.Director != nil {
+			addImage(room.Spec.Director.Image)
+		}
+		addImage(gimulatorImage(room))
+
+		// actors of a running room are already pulled where they run
+		if isQueued(room) {
+			for _, actor := range room.Spec.Actors {
+				addImage(actor.Image)
+			}
+		}
+
+		for _, secretName := range roomSecrets {
+			secrets[secretName] = true
+		}
+		placements = append(placements, room.Spec.Setting.Placement)
+	}
+
+	return sortedKeys(images), sortedKeys(secrets), placements
+}
+
+// warmerAffinity restricts the DaemonSet to the nodes selected by the placement of any of the rooms.
+// It is nil if a room may run on every node.
+func warmerAffinity(placements []*hubv1.Placement) *corev1.Affinity {
+	terms := make(map[string]corev1.NodeSelectorTerm)
+	selectors := make(map[string]bool)
+	for _, placement := range placements {
+		if placement == nil || len(placement.NodeSelector) == 0 {
+			return nil
+		}
+
+		term := corev1.NodeSelectorTerm{}
+		selector := labels.Set(placement.NodeSelector)
+		keys := make([]string, 0, len(selector))
+		for key := range selector {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			term.MatchExpressions = append(term.MatchExpressions, corev1.NodeSelectorRequirement{
+				Key:      key,
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{selector[key]},
+			})
+		}
+		terms[selector.String()] = term
+		selectors[selector.String()] = true
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// terms are ORed, so pods run on the nodes of every room
+	nodeSelector := &corev1.NodeSelector{}
+	for _, key := range sortedKeys(selectors) {
+		nodeSelector.NodeSelectorTerms = append(nodeSelector.NodeSelectorTerms, terms[key])
+	}
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: nodeSelector,
+		},
+	}
+}
+
+// warmerTolerations returns the tolerations of the placements of the rooms, so images are pulled on their tainted nodes
+func warmerTolerations(placements []*hubv1.Placement) []corev1.Toleration {
+	var tolerations []corev1.Toleration
+	for _, placement := range placements {
+		if placement == nil {
+			continue
+		}
+		for _, toleration := range placement.Tolerations {
+			found := false
+			for _, t := range tolerations {
+				if equality.Semantic.DeepEqual(t, toleration) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				tolerations = append(tolerations, toleration)
+			}
+		}
+	}
+	return tolerations
+}
+
+func (w *WarmerReconciler) warmerManifest(images, pullSecretNames []string, placements []*hubv1.Placement) *appsv1.DaemonSet {
+	labels := map[string]string{
+		name.IDLabel(): name.ImageWarmerName(),
+	}
+
+	// warm-up containers only run `true`, they should not reserve much of a node
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1m"),
+			corev1.ResourceMemory: resource.MustParse("4Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("50m"),
+			corev1.ResourceMemory: resource.MustParse("32Mi"),
+		},
+	}
+
+	mount := corev1.VolumeMount{
+		Name:      name.WarmerVolumeName(),
+		MountPath: name.WarmerVolumeMountPath(),
+	}
+
+	initContainers := []corev1.Container{
+		{
+			Name:            name.WarmerHelperContainerName(),
+			Image:           w.config.Runtime().Images.WarmerHelper,
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Command:         []string{"cp", "/bin/true", name.WarmerVolumeMountPath() + "/true"},
+			VolumeMounts:    []corev1.VolumeMount{mount},
+			Resources:       resources,
+		},
+	}
+	for i, img := range images {
+		initContainers = append(initContainers, corev1.Container{
+			Name:            name.WarmerContainerName(i),
+			Image:           img,
+			ImagePullPolicy: pullPolicy(img, corev1.PullAlways),
+			Command:         []string{name.WarmerVolumeMountPath() + "/true"},
+			VolumeMounts:    []corev1.VolumeMount{mount},
+			Resources:       resources,
+		})
+	}
+
+	secrets := make([]corev1.LocalObjectReference, 0)
+	for _, secretName := range pullSecretNames {
+		secrets = append(secrets, corev1.LocalObjectReference{Name: secretName})
+	}
+
+	automountToken := false
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.ImageWarmerName(),
+			Namespace: w.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					InitContainers: initContainers,
+					Containers: []corev1.Container{
+						{
+							Name:            name.WarmerPauseContainerName(),
+							Image:           w.config.Runtime().Images.WarmerPause,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Resources:       resources,
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: name.WarmerVolumeName(),
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+					NodeSelector:                 w.config.Runtime().ImageWarmerNodeSelector,
+					Affinity:                     warmerAffinity(placements),
+					Tolerations:                  warmerTolerations(placements),
+					ImagePullSecrets:             secrets,
+					AutomountServiceAccountToken: &automountToken,
+				},
+			},
+		},
+	}
+}
+
+func (w *WarmerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	isWarmer := predicate.NewPredicateFuncs(func(obj ctrlclient.Object) bool {
+		return obj.GetName() == name.ImageWarmerName() && obj.GetNamespace() == w.Namespace
+	})
+
+	// every change of a room may change the set of images, all of them map to the single warmer
+	toWarmer := handler.EnqueueRequestsFromMapFunc(func(_ ctrlclient.Object) []reconcile.Request {
+		return []reconcile.Request{
+			{NamespacedName: types.NamespacedName{Name: name.ImageWarmerName(), Namespace: w.Namespace}},
+		}
+	})
+
+	isWarmerPod := predicate.NewPredicateFuncs(func(obj ctrlclient.Object) bool {
+		return obj.GetLabels()[name.IDLabel()] == name.ImageWarmerName() && obj.GetNamespace() == w.Namespace
+	})
+
+	// status of nodes is updated frequently, only changes of their images matter
+	imagesChanged := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldNode, ok := e.ObjectOld.(*corev1.Node)
+			if !ok {
+				return false
+			}
+			newNode, ok := e.ObjectNew.(*corev1.Node)
+			if !ok {
+				return false
+			}
+			return !reflect.DeepEqual(oldNode.Status.Images, newNode.Status.Images)
+		},
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("image-warmer").
+		For(&appsv1.DaemonSet{}, builder.WithPredicates(isWarmer)).
+		Watches(&source.Kind{Type: &hubv1.Room{}}, toWarmer).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, toWarmer, builder.WithPredicates(isWarmerPod)).
+		Watches(&source.Kind{Type: &corev1.Node{}}, toWarmer, builder.WithPredicates(imagesChanged)).
+		Complete(w)
+}
+
+// roomImages returns the normalized images of every pod of the room
+func roomImages(room *hubv1.Room) []string {
+	images := make([]string, 0)
+	if img := gimulatorImage(room); img != "" {
+		images = append(images, image.Normalize(img))
+	}
+	if room.Spec.Director != nil && room.Spec.Director.Image != "" {
+		images = append(images, image.Normalize(room.Spec.Director.Image))
+	}
+	for _, actor := range room.Spec.Actors {
+		if actor.Image != "" {
+			images = append(images, image.Normalize(actor.Image))
+		}
+	}
+	return images
+}
+
+// isQueued returns true if pods of the room have not started yet
+func isQueued(room *hubv1.Room) bool {
+	if room.Status.GimulatorStatus != corev1.PodRunning {
+		return true
+	}
+	for _, actor := range room.Spec.Actors {
+		switch room.Status.ActorStatuses[actor.Name] {
+		case "", corev1.PodUnknown, corev1.PodPending:
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
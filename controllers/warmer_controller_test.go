@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// newFakeClient returns a client of an API server holding objs
+func newFakeClient(t *testing.T, objs ...ctrlclient.Object) *client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := hubv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.NewClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(), scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// prePullingRoom returns a queued room whose director image is pre-pulled
+func prePullingRoom(id, directorImage string, placement *hubv1.Placement) hubv1.Room {
+	return hubv1.Room{
+		ObjectMeta: metav1.ObjectMeta{Name: id, Namespace: hubconfig.Default().Namespace},
+		Spec: hubv1.RoomSpec{
+			ID:       id,
+			Director: &hubv1.Director{Name: "director", Image: directorImage},
+			Setting:  &hubv1.Setting{PrePullImages: true, Placement: placement},
+		},
+	}
+}
+
+func warmedImages(ds *appsv1.DaemonSet) []string {
+	images := make([]string, 0)
+	for _, container := range ds.Spec.Template.Spec.InitContainers[1:] {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+func TestReconcileDaemonSetBatchesUpdates(t *testing.T) {
+	config := hubconfig.New(hubconfig.Default())
+	c := newFakeClient(t)
+	w, err := NewWarmerReconciler(logr.Discard(), c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := types.NamespacedName{Name: name.ImageWarmerName(), Namespace: w.Namespace}
+	interval := config.Runtime().ImageWarmerUpdateInterval.Duration
+	now := time.Now().Truncate(time.Second)
+
+	rooms := &hubv1.RoomList{Items: []hubv1.Room{prePullingRoom("room-1", "director@sha256:1", nil)}}
+	if wait, err := w.reconcileDaemonSet(ctx, rooms, now); err != nil || wait != 0 {
+		t.Fatalf("reconcileDaemonSet() = %v, %v, the DaemonSet should be created at once", wait, err)
+	}
+
+	// the time of the last update is kept in the DaemonSet, so a restarted manager waits as well
+	if w, err = NewWarmerReconciler(logr.Discard(), c, config); err != nil {
+		t.Fatal(err)
+	}
+	rooms.Items = append(rooms.Items, prePullingRoom("room-2", "director@sha256:2", nil))
+	wait, err := w.reconcileDaemonSet(ctx, rooms, now.Add(interval/4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := interval * 3 / 4; wait != want {
+		t.Errorf("reconcileDaemonSet() wait = %v, want %v", wait, want)
+	}
+	ds, err := c.GetDaemonSet(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images := warmedImages(ds); len(images) != 1 {
+		t.Errorf("images = %v, the update should wait for the interval", images)
+	}
+
+	if wait, err := w.reconcileDaemonSet(ctx, rooms, now.Add(interval)); err != nil || wait != 0 {
+		t.Fatalf("reconcileDaemonSet() = %v, %v, the update should be applied after the interval", wait, err)
+	}
+	if ds, err = c.GetDaemonSet(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if images := warmedImages(ds); len(images) != 2 {
+		t.Errorf("images = %v, want the images of both rooms", images)
+	}
+
+	// an unchanged DaemonSet does not wait
+	if wait, err := w.reconcileDaemonSet(ctx, rooms, now.Add(interval)); err != nil || wait != 0 {
+		t.Errorf("reconcileDaemonSet() = %v, %v, nothing should change", wait, err)
+	}
+}
+
+func TestWarmImagesArePinned(t *testing.T) {
+	w, err := NewWarmerReconciler(logr.Discard(), newFakeClient(t), hubconfig.New(hubconfig.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rooms := &hubv1.RoomList{Items: []hubv1.Room{
+		prePullingRoom("room-1", "director@sha256:1", nil),
+		prePullingRoom("room-2", "missing:v1", nil),
+	}}
+	rooms.Items[0].Spec.Actors = []*hubv1.Actor{
+		{Name: "alice", Image: "alice@sha256:a"},
+		{Name: "bob", Image: "bob:latest"},
+	}
+
+	images, _, _ := w.warmImages(rooms)
+	if len(images) != 2 || images[0] != "alice@sha256:a" || images[1] != "director@sha256:1" {
+		t.Errorf("warmImages() = %v, want only the images pinned to a digest", images)
+	}
+}
+
+func TestWarmerAffinity(t *testing.T) {
+	poolA := &hubv1.Placement{NodeSelector: map[string]string{"pool": "a", "zone": "1"}}
+	poolB := &hubv1.Placement{NodeSelector: map[string]string{"pool": "b"}}
+
+	if affinity := warmerAffinity(nil); affinity != nil {
+		t.Errorf("warmerAffinity() of no rooms = %v, want nil", affinity)
+	}
+	if affinity := warmerAffinity([]*hubv1.Placement{poolA, nil}); affinity != nil {
+		t.Errorf("warmerAffinity() = %v, want nil if a room may run on every node", affinity)
+	}
+
+	affinity := warmerAffinity([]*hubv1.Placement{poolB, poolA, poolA})
+	if affinity == nil {
+		t.Fatal("warmerAffinity() = nil, want the nodes of both pools")
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 2 {
+		t.Fatalf("terms = %v, want a term of each distinct selector", terms)
+	}
+	if got := terms[0].MatchExpressions; len(got) != 2 || got[0].Key != "pool" || got[0].Values[0] != "a" || got[1].Key != "zone" {
+		t.Errorf("first term = %v, want pool=a and zone=1", got)
+	}
+	if got := terms[1].MatchExpressions; len(got) != 1 || got[0].Operator != corev1.NodeSelectorOpIn || got[0].Values[0] != "b" {
+		t.Errorf("second term = %v, want pool=b", got)
+	}
+}
+
+func TestReconcileWarmNodes(t *testing.T) {
+	config := hubconfig.New(hubconfig.Default())
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name.ImageCacheConfigMapName(), Namespace: config.Hub().Namespace},
+		Data: map[string]string{
+			"node-a": "docker.io/library/director:v1",
+			"node-b": "docker.io/library/other:v1",
+		},
+	}
+	c := newFakeClient(t, cm)
+	i, err := newImageReconciler(c, logr.Discard(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// rooms of tenant namespaces read the image cache of the manager namespace
+	room := prePullingRoom("room-1", "director:v1", nil)
+	room.Namespace = "tenant"
+	if err := i.reconcileWarmNodes(ctx, &room); err != nil {
+		t.Fatal(err)
+	}
+	if len(room.Status.WarmNodes) != 1 || room.Status.WarmNodes[0] != "node-a" || !room.Status.ImagesWarm {
+		t.Errorf("status = %v, %v, want node-a to be warm", room.Status.WarmNodes, room.Status.ImagesWarm)
+	}
+
+	// warm nodes are refreshed while the room is queued
+	cm.Data["node-b"] = "docker.io/library/director:v1"
+	if err := c.Update(ctx, cm); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.reconcileWarmNodes(ctx, &room); err != nil {
+		t.Fatal(err)
+	}
+	if len(room.Status.WarmNodes) != 2 {
+		t.Errorf("warm nodes = %v, want both nodes after the refresh", room.Status.WarmNodes)
+	}
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+	"github.com/Gimulator/hub/pkg/client"
+)
+
+// watchesNamespace returns true if rooms of namespace, and the PVCs they leave behind, are reconciled by the manager
+func watchesNamespace(ctx context.Context, c *client.Client, config *v1alpha1.HubConfig, namespace string) (bool, error) {
+	if !config.ClusterScoped {
+		if namespace == config.Namespace {
+			return true, nil
+		}
+		for _, watched := range config.WatchNamespaces {
+			if namespace == watched {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if config.NamespaceSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(config.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	ns, err := c.GetNamespace(ctx, namespace)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
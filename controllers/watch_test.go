@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+)
+
+func TestWatchesNamespace(t *testing.T) {
+	c := newFakeClient(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "labeled", Labels: map[string]string{"hub": "enabled"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled"}},
+	)
+
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"hub": "enabled"}}
+
+	tests := []struct {
+		name      string
+		config    v1alpha1.HubConfig
+		namespace string
+		want      bool
+	}{
+		{name: "manager namespace", config: v1alpha1.HubConfig{Namespace: "hub-system"}, namespace: "hub-system", want: true},
+		{name: "listed namespace", config: v1alpha1.HubConfig{Namespace: "hub-system", WatchNamespaces: []string{"labeled"}}, namespace: "labeled", want: true},
+		{name: "other namespace", config: v1alpha1.HubConfig{Namespace: "hub-system"}, namespace: "labeled", want: false},
+		{name: "cluster scoped", config: v1alpha1.HubConfig{ClusterScoped: true}, namespace: "unlabeled", want: true},
+		{name: "selected namespace", config: v1alpha1.HubConfig{ClusterScoped: true, NamespaceSelector: selector}, namespace: "labeled", want: true},
+		{name: "unselected namespace", config: v1alpha1.HubConfig{ClusterScoped: true, NamespaceSelector: selector}, namespace: "unlabeled", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := watchesNamespace(context.Background(), c, &tt.config, tt.namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("watchesNamespace(%q) = %v, want %v", tt.namespace, got, tt.want)
+			}
+		})
+	}
+
+	config := &v1alpha1.HubConfig{ClusterScoped: true, NamespaceSelector: selector}
+	if _, err := watchesNamespace(context.Background(), c, config, "missing"); err == nil {
+		t.Error("watchesNamespace() of a missing namespace should fail")
+	}
+}
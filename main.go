@@ -17,29 +17,43 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
-	"k8s.io/client-go/rest"
+	componentconfig "k8s.io/component-base/config/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
 
+	configv1alpha1 "github.com/Gimulator/hub/api/config/v1alpha1"
 	hubv1 "github.com/Gimulator/hub/api/v1"
 	"github.com/Gimulator/hub/controllers"
 	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/forward"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/logging"
 	"github.com/Gimulator/hub/pkg/mq"
 	"github.com/Gimulator/hub/pkg/reporter"
+	"github.com/Gimulator/hub/pkg/s3"
+	"github.com/Gimulator/hub/pkg/sharding"
+	"github.com/Gimulator/hub/pkg/tracing"
 	// +kubebuilder:scaffold:imports
 )
 
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
+
+	roomGroupKind = hubv1.GroupVersion.WithKind("Room").GroupKind().String()
 )
 
 func init() {
@@ -50,74 +64,231 @@ func init() {
 }
 
 func main() {
-	namespace := os.Getenv("HUB_NAMESPACE")
-	if namespace == "" {
-		namespace = "hub-system"
-	}
-
-	rabbitHost := os.Getenv("HUB_RABBIT_HOST")
-	rabbitUsername := os.Getenv("HUB_RABBIT_USERNAME")
-	rabbitPassword := os.Getenv("HUB_RABBIT_PASSWORD")
-	rabbitQueue := os.Getenv("HUB_RABBIT_RESULT_QUEUE")
-	token := os.Getenv("HUB_GIMULATOR_TOKEN")
-
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
+	var allowRoomNamespaces bool
+	var watchNamespaces string
+	var warmerNodeSelector string
+	var otlpEndpoint string
+	var local bool
+	var shards, shard int
+	var maxConcurrentReconciles int
+	var logOptions logging.Options
+	flag.StringVar(&configFile, "config", "",
+		"The HubConfig file the manager loads its configuration from. Defaults and environment variables are used if it is empty.")
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&allowRoomNamespaces, "allow-room-namespaces", false,
+		"Allow problems to run their rooms in ephemeral namespaces. Enabling this will make the manager watch all namespaces.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated namespaces whose rooms are reconciled besides the namespace of the manager.")
+	flag.StringVar(&warmerNodeSelector, "image-warmer-node-selector", "",
+		"Labels of the nodes that images of rooms are pre-pulled on, e.g. \"pool=matches\". All nodes are used if it is empty.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The address of the OTLP collector that traces are exported to, e.g. \"localhost:4317\". Tracing is disabled if it is empty.")
+	flag.IntVar(&shards, "shards", 0,
+		"The number of shards rooms are split between by a hash of their ID. Rooms are not sharded if it is less than two.")
+	flag.IntVar(&shard, "shard", 0,
+		"The shard of this replica. Replicas of a StatefulSet may leave it unset, their shard is the ordinal in their hostname.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 0,
+		"The number of rooms reconciled concurrently. The controller.groupKindConcurrency of the configuration is used if it is not set.")
+	flag.BoolVar(&local, "local", false,
+		"Run outside the cluster, keeping objects and results in local files instead of S3 and RabbitMQ and reaching Gimulators by port-forwarding.")
+	logOptions.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
-
-	resyncPeriod := time.Second * 60
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "fa842ee4.roboepics.com",
-		Namespace:          namespace,
-		SyncPeriod:         &resyncPeriod,
-	})
+	logger, err := logging.New(logOptions)
 	if err != nil {
-		setupLog.Error(err, "unable to start manager")
+		// the logger is not set yet
+		fmt.Fprintf(os.Stderr, "unable to setup logger: %v\n", err)
 		os.Exit(1)
 	}
+	ctrl.SetLogger(logger)
 
-	// Setting up RabbitMq
-	rabbit, err := mq.NewRabbit(rabbitHost, rabbitUsername, rabbitPassword, rabbitQueue)
+	warmerNodes, err := labels.ConvertSelectorToLabelsMap(warmerNodeSelector)
 	if err != nil {
-		setupLog.Error(err, "unable to create rabbit instance")
+		setupLog.Error(err, "invalid image warmer node selector")
 		os.Exit(1)
 	}
 
-	controllerClient, err := client.NewClient(mgr.GetClient(), mgr.GetScheme())
+	// flags set on the command line take precedence over the configuration file
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	overrideFromFlags := func(config *configv1alpha1.HubConfig) {
+		if set["metrics-addr"] {
+			config.Metrics.BindAddress = metricsAddr
+		}
+		if set["enable-leader-election"] {
+			if config.LeaderElection == nil {
+				config.LeaderElection = &componentconfig.LeaderElectionConfiguration{}
+			}
+			config.LeaderElection.LeaderElect = &enableLeaderElection
+		}
+		if set["allow-room-namespaces"] {
+			config.AllowRoomNamespaces = allowRoomNamespaces
+		}
+		if set["watch-namespaces"] {
+			config.WatchNamespaces = nil
+			if watchNamespaces != "" {
+				config.WatchNamespaces = strings.Split(watchNamespaces, ",")
+			}
+		}
+		if set["image-warmer-node-selector"] {
+			config.Runtime.ImageWarmerNodeSelector = warmerNodes
+		}
+		if set["otlp-endpoint"] {
+			config.OTLPEndpoint = otlpEndpoint
+		}
+		if set["shards"] {
+			config.Sharding.Shards = int32(shards)
+		}
+		if set["shard"] {
+			shard := int32(shard)
+			config.Sharding.Shard = &shard
+		}
+		if set["max-concurrent-reconciles"] {
+			if config.Controller == nil {
+				config.Controller = &cfg.ControllerConfigurationSpec{}
+			}
+			if config.Controller.GroupKindConcurrency == nil {
+				config.Controller.GroupKindConcurrency = make(map[string]int)
+			}
+			config.Controller.GroupKindConcurrency[roomGroupKind] = maxConcurrentReconciles
+		}
+		if local {
+			hubconfig.EnableLocal(config)
+		}
+	}
+
+	hubConfig, err := hubconfig.Load(configFile)
 	if err != nil {
-		setupLog.Error(err, "unable to create client instance")
+		setupLog.Error(err, "unable to load configuration")
+		os.Exit(1)
+	}
+	overrideFromFlags(hubConfig)
+	if hubConfig.Sharding.Shards > 1 && hubConfig.Sharding.Shard == nil {
+		shard, err := sharding.FromHostname()
+		if err != nil {
+			setupLog.Error(err, "unable to find shard of replica")
+			os.Exit(1)
+		}
+		hubConfig.Sharding.Shard = &shard
+	}
+	if err := hubconfig.Validate(hubConfig); err != nil {
+		setupLog.Error(err, "invalid configuration")
+		os.Exit(1)
+	}
+	config := hubconfig.New(hubConfig)
+	namespace := hubConfig.Namespace
+
+	shutdownTracing, err := tracing.Setup(context.Background(), hubConfig.OTLPEndpoint)
+	if err != nil {
+		setupLog.Error(err, "unable to setup tracing")
+		os.Exit(1)
+	}
+
+	if hubConfig.Local != nil {
+		err = s3.SetupLocal(hubConfig.Local.ObjectStoreDir)
+	} else {
+		err = s3.Setup(hubConfig.S3.URL, hubConfig.S3.AccessKey, hubConfig.S3.SecretKey)
+	}
+	if err != nil {
+		setupLog.Error(err, "unable to setup S3")
+		os.Exit(1)
+	}
+
+	// Rooms running in their own namespace can only be watched by a cluster-wide manager,
+	// which reconciles rooms of the watched namespaces only
+	managerOptions := ctrl.Options{Scheme: scheme}
+	switch {
+	case hubConfig.ClusterScoped || hubConfig.AllowRoomNamespaces:
+		// the cache watches all namespaces
+	case len(hubConfig.WatchNamespaces) > 0:
+		managerOptions.NewCache = cache.MultiNamespacedCacheBuilder(append([]string{namespace}, hubConfig.WatchNamespaces...))
+	default:
+		managerOptions.Namespace = namespace
+	}
+
+	options, err := managerOptions.AndFrom(hubConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to configure manager")
+		os.Exit(1)
+	}
+	// replicas of a shard elect their leader among themselves
+	if sharding.Enabled(hubConfig.Sharding) {
+		shard := sharding.Shard(hubConfig.Sharding)
+		options.LeaderElectionID = fmt.Sprintf("%s-shard-%d", options.LeaderElectionID, shard)
+		setupLog.Info("rooms are sharded", "shards", hubConfig.Sharding.Shards, "shard", shard)
+	}
+
+	// The manager and the client set share the config, which is read from --kubeconfig,
+	// $KUBECONFIG, the in-cluster config or ~/.kube/config in this order
+	restConfig := ctrl.GetConfigOrDie()
+
+	mgr, err := ctrl.NewManager(restConfig, options)
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	clientSetConfig, err := rest.InClusterConfig()
+	if configFile != "" {
+		watcher := &hubconfig.Watcher{
+			Config:   config,
+			Path:     configFile,
+			Log:      ctrl.Log.WithName("config"),
+			Interval: time.Second * 30,
+			Override: overrideFromFlags,
+		}
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch configuration file")
+			os.Exit(1)
+		}
+	}
+
+	// Setting up the result queue, RabbitMq or a file in local mode
+	var results mq.MessageQueue
+	if hubConfig.Local != nil {
+		results, err = mq.NewFileSink(ctrl.Log.WithName("results"), hubConfig.Local.ResultsFile)
+	} else {
+		results, err = mq.NewRabbit(ctrl.Log.WithName("rabbit"), hubConfig.Rabbit.Host, hubConfig.Rabbit.Username, hubConfig.Rabbit.Password)
+	}
 	if err != nil {
-		setupLog.Error(err, "unable to get client set config")
+		setupLog.Error(err, "unable to create result queue instance")
 		os.Exit(1)
 	}
 
-	clientSet, err := kubernetes.NewForConfig(clientSetConfig)
+	controllerClient, err := client.NewClient(mgr.GetClient(), mgr.GetScheme())
+	if err != nil {
+		setupLog.Error(err, "unable to create client instance")
+		os.Exit(1)
+	}
+
+	clientSet, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		setupLog.Error(err, "unable to initialize k8s client set")
 		os.Exit(1)
 	}
 
-	reporterObj, err := reporter.NewReporter(token, rabbit, controllerClient, clientSet)
+	// Services of rooms are not reachable from outside the cluster
+	var forwarder *forward.Forwarder
+	if hubConfig.Local != nil {
+		forwarder, err = forward.NewForwarder(restConfig, clientSet)
+		if err != nil {
+			setupLog.Error(err, "unable to create forwarder instance")
+			os.Exit(1)
+		}
+	}
+
+	reporterObj, err := reporter.NewReporter(config, results, controllerClient, clientSet, forwarder)
 	if err != nil {
 		setupLog.Error(err, "unable to create reporter instance")
 		os.Exit(1)
 	}
 
 	// Setting up room controller
-	roomReconciler, err := controllers.NewRoomReconciler(mgr, ctrl.Log.WithName("room-controller"), reporterObj, controllerClient, clientSet)
+	roomReconciler, err := controllers.NewRoomReconciler(mgr, ctrl.Log.WithName("room-controller"), reporterObj, controllerClient, clientSet, config)
 	if err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "room-controller")
 		os.Exit(1)
@@ -128,6 +299,46 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The image warmer, datasets and outputs are shared by rooms of all shards and
+	// are reconciled by the primary shard only, see sharding.IsPrimary
+	if sharding.IsPrimary(hubConfig.Sharding) {
+		// Setting up image warmer controller
+		warmerReconciler, err := controllers.NewWarmerReconciler(ctrl.Log.WithName("warmer-controller"), controllerClient, config)
+		if err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "warmer-controller")
+			os.Exit(1)
+		}
+
+		if err := warmerReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to setup controller", "controller", "warmer-controller")
+			os.Exit(1)
+		}
+
+		// Setting up dataset controller
+		datasetReconciler, err := controllers.NewDatasetReconciler(ctrl.Log.WithName("dataset-controller"), controllerClient, config)
+		if err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "dataset-controller")
+			os.Exit(1)
+		}
+
+		if err := datasetReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to setup controller", "controller", "dataset-controller")
+			os.Exit(1)
+		}
+
+		// Setting up output controller
+		outputReconciler, err := controllers.NewOutputReconciler(ctrl.Log.WithName("output-controller"), controllerClient, config)
+		if err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "output-controller")
+			os.Exit(1)
+		}
+
+		if err := outputReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to setup controller", "controller", "output-controller")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -135,4 +346,8 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "could not flush traces")
+	}
 }
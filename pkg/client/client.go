@@ -5,7 +5,10 @@ import (
 	"reflect"
 
 	hubv1 "github.com/Gimulator/hub/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -30,6 +33,16 @@ func NewClient(c client.Client, scheme *runtime.Scheme) (*Client, error) {
 	}, nil
 }
 
+// setOwner sets owner as the owner of obj. Owner references can not cross
+// namespaces, so objects living outside the namespace of their owner are left
+// without one and are removed along with their namespace instead.
+func (c *Client) setOwner(owner metav1.Object, obj metav1.Object) error {
+	if owner == nil || owner.GetNamespace() != obj.GetNamespace() {
+		return nil
+	}
+	return controllerutil.SetOwnerReference(owner, obj, c.Scheme)
+}
+
 ///////////////////////////////////////////////////
 ////////////////////////////////////////// Room ///
 ///////////////////////////////////////////////////
@@ -46,6 +59,7 @@ func (c *Client) SyncRoom(ctx context.Context, room *hubv1.Room) (*hubv1.Room, e
 	err := retry.RetryOnConflict(retry.DefaultBackoff,
 		func() error {
 			_, err := controllerutil.CreateOrUpdate(ctx, c.Client, syncedRoom, func() error {
+				syncedRoom.Finalizers = room.DeepCopy().Finalizers
 				syncedRoom.Status = *room.Status.DeepCopy()
 				syncedRoom.Spec = *room.Spec.DeepCopy()
 				return nil
@@ -96,10 +110,8 @@ func (c *Client) SyncPod(ctx context.Context, pod *corev1.Pod, owner metav1.Obje
 		syncedPod.Annotations = pod.DeepCopy().Annotations
 		syncedPod.Labels = pod.DeepCopy().Labels
 
-		if owner != nil {
-			if err := controllerutil.SetOwnerReference(owner, syncedPod, c.Scheme); err != nil {
-				return nil, err
-			}
+		if err := c.setOwner(owner, syncedPod); err != nil {
+			return nil, err
 		}
 
 		if err := c.Update(ctx, syncedPod); err != nil {
@@ -122,10 +134,8 @@ func (c *Client) GetPod(ctx context.Context, key types.NamespacedName) (*corev1.
 func (c *Client) CreatePod(ctx context.Context, pod *corev1.Pod, owner metav1.Object) (*corev1.Pod, error) {
 	syncedPod := pod.DeepCopy()
 
-	if owner != nil {
-		if err := controllerutil.SetOwnerReference(owner, syncedPod, c.Scheme); err != nil {
-			return nil, err
-		}
+	if err := c.setOwner(owner, syncedPod); err != nil {
+		return nil, err
 	}
 
 	err := c.Create(ctx, syncedPod)
@@ -166,10 +176,8 @@ func (c *Client) GetPVC(ctx context.Context, key types.NamespacedName) (*corev1.
 func (c *Client) CreatePVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim, owner metav1.Object) (*corev1.PersistentVolumeClaim, error) {
 	syncedPVC := pvc.DeepCopy()
 
-	if owner != nil {
-		if err := controllerutil.SetOwnerReference(owner, syncedPVC, c.Scheme); err != nil {
-			return nil, err
-		}
+	if err := c.setOwner(owner, syncedPVC); err != nil {
+		return nil, err
 	}
 
 	err := c.Create(ctx, syncedPVC)
@@ -214,10 +222,8 @@ func (c *Client) SyncService(ctx context.Context, service *corev1.Service, owner
 func (c *Client) CreateService(ctx context.Context, service *corev1.Service, owner metav1.Object) (*corev1.Service, error) {
 	syncedService := service.DeepCopy()
 
-	if owner != nil {
-		if err := controllerutil.SetOwnerReference(owner, syncedService, c.Scheme); err != nil {
-			return nil, err
-		}
+	if err := c.setOwner(owner, syncedService); err != nil {
+		return nil, err
 	}
 
 	err := c.Create(ctx, syncedService)
@@ -243,10 +249,8 @@ func (c *Client) SyncConfigMap(ctx context.Context, cm *corev1.ConfigMap, owner
 	if !reflect.DeepEqual(cm.Data, syncedCM.Data) {
 		syncedCM = cm.DeepCopy()
 
-		if owner != nil {
-			if err := controllerutil.SetOwnerReference(owner, syncedCM, c.Scheme); err != nil {
-				return nil, err
-			}
+		if err := c.setOwner(owner, syncedCM); err != nil {
+			return nil, err
 		}
 
 		if err := c.Update(ctx, syncedCM); err != nil {
@@ -265,12 +269,232 @@ func (c *Client) GetConfigMap(ctx context.Context, key types.NamespacedName) (*c
 func (c *Client) CreateConfigMap(ctx context.Context, cm *corev1.ConfigMap, owner metav1.Object) (*corev1.ConfigMap, error) {
 	syncedConfigMap := cm.DeepCopy()
 
-	if owner != nil {
-		if err := controllerutil.SetOwnerReference(owner, syncedConfigMap, c.Scheme); err != nil {
-			return nil, err
-		}
+	if err := c.setOwner(owner, syncedConfigMap); err != nil {
+		return nil, err
 	}
 
 	err := c.Create(ctx, syncedConfigMap)
 	return syncedConfigMap, err
 }
+
+//////////////////////////////////////////////////
+//////////////////////////////////// Namespace ///
+//////////////////////////////////////////////////
+
+// SyncNamespace takes a Namespace object and creates it if not exists
+func (c *Client) SyncNamespace(ctx context.Context, ns *corev1.Namespace) (*corev1.Namespace, error) {
+	syncedNS, err := c.GetNamespace(ctx, ns.Name)
+	if errors.IsNotFound(err) {
+		syncedNS = ns.DeepCopy()
+		err = c.Create(ctx, syncedNS)
+		return syncedNS, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return syncedNS, nil
+}
+
+// GetNamespace takes the name of a Namespace and returns the Namespace object if exists
+func (c *Client) GetNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	ns := &corev1.Namespace{}
+
+	return ns, c.Get(ctx, types.NamespacedName{Name: name}, ns)
+}
+
+// DeleteNamespace deletes a Namespace object
+func (c *Client) DeleteNamespace(ctx context.Context, ns *corev1.Namespace) error {
+	if err := c.Delete(ctx, ns); !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+//////////////////////////////////////////////////
+//////////////////////////////////////// Node ///
+//////////////////////////////////////////////////
+
+// GetNode takes name of a Node and returns the Node object if exists
+func (c *Client) GetNode(ctx context.Context, name string) (*corev1.Node, error) {
+	node := &corev1.Node{}
+
+	return node, c.Get(ctx, types.NamespacedName{Name: name}, node)
+}
+
+//////////////////////////////////////////////////
+/////////////////////////////// ResourceQuota ///
+//////////////////////////////////////////////////
+
+// SyncResourceQuota takes a ResourceQuota object and updates it or creates it if not exists
+func (c *Client) SyncResourceQuota(ctx context.Context, quota *corev1.ResourceQuota, owner metav1.Object) (*corev1.ResourceQuota, error) {
+	syncedQuota := &corev1.ResourceQuota{}
+	err := c.Get(ctx, types.NamespacedName{Name: quota.Name, Namespace: quota.Namespace}, syncedQuota)
+	if errors.IsNotFound(err) {
+		syncedQuota = quota.DeepCopy()
+		if err := c.setOwner(owner, syncedQuota); err != nil {
+			return nil, err
+		}
+		err = c.Create(ctx, syncedQuota)
+		return syncedQuota, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !reflect.DeepEqual(quota.Spec, syncedQuota.Spec) {
+		syncedQuota.Spec = *quota.Spec.DeepCopy()
+		if err := c.Update(ctx, syncedQuota); err != nil {
+			return nil, err
+		}
+	}
+	return syncedQuota, nil
+}
+
+//////////////////////////////////////////////////
+////////////////////////////////// LimitRange ///
+//////////////////////////////////////////////////
+
+// SyncLimitRange takes a LimitRange object and updates it or creates it if not exists
+func (c *Client) SyncLimitRange(ctx context.Context, limitRange *corev1.LimitRange, owner metav1.Object) (*corev1.LimitRange, error) {
+	syncedLimitRange := &corev1.LimitRange{}
+	err := c.Get(ctx, types.NamespacedName{Name: limitRange.Name, Namespace: limitRange.Namespace}, syncedLimitRange)
+	if errors.IsNotFound(err) {
+		syncedLimitRange = limitRange.DeepCopy()
+		if err := c.setOwner(owner, syncedLimitRange); err != nil {
+			return nil, err
+		}
+		err = c.Create(ctx, syncedLimitRange)
+		return syncedLimitRange, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !reflect.DeepEqual(limitRange.Spec, syncedLimitRange.Spec) {
+		syncedLimitRange.Spec = *limitRange.Spec.DeepCopy()
+		if err := c.Update(ctx, syncedLimitRange); err != nil {
+			return nil, err
+		}
+	}
+	return syncedLimitRange, nil
+}
+
+//////////////////////////////////////////////////
+/////////////////////////////////////// Secret ///
+//////////////////////////////////////////////////
+
+// SyncSecret takes a Secret object and updates it or creates it if not exists
+func (c *Client) SyncSecret(ctx context.Context, secret *corev1.Secret, owner metav1.Object) (*corev1.Secret, error) {
+	syncedSecret, err := c.GetSecret(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace})
+	if errors.IsNotFound(err) {
+		syncedSecret = secret.DeepCopy()
+		if err := c.setOwner(owner, syncedSecret); err != nil {
+			return nil, err
+		}
+		err = c.Create(ctx, syncedSecret)
+		return syncedSecret, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !reflect.DeepEqual(secret.Data, syncedSecret.Data) || secret.Type != syncedSecret.Type {
+		syncedSecret.Data = secret.DeepCopy().Data
+		syncedSecret.Type = secret.Type
+		if err := c.Update(ctx, syncedSecret); err != nil {
+			return nil, err
+		}
+	}
+	return syncedSecret, nil
+}
+
+// GetSecret takes a NamespacedName key and returns a Secret object if exists
+func (c *Client) GetSecret(ctx context.Context, key types.NamespacedName) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+
+	return secret, c.Get(ctx, key, secret)
+}
+
+// DeleteSecret deletes a Secret object, it is not an error if it does not exist
+func (c *Client) DeleteSecret(ctx context.Context, secret *corev1.Secret) error {
+	if err := c.Delete(ctx, secret); !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+//////////////////////////////////////////////////
+//////////////////////////////// NetworkPolicy ///
+//////////////////////////////////////////////////
+
+// SyncNetworkPolicy takes a NetworkPolicy object and updates it or creates it if not exists
+func (c *Client) SyncNetworkPolicy(ctx context.Context, policy *networkingv1.NetworkPolicy, owner metav1.Object) (*networkingv1.NetworkPolicy, error) {
+	syncedPolicy := &networkingv1.NetworkPolicy{}
+	err := c.Get(ctx, types.NamespacedName{Name: policy.Name, Namespace: policy.Namespace}, syncedPolicy)
+	if errors.IsNotFound(err) {
+		syncedPolicy = policy.DeepCopy()
+		if err := c.setOwner(owner, syncedPolicy); err != nil {
+			return nil, err
+		}
+		err = c.Create(ctx, syncedPolicy)
+		return syncedPolicy, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the API server defaults protocols of ports, so unset fields should not count as a change
+	if !equality.Semantic.DeepDerivative(policy.Spec, syncedPolicy.Spec) || !reflect.DeepEqual(policy.Labels, syncedPolicy.Labels) {
+		syncedPolicy.Labels = policy.DeepCopy().Labels
+		syncedPolicy.Spec = *policy.Spec.DeepCopy()
+		if err := c.Update(ctx, syncedPolicy); err != nil {
+			return nil, err
+		}
+	}
+	return syncedPolicy, nil
+}
+
+//////////////////////////////////////////////////
+//////////////////////////////////// DaemonSet ///
+//////////////////////////////////////////////////
+
+// SyncDaemonSet takes a DaemonSet object and updates it or creates it if not exists
+func (c *Client) SyncDaemonSet(ctx context.Context, ds *appsv1.DaemonSet, owner metav1.Object) (*appsv1.DaemonSet, error) {
+	syncedDS, err := c.GetDaemonSet(ctx, types.NamespacedName{Name: ds.Name, Namespace: ds.Namespace})
+	if errors.IsNotFound(err) {
+		syncedDS = ds.DeepCopy()
+		if err := c.setOwner(owner, syncedDS); err != nil {
+			return nil, err
+		}
+		err = c.Create(ctx, syncedDS)
+		return syncedDS, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the API server defaults most fields of pod templates, so unset fields should not count as a change
+	if !equality.Semantic.DeepDerivative(ds.Spec, syncedDS.Spec) || !reflect.DeepEqual(ds.Labels, syncedDS.Labels) {
+		syncedDS.Labels = ds.DeepCopy().Labels
+		syncedDS.Spec = *ds.Spec.DeepCopy()
+		if err := c.Update(ctx, syncedDS); err != nil {
+			return nil, err
+		}
+	}
+	return syncedDS, nil
+}
+
+// GetDaemonSet takes a NamespacedName key and returns a DaemonSet object if exists
+func (c *Client) GetDaemonSet(ctx context.Context, key types.NamespacedName) (*appsv1.DaemonSet, error) {
+	ds := &appsv1.DaemonSet{}
+
+	return ds, c.Get(ctx, key, ds)
+}
+
+// DeleteDaemonSet deletes a DaemonSet object
+func (c *Client) DeleteDaemonSet(ctx context.Context, ds *appsv1.DaemonSet) error {
+	if err := c.Delete(ctx, ds); !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -3,25 +3,22 @@ package config
 import (
 	"context"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	hubv1 "github.com/Gimulator/hub/api/v1"
-	"github.com/Gimulator/hub/pkg/cache"
 	"github.com/Gimulator/hub/pkg/name"
 	"github.com/Gimulator/hub/pkg/s3"
+	"github.com/Gimulator/hub/pkg/tracing"
 )
 
-func FetchRules(ctx context.Context, room *hubv1.Room) (string, error) {
-	str, err := cache.GetString(name.CacheKeyForRules(room.Spec.ProblemID))
-	if err == nil {
-		return str, nil
-	}
+func FetchRules(ctx context.Context, room *hubv1.Room, bucketPrefix string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "config.FetchRules", attribute.String("problem", room.Spec.ProblemID))
+	defer tracing.End(span, &err)
 
-	str, err = s3.GetString(ctx, name.S3RulesBucket(), name.S3RulesObjectName(room.Spec.ProblemID))
+	str, err := s3.GetString(ctx, name.S3RulesBucket(bucketPrefix), name.S3RulesObjectName(room.Spec.ProblemID))
 	if err != nil {
 		return "", err
 	}
 
-	// is it OK to ignore error of cache system?
-	cache.SetString(name.CacheKeyForRules(room.Spec.ProblemID), str)
-
 	return str, nil
 }
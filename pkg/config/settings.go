@@ -3,28 +3,30 @@ package config
 import (
 	"context"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	hubv1 "github.com/Gimulator/hub/api/v1"
-	"github.com/Gimulator/hub/pkg/cache"
 	"github.com/Gimulator/hub/pkg/name"
 	"github.com/Gimulator/hub/pkg/s3"
+	"github.com/Gimulator/hub/pkg/tracing"
 )
 
-func FetchSetting(ctx context.Context, room *hubv1.Room) error {
-	if room.Spec.Setting != nil {
-		return nil
-	}
+// FetchSetting sets the setting of the problem of room if it is not set. The setting is then kept
+// in the room itself, so it is fetched once per room whichever replica reconciles it. The setting is
+// read from the settings bucket with bucketPrefix, the prefix of the tenant of the room.
+func FetchSetting(ctx context.Context, room *hubv1.Room, bucketPrefix string) (err error) {
+	ctx, span := tracing.Start(ctx, "config.FetchSetting", attribute.String("problem", room.Spec.ProblemID))
+	defer tracing.End(span, &err)
 
-	if err := cache.GetStruct(name.CacheKeyForSetting(room.Spec.ProblemID), room.Spec.Setting); err == nil {
+	if room.Spec.Setting != nil {
 		return nil
 	}
 
 	setting := &hubv1.Setting{}
-	if err := s3.GetStruct(ctx, name.S3SettingBucket(), name.S3SettingObjectName(room.Spec.ProblemID), setting); err != nil {
+	if err := s3.GetStruct(ctx, name.S3SettingBucket(bucketPrefix), name.S3SettingObjectName(room.Spec.ProblemID), setting); err != nil {
 		return err
 	}
 	room.Spec.Setting = setting
 
-	cache.SetStruct(name.CacheKeyForSetting(room.Spec.ProblemID), room.Spec.Setting.DeepCopy())
-
 	return nil
 }
@@ -0,0 +1,90 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Forwarder connects to ports of pods through the API server, for a manager running
+// outside the cluster which can not reach services of rooms
+type Forwarder struct {
+	config    *rest.Config
+	clientSet *kubernetes.Clientset
+}
+
+// NewForwarder returns new instance of Forwarder
+func NewForwarder(config *rest.Config, clientSet *kubernetes.Clientset) (*Forwarder, error) {
+	return &Forwarder{
+		config:    config,
+		clientSet: clientSet,
+	}, nil
+}
+
+// Dial forwards a local port to port of the pod and connects to it. Closing the connection stops the forwarding.
+func (f *Forwarder) Dial(ctx context.Context, namespace, pod string, port int) (net.Conn, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(f.config)
+	if err != nil {
+		return nil, err
+	}
+
+	url := f.clientSet.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("portforward").URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stop, ready := make(chan struct{}), make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)}, stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-ready:
+	case err := <-failed:
+		return nil, fmt.Errorf("could not forward port %d of pod %s/%s: %v", port, namespace, pod, err)
+	case <-ctx.Done():
+		close(stop)
+		return nil, ctx.Err()
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		close(stop)
+		return nil, err
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Local))
+	if err != nil {
+		close(stop)
+		return nil, err
+	}
+	return &forwardedConn{Conn: conn, stop: stop}, nil
+}
+
+// forwardedConn stops its forwarding once it is closed
+type forwardedConn struct {
+	net.Conn
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func (c *forwardedConn) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,304 @@
+package hubconfig
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	componentconfig "k8s.io/component-base/config/v1alpha1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// Default returns the configuration the file and the environment variables override
+func Default() *v1alpha1.HubConfig {
+	syncPeriod := metav1.Duration{Duration: time.Minute}
+	leaderElect := false
+	webhookPort := 9443
+
+	return &v1alpha1.HubConfig{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       "HubConfig",
+		},
+		ControllerManagerConfigurationSpec: cfg.ControllerManagerConfigurationSpec{
+			SyncPeriod: &syncPeriod,
+			LeaderElection: &componentconfig.LeaderElectionConfiguration{
+				LeaderElect:  &leaderElect,
+				ResourceName: "fa842ee4.roboepics.com",
+			},
+			Metrics: cfg.ControllerMetrics{BindAddress: ":8080"},
+			Webhook: cfg.ControllerWebhook{Port: &webhookPort},
+		},
+		Namespace: "hub-system",
+		Rabbit: v1alpha1.RabbitConfig{
+			CredentialsSecret: "rabbit-credentials",
+		},
+		Gimulator: v1alpha1.GimulatorConfig{
+			Port: 23579,
+		},
+		Network: v1alpha1.NetworkConfig{
+			DNS: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{name.NamespaceNameLabel(): name.DNSNamespace()},
+					},
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{name.DNSPodLabel(): name.DNSPodLabelValue()},
+					},
+				},
+			},
+		},
+		RateLimiter: v1alpha1.RateLimiterConfig{
+			BaseDelay: metav1.Duration{Duration: time.Second},
+			MaxDelay:  metav1.Duration{Duration: 5 * time.Minute},
+			QPS:       50,
+			Burst:     300,
+		},
+		Runtime: v1alpha1.RuntimeConfig{
+			ReconcileTimeout: metav1.Duration{Duration: 20 * time.Second},
+			StepTimeout:      metav1.Duration{Duration: 10 * time.Second},
+			SandboxUserID:    2000,
+
+			ImageWarmerUpdateInterval: metav1.Duration{Duration: time.Minute},
+			SourceVolumeSize:          resource.MustParse("1Gi"),
+
+			ObjectStoreCredentialsDuration: metav1.Duration{Duration: 6 * time.Hour},
+			Images: v1alpha1.ImagesConfig{
+				Builder:           "gcr.io/kaniko-project/executor:v1.6.0",
+				Pusher:            "gcr.io/go-containerregistry/crane:debug",
+				SourceFetcher:     "busybox:1.33-musl",
+				ObjectStoreClient: "minio/mc:RELEASE.2021-06-13T17-48-22Z",
+				WarmerHelper:      "busybox:1.33-musl",
+				WarmerPause:       "k8s.gcr.io/pause:3.5",
+			},
+		},
+	}
+}
+
+// Config is the configuration of the manager. Its runtime section is replaced when the file
+// is reloaded, the rest is only read at startup.
+type Config struct {
+	hub     *v1alpha1.HubConfig
+	runtime atomic.Value
+}
+
+// New returns a Config of hub, which must not be modified afterwards
+func New(hub *v1alpha1.HubConfig) *Config {
+	config := &Config{hub: hub}
+	config.SetRuntime(hub.Runtime)
+	return config
+}
+
+// Hub returns the configuration read at startup, which must not be modified.
+// Its runtime section is not reloaded, Runtime returns the current one.
+func (c *Config) Hub() *v1alpha1.HubConfig {
+	return c.hub
+}
+
+// Runtime returns the current runtime section, which must not be modified
+func (c *Config) Runtime() *v1alpha1.RuntimeConfig {
+	return c.runtime.Load().(*v1alpha1.RuntimeConfig)
+}
+
+// SetRuntime makes runtime the current runtime section
+func (c *Config) SetRuntime(runtime v1alpha1.RuntimeConfig) {
+	c.runtime.Store(runtime.DeepCopy())
+}
+
+// TenantOf returns the defaults of rooms in namespace, which are empty if the namespace has none
+func (c *Config) TenantOf(namespace string) v1alpha1.TenantConfig {
+	for _, tenant := range c.hub.Tenants {
+		if tenant.Namespace == namespace {
+			return tenant
+		}
+	}
+	return v1alpha1.TenantConfig{Namespace: namespace}
+}
+
+// ResultQueue returns the queue results of rooms in namespace are published to
+func (c *Config) ResultQueue(namespace string) string {
+	if queue := c.TenantOf(namespace).ResultQueue; queue != "" {
+		return queue
+	}
+	return c.hub.Rabbit.ResultQueue
+}
+
+// BucketPrefix returns the prefix of the buckets of rooms in namespace
+func (c *Config) BucketPrefix(namespace string) string {
+	return c.TenantOf(namespace).BucketPrefix
+}
+
+// Load returns the default configuration overridden by the file at path, if path is not empty,
+// and then by the environment variables
+func Load(path string) (*v1alpha1.HubConfig, error) {
+	config := Default()
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(content, config); err != nil {
+			return nil, fmt.Errorf("could not decode %s: %v", path, err)
+		}
+		if gvk := config.GroupVersionKind(); gvk != v1alpha1.GroupVersion.WithKind("HubConfig") {
+			return nil, fmt.Errorf("%s is %v, expected HubConfig of %v", path, gvk, v1alpha1.GroupVersion)
+		}
+	}
+
+	overrideFromEnv(config)
+	if config.Local != nil {
+		EnableLocal(config)
+	}
+	return config, nil
+}
+
+// EnableLocal turns on the local mode of config, filling the unset local fields with their defaults
+func EnableLocal(config *v1alpha1.HubConfig) {
+	if config.Local == nil {
+		config.Local = &v1alpha1.LocalConfig{}
+	}
+	if config.Local.ObjectStoreDir == "" {
+		config.Local.ObjectStoreDir = "hub-local/objects"
+	}
+	if config.Local.ResultsFile == "" {
+		config.Local.ResultsFile = "hub-local/results.jsonl"
+	}
+}
+
+// overrideFromEnv sets the fields whose environment variables are set. Credentials are
+// usually passed this way, from secrets.
+func overrideFromEnv(config *v1alpha1.HubConfig) {
+	for env, field := range map[string]*string{
+		"HUB_NAMESPACE":           &config.Namespace,
+		"HUB_RABBIT_HOST":         &config.Rabbit.Host,
+		"HUB_RABBIT_USERNAME":     &config.Rabbit.Username,
+		"HUB_RABBIT_PASSWORD":     &config.Rabbit.Password,
+		"HUB_RABBIT_RESULT_QUEUE": &config.Rabbit.ResultQueue,
+		"HUB_S3_URL":              &config.S3.URL,
+		"HUB_S3_ACCESS_KEY":       &config.S3.AccessKey,
+		"HUB_S3_SECRET_KEY":       &config.S3.SecretKey,
+		"HUB_GIMULATOR_TOKEN":     &config.Gimulator.Token,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+}
+
+// Validate returns an error describing the first invalid field of config
+func Validate(config *v1alpha1.HubConfig) error {
+	type field struct {
+		field string
+		value string
+	}
+	required := []field{
+		{"namespace", config.Namespace},
+		{"rabbit.credentialsSecret", config.Rabbit.CredentialsSecret},
+		{"gimulator.token", config.Gimulator.Token},
+		{"runtime.images.builder", config.Runtime.Images.Builder},
+		{"runtime.images.pusher", config.Runtime.Images.Pusher},
+		{"runtime.images.sourceFetcher", config.Runtime.Images.SourceFetcher},
+		{"runtime.images.objectStoreClient", config.Runtime.Images.ObjectStoreClient},
+		{"runtime.images.warmerHelper", config.Runtime.Images.WarmerHelper},
+		{"runtime.images.warmerPause", config.Runtime.Images.WarmerPause},
+	}
+	if config.Local != nil {
+		required = append(required,
+			field{"local.objectStoreDir", config.Local.ObjectStoreDir},
+			field{"local.resultsFile", config.Local.ResultsFile},
+		)
+	} else {
+		required = append(required,
+			field{"rabbit.host", config.Rabbit.Host},
+			field{"rabbit.username", config.Rabbit.Username},
+			field{"rabbit.password", config.Rabbit.Password},
+			field{"rabbit.resultQueue", config.Rabbit.ResultQueue},
+			field{"s3.url", config.S3.URL},
+			field{"s3.accessKey", config.S3.AccessKey},
+			field{"s3.secretKey", config.S3.SecretKey},
+		)
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return fmt.Errorf("%s is required", r.field)
+		}
+	}
+
+	// an empty peer list would allow DNS to every address
+	if len(config.Network.DNS) == 0 {
+		return fmt.Errorf("network.dns is required")
+	}
+
+	// rooms in their own namespace need a cluster-wide cache, the namespace field is used otherwise
+	if config.CacheNamespace != "" {
+		return fmt.Errorf("cacheNamespace is not supported, the manager watches its namespace")
+	}
+	for _, namespace := range config.WatchNamespaces {
+		if namespace == "" {
+			return fmt.Errorf("watchNamespaces can not contain an empty namespace")
+		}
+	}
+	if config.NamespaceSelector != nil {
+		if !config.ClusterScoped {
+			return fmt.Errorf("namespaceSelector is only used by a clusterScoped manager")
+		}
+		if _, err := metav1.LabelSelectorAsSelector(config.NamespaceSelector); err != nil {
+			return fmt.Errorf("invalid namespaceSelector: %v", err)
+		}
+	}
+	tenants := make(map[string]bool)
+	for _, tenant := range config.Tenants {
+		if tenant.Namespace == "" {
+			return fmt.Errorf("tenants.namespace is required")
+		}
+		if tenants[tenant.Namespace] {
+			return fmt.Errorf("tenant of namespace %s is repeated", tenant.Namespace)
+		}
+		tenants[tenant.Namespace] = true
+	}
+	if shards := config.Sharding.Shards; shards > 1 {
+		if config.Sharding.Shard == nil {
+			return fmt.Errorf("sharding.shard is required")
+		}
+		if shard := *config.Sharding.Shard; shard < 0 || shard >= shards {
+			return fmt.Errorf("sharding.shard %d is not in [0, %d)", shard, shards)
+		}
+	}
+	if config.LeaderElection == nil {
+		return fmt.Errorf("leaderElection is required")
+	}
+	if config.Gimulator.Port <= 0 || config.Gimulator.Port > 65535 {
+		return fmt.Errorf("gimulator.port %d is not a valid port", config.Gimulator.Port)
+	}
+	if config.Runtime.ReconcileTimeout.Duration <= 0 {
+		return fmt.Errorf("runtime.reconcileTimeout must be positive")
+	}
+	if step := config.Runtime.StepTimeout.Duration; step <= 0 || step > config.Runtime.ReconcileTimeout.Duration {
+		return fmt.Errorf("runtime.stepTimeout must be positive and at most runtime.reconcileTimeout")
+	}
+	if limiter := config.RateLimiter; limiter.BaseDelay.Duration <= 0 || limiter.MaxDelay.Duration < limiter.BaseDelay.Duration {
+		return fmt.Errorf("rateLimiter.baseDelay must be positive and at most rateLimiter.maxDelay")
+	}
+	if config.RateLimiter.QPS <= 0 || config.RateLimiter.Burst <= 0 {
+		return fmt.Errorf("rateLimiter.qps and rateLimiter.burst must be positive")
+	}
+	if config.Runtime.SandboxUserID <= 0 {
+		return fmt.Errorf("runtime.sandboxUserID must be a non-root user")
+	}
+	if config.Runtime.SourceVolumeSize.Sign() <= 0 {
+		return fmt.Errorf("runtime.sourceVolumeSize must be positive")
+	}
+	if config.Runtime.ObjectStoreCredentialsDuration.Duration < 15*time.Minute {
+		return fmt.Errorf("runtime.objectStoreCredentialsDuration must be at least 15m, the shortest lifetime of credentials of the STS API")
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package hubconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+)
+
+// valid returns a configuration passing Validate
+func valid() *v1alpha1.HubConfig {
+	config := Default()
+	config.Rabbit.Host = "rabbit:5672"
+	config.Rabbit.Username = "hub"
+	config.Rabbit.Password = "password"
+	config.Rabbit.ResultQueue = "results"
+	config.S3.URL = "http://minio:9000"
+	config.S3.AccessKey = "access"
+	config.S3.SecretKey = "secret"
+	config.Gimulator.Token = "token"
+	return config
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hub_config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `apiVersion: config.hub.roboepics.com/v1alpha1
+kind: HubConfig
+namespace: from-file
+rabbit:
+  host: file:5672
+  resultQueue: file-results
+runtime:
+  stepTimeout: 5s
+`)
+	t.Setenv("HUB_NAMESPACE", "from-env")
+	t.Setenv("HUB_RABBIT_HOST", "")
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Namespace != "from-env" {
+		t.Errorf("namespace = %q, the environment should take precedence over the file", config.Namespace)
+	}
+	if config.Rabbit.Host != "file:5672" {
+		t.Errorf("rabbit.host = %q, an empty environment variable should not override the file", config.Rabbit.Host)
+	}
+	if config.Runtime.StepTimeout.Duration != 5*time.Second {
+		t.Errorf("runtime.stepTimeout = %v, the file should take precedence over the default", config.Runtime.StepTimeout.Duration)
+	}
+	if config.Runtime.ReconcileTimeout.Duration != Default().Runtime.ReconcileTimeout.Duration {
+		t.Errorf("runtime.reconcileTimeout = %v, fields missing from the file should keep their default", config.Runtime.ReconcileTimeout.Duration)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			name:    "unknown field",
+			content: "apiVersion: config.hub.roboepics.com/v1alpha1\nkind: HubConfig\nnamespaces: hub\n",
+			err:     "could not decode",
+		},
+		{
+			name:    "wrong kind",
+			content: "apiVersion: config.hub.roboepics.com/v1alpha1\nkind: Room\n",
+			err:     "expected HubConfig",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() error = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file should fail")
+	}
+}
+
+func TestLoadLocal(t *testing.T) {
+	config, err := Load(writeConfig(t, "apiVersion: config.hub.roboepics.com/v1alpha1\nkind: HubConfig\nlocal: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Local == nil || config.Local.ObjectStoreDir == "" || config.Local.ResultsFile == "" {
+		t.Errorf("local = %+v, its unset fields should get their defaults", config.Local)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	shard := int32(3)
+
+	tests := []struct {
+		name   string
+		modify func(*v1alpha1.HubConfig)
+		err    string
+	}{
+		{
+			name:   "valid",
+			modify: func(*v1alpha1.HubConfig) {},
+		},
+		{
+			name:   "missing credentials",
+			modify: func(c *v1alpha1.HubConfig) { c.S3.SecretKey = "" },
+			err:    "s3.secretKey is required",
+		},
+		{
+			name: "local mode needs no credentials",
+			modify: func(c *v1alpha1.HubConfig) {
+				c.Rabbit = v1alpha1.RabbitConfig{CredentialsSecret: "rabbit-credentials"}
+				c.S3 = v1alpha1.S3Config{}
+				EnableLocal(c)
+			},
+		},
+		{
+			name:   "DNS open to every address",
+			modify: func(c *v1alpha1.HubConfig) { c.Network.DNS = nil },
+			err:    "network.dns is required",
+		},
+		{
+			name:   "empty source volume",
+			modify: func(c *v1alpha1.HubConfig) { c.Runtime.SourceVolumeSize = resource.Quantity{} },
+			err:    "runtime.sourceVolumeSize must be positive",
+		},
+		{
+			name: "repeated tenant",
+			modify: func(c *v1alpha1.HubConfig) {
+				c.Tenants = []v1alpha1.TenantConfig{{Namespace: "a"}, {Namespace: "a"}}
+			},
+			err: "repeated",
+		},
+		{
+			name:   "shard out of range",
+			modify: func(c *v1alpha1.HubConfig) { c.Sharding = v1alpha1.ShardingConfig{Shards: 3, Shard: &shard} },
+			err:    "is not in [0, 3)",
+		},
+		{
+			name:   "step timeout longer than reconcile timeout",
+			modify: func(c *v1alpha1.HubConfig) { c.Runtime.StepTimeout.Duration = time.Minute },
+			err:    "runtime.stepTimeout",
+		},
+		{
+			name:   "object store credentials shorter than the STS API issues",
+			modify: func(c *v1alpha1.HubConfig) { c.Runtime.ObjectStoreCredentialsDuration.Duration = time.Minute },
+			err:    "runtime.objectStoreCredentialsDuration",
+		},
+		{
+			name:   "root sandbox user",
+			modify: func(c *v1alpha1.HubConfig) { c.Runtime.SandboxUserID = 0 },
+			err:    "non-root",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid()
+			tt.modify(config)
+
+			err := Validate(config)
+			if tt.err == "" && err != nil {
+				t.Errorf("Validate() error = %v, want none", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Validate() error = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	hub := valid()
+	hub.Tenants = []v1alpha1.TenantConfig{
+		{Namespace: "tenant-a", ResultQueue: "a-results", BucketPrefix: "a-"},
+		{Namespace: "tenant-b"},
+	}
+	config := New(hub)
+
+	tests := []struct {
+		namespace   string
+		resultQueue string
+		prefix      string
+	}{
+		{namespace: "tenant-a", resultQueue: "a-results", prefix: "a-"},
+		{namespace: "tenant-b", resultQueue: "results", prefix: ""},
+		{namespace: "other", resultQueue: "results", prefix: ""},
+	}
+	for _, tt := range tests {
+		if got := config.ResultQueue(tt.namespace); got != tt.resultQueue {
+			t.Errorf("ResultQueue(%q) = %q, want %q", tt.namespace, got, tt.resultQueue)
+		}
+		if got := config.BucketPrefix(tt.namespace); got != tt.prefix {
+			t.Errorf("BucketPrefix(%q) = %q, want %q", tt.namespace, got, tt.prefix)
+		}
+		if got := config.TenantOf(tt.namespace).Namespace; got != tt.namespace {
+			t.Errorf("TenantOf(%q).Namespace = %q", tt.namespace, got)
+		}
+	}
+
+	runtime := hub.Runtime
+	runtime.SandboxUserID = 3000
+	config.SetRuntime(runtime)
+	if got := config.Runtime().SandboxUserID; got != 3000 {
+		t.Errorf("Runtime().SandboxUserID = %d after SetRuntime, want 3000", got)
+	}
+	if got := config.Hub().Runtime.SandboxUserID; got != Default().Runtime.SandboxUserID {
+		t.Errorf("Hub().Runtime.SandboxUserID = %d, SetRuntime should not modify the startup configuration", got)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	path := writeConfig(t, `apiVersion: config.hub.roboepics.com/v1alpha1
+kind: HubConfig
+namespace: reloaded
+runtime:
+  sandboxUserID: 3000
+  imageWarmerNodeSelector:
+    pool: file
+`)
+	// the credentials of valid() are passed by the environment
+	t.Setenv("HUB_RABBIT_HOST", "rabbit:5672")
+	t.Setenv("HUB_RABBIT_USERNAME", "hub")
+	t.Setenv("HUB_RABBIT_PASSWORD", "password")
+	t.Setenv("HUB_RABBIT_RESULT_QUEUE", "results")
+	t.Setenv("HUB_S3_URL", "http://minio:9000")
+	t.Setenv("HUB_S3_ACCESS_KEY", "access")
+	t.Setenv("HUB_S3_SECRET_KEY", "secret")
+	t.Setenv("HUB_GIMULATOR_TOKEN", "token")
+
+	config := New(valid())
+	watcher := &Watcher{
+		Config: config,
+		Path:   path,
+		Override: func(c *v1alpha1.HubConfig) {
+			c.Runtime.ImageWarmerNodeSelector = map[string]string{"pool": "flag"}
+		},
+	}
+	if err := watcher.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := config.Runtime().SandboxUserID; got != 3000 {
+		t.Errorf("Runtime().SandboxUserID = %d, want the reloaded 3000", got)
+	}
+	if got := config.Runtime().ImageWarmerNodeSelector["pool"]; got != "flag" {
+		t.Errorf("node selector pool = %q, flags should take precedence over the reloaded file", got)
+	}
+	if got := config.Hub().Namespace; got != "hub-system" {
+		t.Errorf("Hub().Namespace = %q, only the runtime section should be reloaded", got)
+	}
+}
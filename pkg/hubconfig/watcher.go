@@ -0,0 +1,81 @@
+package hubconfig
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+)
+
+// Watcher reloads the runtime section of the configuration when the file changes. The rest
+// of the configuration is only read at startup, since changing it needs a restart of the manager.
+type Watcher struct {
+	Config   *Config
+	Path     string
+	Log      logr.Logger
+	Interval time.Duration
+
+	// Override applies the flags to the reloaded configuration, so they keep precedence over the file
+	Override func(*v1alpha1.HubConfig)
+}
+
+// Start polls the file until ctx is done. Files mounted from config maps are replaced rather than
+// written to, so their content is compared instead of watching them.
+func (w *Watcher) Start(ctx context.Context) error {
+	last, err := os.ReadFile(w.Path)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		content, err := os.ReadFile(w.Path)
+		if err != nil {
+			w.Log.Error(err, "could not read configuration file")
+			continue
+		}
+		if bytes.Equal(content, last) {
+			continue
+		}
+		last = content
+
+		w.Log.Info("starting to reload configuration")
+		if err := w.reload(); err != nil {
+			w.Log.Error(err, "could not reload configuration, keeping the current one")
+		}
+	}
+}
+
+// reload makes the runtime section of the file current, if the whole file is valid
+func (w *Watcher) reload() error {
+	loaded, err := Load(w.Path)
+	if err != nil {
+		return err
+	}
+	if w.Override != nil {
+		w.Override(loaded)
+	}
+	if err := Validate(loaded); err != nil {
+		return err
+	}
+
+	w.Config.SetRuntime(loaded.Runtime)
+	return nil
+}
+
+// NeedLeaderElection returns false since every replica uses the configuration
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,41 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+// CheckPolicy returns an error describing why the image violates the policy, or nil if it does not
+func CheckPolicy(image string, policy *hubv1.ImagePolicy) error {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return err
+	}
+
+	if policy == nil {
+		return nil
+	}
+
+	if policy.RequireDigest && ref.Digest == "" && !policy.ResolveDigests {
+		return fmt.Errorf("image %s is not pinned to a digest", image)
+	}
+
+	if len(policy.AllowedRepositories) == 0 {
+		return nil
+	}
+	for _, prefix := range policy.AllowedRepositories {
+		if inRepository(ref.Name(), prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s is not in the allowed repositories", image)
+}
+
+// inRepository reports whether name is the repository prefix or below it,
+// so "docker.io/roboepics" does not allow "docker.io/roboepics-evil/image"
+func inRepository(name, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return name == prefix || strings.HasPrefix(name, prefix+"/")
+}
@@ -0,0 +1,42 @@
+package image
+
+import (
+	"testing"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	allowed := &hubv1.ImagePolicy{AllowedRepositories: []string{"docker.io/roboepics", "ghcr.io/org/"}}
+
+	tests := []struct {
+		name   string
+		image  string
+		policy *hubv1.ImagePolicy
+		err    bool
+	}{
+		{name: "no policy", image: "ubuntu"},
+		{name: "invalid image", image: "Ubuntu", err: true},
+		{name: "allowed repository", image: "roboepics/agent", policy: allowed},
+		{name: "allowed repository itself", image: "ghcr.io/org", policy: allowed},
+		{name: "allowed repository with a trailing slash", image: "ghcr.io/org/agent:v1", policy: allowed},
+		{name: "nested repository", image: "ghcr.io/org/team/agent", policy: allowed},
+		{name: "sibling with the same prefix", image: "roboepics-evil/agent", policy: allowed, err: true},
+		{name: "sibling of a prefix with a trailing slash", image: "ghcr.io/organization/agent", policy: allowed, err: true},
+		{name: "other registry", image: "quay.io/roboepics/agent", policy: allowed, err: true},
+		{name: "digest required", image: "ubuntu:20.04", policy: &hubv1.ImagePolicy{RequireDigest: true}, err: true},
+		{name: "digest present", image: "ubuntu@sha256:abc", policy: &hubv1.ImagePolicy{RequireDigest: true}},
+		{name: "digest resolved", image: "ubuntu:20.04", policy: &hubv1.ImagePolicy{RequireDigest: true, ResolveDigests: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPolicy(tt.image, tt.policy)
+			if tt.err && err == nil {
+				t.Errorf("CheckPolicy(%q) = nil, want an error", tt.image)
+			}
+			if !tt.err && err != nil {
+				t.Errorf("CheckPolicy(%q) error = %v, want none", tt.image, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package image
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+	defaultTag        = "latest"
+)
+
+// Reference is a parsed container image reference
+type Reference struct {
+	Domain     string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference the way docker does,
+// e.g. "ubuntu" becomes "docker.io/library/ubuntu:latest"
+func ParseReference(image string) (*Reference, error) {
+	if image == "" || strings.ContainsAny(image, " \t\n") {
+		return nil, fmt.Errorf("invalid image name %q", image)
+	}
+
+	ref := &Reference{}
+	rest := image
+
+	if i := strings.Index(rest, "@"); i >= 0 {
+		ref.Digest = rest[i+1:]
+		rest = rest[:i]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return nil, fmt.Errorf("invalid digest in image name %q", image)
+		}
+	}
+
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.Contains(rest[i:], "/") {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Domain = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Domain = dockerHubDomain
+		ref.Repository = rest
+	}
+	if ref.Domain == dockerHubDomain && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if ref.Repository == "" || ref.Repository != strings.ToLower(ref.Repository) {
+		return nil, fmt.Errorf("invalid repository in image name %q", image)
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+
+	return ref, nil
+}
+
+// Name returns the domain and the repository of the image
+func (r *Reference) Name() string {
+	return r.Domain + "/" + r.Repository
+}
+
+// String returns the fully qualified reference, preferring the digest over the tag
+func (r *Reference) String() string {
+	if r.Digest != "" {
+		return r.Name() + "@" + r.Digest
+	}
+	return r.Name() + ":" + r.Tag
+}
+
+// registryHost returns the host serving the registry API of the image
+func (r *Reference) registryHost() string {
+	if r.Domain == dockerHubDomain {
+		return dockerHubRegistry
+	}
+	return r.Domain
+}
+
+// RegistryPort returns the port the registry of an image is served on, 443 unless its domain has one
+func RegistryPort(image string) (int, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return 0, err
+	}
+	if _, port, err := net.SplitHostPort(ref.Domain); err == nil {
+		return strconv.Atoi(port)
+	}
+	return 443, nil
+}
+
+// Normalize returns the fully qualified form of an image, so different spellings
+// of the same image compare equal. Invalid images are returned as they are.
+func Normalize(image string) string {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return image
+	}
+	return ref.String()
+}
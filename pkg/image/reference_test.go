@@ -0,0 +1,86 @@
+package image
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		image string
+		want  Reference
+		err   bool
+	}{
+		{image: "ubuntu", want: Reference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{image: "ubuntu:20.04", want: Reference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "20.04"}},
+		{image: "roboepics/agent", want: Reference{Domain: "docker.io", Repository: "roboepics/agent", Tag: "latest"}},
+		{image: "docker.io/ubuntu", want: Reference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{image: "ghcr.io/org/agent:v1", want: Reference{Domain: "ghcr.io", Repository: "org/agent", Tag: "v1"}},
+		{image: "localhost/agent", want: Reference{Domain: "localhost", Repository: "agent", Tag: "latest"}},
+		{image: "registry:5000/agent:v1", want: Reference{Domain: "registry:5000", Repository: "agent", Tag: "v1"}},
+		{image: "registry:5000/agent", want: Reference{Domain: "registry:5000", Repository: "agent", Tag: "latest"}},
+		{image: "ubuntu@" + digest, want: Reference{Domain: "docker.io", Repository: "library/ubuntu", Digest: digest}},
+		{image: "ubuntu:20.04@" + digest, want: Reference{Domain: "docker.io", Repository: "library/ubuntu", Tag: "20.04", Digest: digest}},
+		{image: "", err: true},
+		{image: "ubuntu latest", err: true},
+		{image: "Ubuntu", err: true},
+		{image: "ubuntu@md5:abc", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := ParseReference(tt.image)
+			if tt.err {
+				if err == nil {
+					t.Errorf("ParseReference(%q) = %+v, want an error", tt.image, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseReference(%q) error = %v", tt.image, err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseReference(%q) = %+v, want %+v", tt.image, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "ubuntu", want: "docker.io/library/ubuntu:latest"},
+		{image: "library/ubuntu:latest", want: "docker.io/library/ubuntu:latest"},
+		{image: "docker.io/library/ubuntu", want: "docker.io/library/ubuntu:latest"},
+		{image: "ghcr.io/org/agent:v1", want: "ghcr.io/org/agent:v1"},
+		{image: "ubuntu:20.04@sha256:abc", want: "docker.io/library/ubuntu@sha256:abc"},
+		{image: "Invalid Image", want: "Invalid Image"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.image); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryPort(t *testing.T) {
+	tests := map[string]int{
+		"ubuntu":                        443,
+		"registry.example.com/subs/cpp": 443,
+		"localhost:5000/cpp":            5000,
+		"registry.example.com:8443/cpp": 8443,
+	}
+	for image, want := range tests {
+		got, err := RegistryPort(image)
+		if err != nil {
+			t.Errorf("RegistryPort(%q) error = %v", image, err)
+		} else if got != want {
+			t.Errorf("RegistryPort(%q) = %d, want %d", image, got, want)
+		}
+	}
+	if _, err := RegistryPort("Invalid Image"); err == nil {
+		t.Error("RegistryPort() of an invalid image should fail")
+	}
+}
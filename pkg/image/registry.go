@@ -0,0 +1,277 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	// ResolveTimeout is the maximum time spent resolving a single image
+	ResolveTimeout = time.Second * 10
+
+	manifestMediaTypes = []string{
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.docker.distribution.manifest.v2+json",
+		"application/vnd.oci.image.index.v1+json",
+		"application/vnd.oci.image.manifest.v1+json",
+	}
+)
+
+// StatusError is returned when a registry refuses to serve the manifest of an image
+type StatusError struct {
+	Image      string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("could not resolve image %s: registry responded with %s", e.Image, e.Status)
+}
+
+// IsNotFound reports whether the registry has no such image
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether the registry refused the credentials, or asked for missing ones
+func IsUnauthorized(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden)
+}
+
+// credential is a username and password for a registry
+type credential struct {
+	Username string
+	Password string
+}
+
+// Keychain holds credentials of registries read from image pull secrets
+type Keychain struct {
+	credentials map[string]credential
+}
+
+// NewKeychain reads the credentials of dockerconfigjson and dockercfg secrets
+func NewKeychain(secrets ...*corev1.Secret) (*Keychain, error) {
+	keychain := &Keychain{credentials: make(map[string]credential)}
+
+	type auth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+
+	for _, secret := range secrets {
+		auths := make(map[string]auth)
+		switch secret.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			config := struct {
+				Auths map[string]auth `json:"auths"`
+			}{}
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+				return nil, fmt.Errorf("could not parse secret %s: %w", secret.Name, err)
+			}
+			auths = config.Auths
+		case corev1.SecretTypeDockercfg:
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+				return nil, fmt.Errorf("could not parse secret %s: %w", secret.Name, err)
+			}
+		default:
+			continue
+		}
+
+		for server, a := range auths {
+			cred := credential{Username: a.Username, Password: a.Password}
+			if a.Auth != "" {
+				decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+				if err != nil {
+					return nil, fmt.Errorf("could not decode auth of %s in secret %s: %w", server, secret.Name, err)
+				}
+				if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+					cred = credential{Username: parts[0], Password: parts[1]}
+				}
+			}
+			keychain.credentials[registryOfServer(server)] = cred
+		}
+	}
+
+	return keychain, nil
+}
+
+// registryOfServer normalizes server addresses of docker configs, e.g. "https://index.docker.io/v1/"
+func registryOfServer(server string) string {
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	server = strings.SplitN(server, "/", 2)[0]
+	if server == "index.docker.io" || server == dockerHubDomain {
+		return dockerHubRegistry
+	}
+	return server
+}
+
+func (k *Keychain) credentialFor(host string) (credential, bool) {
+	if k == nil {
+		return credential{}, false
+	}
+	cred, ok := k.credentials[host]
+	return cred, ok
+}
+
+// Resolver resolves tags of images to digests using the registry API
+type Resolver struct {
+	client *http.Client
+}
+
+// NewResolver returns new instance of Resolver
+func NewResolver() *Resolver {
+	return &Resolver{
+		client: &http.Client{Timeout: ResolveTimeout},
+	}
+}
+
+// Resolve returns the image pinned to the digest its tag currently points to.
+// Images which already have a digest are returned as they are.
+func (r *Resolver) Resolve(ctx context.Context, image string, keychain *Keychain) (string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	if ref.Digest != "" {
+		return ref.String(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ResolveTimeout)
+	defer cancel()
+
+	host := ref.registryHost()
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, ref.Repository, ref.Tag)
+
+	resp, err := r.headManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := r.token(ctx, resp.Header.Get("WWW-Authenticate"), ref, keychain)
+		if err != nil {
+			return "", err
+		}
+
+		if resp, err = r.headManifest(ctx, manifestURL, token); err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Image: image, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("could not resolve image %s: registry did not return a digest", image)
+	}
+
+	ref.Digest = digest
+	return ref.String(), nil
+}
+
+func (r *Resolver) headManifest(ctx context.Context, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return r.client.Do(req)
+}
+
+// token answers the authentication challenge of a registry and returns the value of the Authorization header
+func (r *Resolver) token(ctx context.Context, challenge string, ref *Reference, keychain *Keychain) (string, error) {
+	cred, hasCred := keychain.credentialFor(ref.registryHost())
+
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if !hasCred {
+			return "", &StatusError{Image: ref.String(), StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized, but no image pull secret has credentials"}
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(cred.Username+":"+cred.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("registry %s asks for unsupported authentication %q", ref.Domain, challenge)
+	}
+
+	query := url.Values{}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", ref.Repository))
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCred {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", &StatusError{Image: ref.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get token of registry %s: %s", ref.Domain, resp.Status)
+	}
+
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+
+	return "Bearer " + body.Token, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header like `Bearer realm="...",service="..."`
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme := strings.ToLower(parts[0])
+	if len(parts) == 1 {
+		return scheme, params
+	}
+
+	for _, param := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return scheme, params
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// testRegistry serves the manifest of "agent:v1", asking for the basic credentials hub:secret if auth is set
+func testRegistry(t *testing.T, auth bool) (*Resolver, string) {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if auth {
+			if user, password, ok := req.BasicAuth(); !ok || user != "hub" || password != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		if req.URL.Path != "/v2/agent/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", testDigest)
+	}))
+	t.Cleanup(server.Close)
+
+	resolver := NewResolver()
+	resolver.client = server.Client()
+	return resolver, strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestResolve(t *testing.T) {
+	resolver, host := testRegistry(t, false)
+
+	got, err := resolver.Resolve(context.Background(), host+"/agent:v1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := host + "/agent@" + testDigest; got != want {
+		t.Errorf("Resolve() = %q, want %q", got, want)
+	}
+
+	pinned := host + "/agent@" + testDigest
+	if got, err := resolver.Resolve(context.Background(), pinned, nil); err != nil || got != pinned {
+		t.Errorf("Resolve(%q) = %q, %v, images with a digest should be returned as they are", pinned, got, err)
+	}
+
+	_, err = resolver.Resolve(context.Background(), host+"/missing:v1", nil)
+	if !IsNotFound(err) || IsUnauthorized(err) {
+		t.Errorf("Resolve() of a missing image error = %v, want a not found error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = resolver.Resolve(ctx, host+"/agent:v1", nil)
+	if !errors.Is(err, context.Canceled) || IsNotFound(err) || IsUnauthorized(err) {
+		t.Errorf("Resolve() with a canceled context error = %v, want the context error", err)
+	}
+}
+
+func TestResolveAuth(t *testing.T) {
+	resolver, host := testRegistry(t, true)
+
+	_, err := resolver.Resolve(context.Background(), host+"/agent:v1", nil)
+	if !IsUnauthorized(err) {
+		t.Errorf("Resolve() without credentials error = %v, want an unauthorized error", err)
+	}
+
+	secret := func(password string) *corev1.Secret {
+		config, _ := json.Marshal(map[string]interface{}{
+			"auths": map[string]interface{}{
+				"https://" + host: map[string]string{"auth": base64.StdEncoding.EncodeToString([]byte("hub:" + password))},
+			},
+		})
+		return &corev1.Secret{
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: config},
+		}
+	}
+
+	keychain, err := NewKeychain(secret("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.Resolve(context.Background(), host+"/agent:v1", keychain); err != nil {
+		t.Errorf("Resolve() with credentials error = %v", err)
+	}
+
+	keychain, err = NewKeychain(secret("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.Resolve(context.Background(), host+"/agent:v1", keychain); !IsUnauthorized(err) {
+		t.Errorf("Resolve() with wrong credentials error = %v, want an unauthorized error", err)
+	}
+}
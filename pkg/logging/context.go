@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	uuid "github.com/satori/go.uuid"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+type valuesKey struct{}
+
+// WithValues returns a copy of ctx carrying the given correlation fields in addition to
+// the ones ctx already carries
+func WithValues(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	parent := Values(ctx)
+	values := make([]interface{}, 0, len(parent)+len(keysAndValues))
+	values = append(append(values, parent...), keysAndValues...)
+	return context.WithValue(ctx, valuesKey{}, values)
+}
+
+// WithRoom returns a copy of ctx carrying the correlation fields of the room
+func WithRoom(ctx context.Context, room *hubv1.Room) context.Context {
+	return WithValues(ctx, "roomID", room.Spec.ID, "problemID", room.Spec.ProblemID)
+}
+
+// WithReconcileID returns a copy of ctx carrying a new ID, correlating the logs of a single reconcile
+func WithReconcileID(ctx context.Context) context.Context {
+	return WithValues(ctx, "reconcileID", uuid.NewV4().String())
+}
+
+// Values returns the correlation fields ctx carries
+func Values(ctx context.Context) []interface{} {
+	values, _ := ctx.Value(valuesKey{}).([]interface{})
+	return values
+}
+
+// Logger returns log with the correlation fields ctx carries
+func Logger(ctx context.Context, log logr.Logger) logr.Logger {
+	return log.WithValues(Values(ctx)...)
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// Formats of logs
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Options configures the logger of the manager
+type Options struct {
+	// Level is one of "debug", "info" and "error", or a positive verbosity of V logs
+	Level string
+	// Format is either FormatJSON or FormatConsole
+	Format string
+	// Sampling drops repeated logs of the same message beyond the first hundred each second
+	Sampling bool
+}
+
+// BindFlags binds the options to flags of fs
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Level, "log-level", "info",
+		"The level of logs, one of \"debug\", \"info\" and \"error\", or a positive verbosity.")
+	fs.StringVar(&o.Format, "log-format", FormatJSON,
+		"The format of logs, either \"json\" or \"console\".")
+	fs.BoolVar(&o.Sampling, "log-sampling", true,
+		"Drop repeated logs of the same message beyond the first hundred each second.")
+}
+
+// New returns a structured logger configured by o
+func New(o Options) (logr.Logger, error) {
+	level, err := parseLevel(o.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoder zapcore.Encoder
+	switch o.Format {
+	case FormatJSON:
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	case FormatConsole:
+		config := zap.NewDevelopmentEncoderConfig()
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewConsoleEncoder(config)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", o.Format)
+	}
+
+	sink := zapcore.AddSync(os.Stderr)
+	core := zapcore.NewCore(&ctrlzap.KubeAwareEncoder{Encoder: encoder}, sink, level)
+	if o.Sampling {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+	}
+
+	return zapr.NewLogger(zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel), zap.ErrorOutput(sink))), nil
+}
+
+// parseLevel parses a level name, or a verbosity which zapr maps to the negative level
+func parseLevel(text string) (zapcore.Level, error) {
+	if verbosity, err := strconv.Atoi(text); err == nil {
+		if verbosity <= 0 {
+			return 0, fmt.Errorf("invalid log verbosity %d", verbosity)
+		}
+		return zapcore.Level(-verbosity), nil
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(text)); err != nil {
+		return 0, err
+	}
+	return level, nil
+}
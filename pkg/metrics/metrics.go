@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+// Outcomes of finished rooms
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeTimeout   = "timeout"
+	OutcomeRejected  = "rejected"
+)
+
+var (
+	// durationBuckets range from a second to a few hours, which covers both waiting and matches
+	durationBuckets = prometheus.ExponentialBuckets(1, 2, 15)
+
+	// latencyBuckets range from a few milliseconds to a minute, which covers calls to S3 and Gimulator
+	latencyBuckets = prometheus.ExponentialBuckets(0.005, 2, 14)
+
+	roomsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hub_rooms_created_total",
+		Help: "Number of rooms created, by problem",
+	}, []string{"problem"})
+
+	roomsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hub_rooms_finished_total",
+		Help: "Number of rooms finished, by problem and outcome",
+	}, []string{"problem", "outcome"})
+
+	queueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hub_room_queue_wait_seconds",
+		Help:    "Time from creation of a room until its gimulator is running and its actors are created",
+		Buckets: durationBuckets,
+	}, []string{"problem"})
+
+	timeToRunning = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hub_room_time_to_running_seconds",
+		Help:    "Time from creation of a room until all of its pods are running",
+		Buckets: durationBuckets,
+	}, []string{"problem"})
+
+	matchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hub_match_duration_seconds",
+		Help:    "Time from all pods of a room running until the room finishes, by problem and outcome",
+		Buckets: durationBuckets,
+	}, []string{"problem", "outcome"})
+
+	s3Latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hub_s3_request_duration_seconds",
+		Help:    "Latency of requests to S3, by operation",
+		Buckets: latencyBuckets,
+	}, []string{"operation"})
+
+	s3Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hub_s3_request_errors_total",
+		Help: "Number of failed requests to S3, by operation",
+	}, []string{"operation"})
+
+	rabbitPublishFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hub_rabbit_publish_failures_total",
+		Help: "Number of results which could not be published to RabbitMQ",
+	})
+
+	gimulatorReportLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hub_gimulator_report_duration_seconds",
+		Help:    "Latency of reporting statuses of participants to Gimulator, by result",
+		Buckets: latencyBuckets,
+	}, []string{"result"})
+
+	activeTimers = prometheus.NewDesc(
+		"hub_active_timers",
+		"Number of rooms whose actors are running against the timeout of the room",
+		nil, nil,
+	)
+)
+
+// listTimeout bounds listing the rooms on a scrape, which waits for the cache to sync after a start
+const listTimeout = 10 * time.Second
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		roomsCreated,
+		roomsFinished,
+		queueWait,
+		timeToRunning,
+		matchDuration,
+		s3Latency,
+		s3Errors,
+		rabbitPublishFailures,
+		gimulatorReportLatency,
+	)
+}
+
+// RoomCreated counts a new room
+func RoomCreated(room *hubv1.Room) {
+	roomsCreated.WithLabelValues(room.Spec.ProblemID).Inc()
+}
+
+// RoomStarted records how long a room waited in the queue
+func RoomStarted(room *hubv1.Room) {
+	if room.Status.StartTime != nil {
+		queueWait.WithLabelValues(room.Spec.ProblemID).Observe(room.Status.StartTime.Sub(room.CreationTimestamp.Time).Seconds())
+	}
+}
+
+// RoomRunning records how long a room took until all of its pods were running
+func RoomRunning(room *hubv1.Room) {
+	if room.Status.RunningTime != nil {
+		timeToRunning.WithLabelValues(room.Spec.ProblemID).Observe(room.Status.RunningTime.Sub(room.CreationTimestamp.Time).Seconds())
+	}
+}
+
+// RoomFinished counts a finished room and records the duration of its match if all of its pods were running
+func RoomFinished(room *hubv1.Room, outcome string) {
+	roomsFinished.WithLabelValues(room.Spec.ProblemID, outcome).Inc()
+	if room.Status.RunningTime != nil {
+		matchDuration.WithLabelValues(room.Spec.ProblemID, outcome).Observe(time.Since(room.Status.RunningTime.Time).Seconds())
+	}
+}
+
+// S3Request records the latency of a request to S3 and counts it if it failed
+func S3Request(operation string, start time.Time, err error) {
+	s3Latency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s3Errors.WithLabelValues(operation).Inc()
+	}
+}
+
+// RabbitPublishFailed counts a result which could not be published
+func RabbitPublishFailed() {
+	rabbitPublishFailures.Inc()
+}
+
+// GimulatorReport records the latency of reporting to Gimulator
+func GimulatorReport(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	gimulatorReportLatency.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// RoomLister lists the rooms reconciled by this replica
+type RoomLister func(ctx context.Context) ([]hubv1.Room, error)
+
+// roomCollector derives gauges from the rooms in the API server on every scrape,
+// so they keep no state of their own and follow rooms moving between replicas
+type roomCollector struct {
+	list RoomLister
+}
+
+// RegisterRoomCollector registers the gauges derived from the rooms list returns
+func RegisterRoomCollector(list RoomLister) error {
+	return ctrlmetrics.Registry.Register(&roomCollector{list: list})
+}
+
+func (c *roomCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeTimers
+}
+
+func (c *roomCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	rooms, err := c.list(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(activeTimers, err)
+		return
+	}
+
+	timers := 0
+	for i := range rooms {
+		if hasActiveTimer(&rooms[i]) {
+			timers++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(activeTimers, prometheus.GaugeValue, float64(timers))
+}
+
+// hasActiveTimer returns true if the room has a timeout which has not been reached
+// and one of its actors is running, so the timer of the room is counting down
+func hasActiveTimer(room *hubv1.Room) bool {
+	if room.Spec.Timeout == 0 || room.Status.TimedOut {
+		return false
+	}
+	for _, phase := range room.Status.ActorStatuses {
+		if phase == corev1.PodRunning {
+			return true
+		}
+	}
+	return false
+}
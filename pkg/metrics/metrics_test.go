@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+func TestActiveTimers(t *testing.T) {
+	room := func(timeout uint64, timedOut bool, phases ...corev1.PodPhase) hubv1.Room {
+		statuses := make(map[string]corev1.PodPhase)
+		for i, phase := range phases {
+			statuses[fmt.Sprintf("actor-%d", i)] = phase
+		}
+		return hubv1.Room{
+			Spec:   hubv1.RoomSpec{Timeout: timeout},
+			Status: hubv1.RoomStatus{TimedOut: timedOut, ActorStatuses: statuses},
+		}
+	}
+	rooms := []hubv1.Room{
+		room(60, false, corev1.PodRunning, corev1.PodPending),
+		room(60, false, corev1.PodRunning),
+		room(60, false, corev1.PodPending),
+		room(60, true, corev1.PodRunning),
+		room(0, false, corev1.PodRunning),
+	}
+
+	collector := &roomCollector{list: func(context.Context) ([]hubv1.Room, error) {
+		return rooms, nil
+	}}
+	if got := testutil.ToFloat64(collector); got != 2 {
+		t.Errorf("hub_active_timers = %v, want the 2 rooms with running actors before their timeout", got)
+	}
+
+	failing := &roomCollector{list: func(context.Context) ([]hubv1.Room, error) {
+		return nil, fmt.Errorf("cache is not synced")
+	}}
+	ch := make(chan prometheus.Metric, 1)
+	failing.Collect(ch)
+	if err := (<-ch).Write(&dto.Metric{}); err == nil {
+		t.Error("hub_active_timers is valid, want an invalid metric if rooms can not be listed")
+	}
+}
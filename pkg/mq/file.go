@@ -0,0 +1,59 @@
+package mq
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	"github.com/Gimulator/hub/pkg/logging"
+)
+
+// FileSink appends results as JSON lines to a file, for running without RabbitMQ.
+// Results of all queues are written to the same file.
+type FileSink struct {
+	path string
+	log  logr.Logger
+
+	mutex sync.Mutex
+}
+
+// NewFileSink returns new instance of FileSink, creating the directory of path if needed
+func NewFileSink(log logr.Logger, path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSink{
+		path: path,
+		log:  log,
+	}, nil
+}
+
+func (f *FileSink) Send(ctx context.Context, queue string, result *Result) error {
+	logger := logging.Logger(ctx, f.log).WithValues("file", f.path, "queue", queue)
+	logger.Info("starting to send result")
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Error(err, "could not marshal result")
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		logger.Error(err, "could not open results file")
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		logger.Error(err, "could not write result")
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,65 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Gimulator/protobuf/go/api"
+	"github.com/go-logr/logr"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+func TestFileSinkSend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results", "results.jsonl")
+	sink, err := NewFileSink(logr.Discard(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []*Result{
+		{Result: &api.Result{Id: "room-1", Status: api.Result_failed, Msg: "timeout"}},
+		{
+			Result:     &api.Result{Id: "room-2", Status: api.Result_failed},
+			Placements: map[string]*hubv1.ActorPlacement{"alice": {Node: "node-a", CPUModel: "EPYC"}},
+		},
+	}
+	for _, result := range results {
+		if err := sink.Send(context.Background(), "results", result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("results file has %d lines, want 2", len(lines))
+	}
+
+	// fields of api.Result are published as they were, next to the placements
+	got := make(map[string]interface{})
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["placements"]; ok {
+		t.Errorf("first result = %s, placements should be omitted when there are none", lines[0])
+	}
+
+	second := &Result{Result: &api.Result{}}
+	if err := json.Unmarshal(lines[1], second); err != nil {
+		t.Fatal(err)
+	}
+	if second.Id != "room-2" || second.Status != api.Result_failed {
+		t.Errorf("second result = %s, want the fields of api.Result inline", lines[1])
+	}
+	if placement := second.Placements["alice"]; placement == nil || placement.Node != "node-a" || placement.CPUModel != "EPYC" {
+		t.Errorf("second result = %s, want the placement of alice", lines[1])
+	}
+}
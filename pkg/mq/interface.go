@@ -1,7 +1,22 @@
 package mq
 
-import "github.com/Gimulator/protobuf/go/api"
+import (
+	"context"
 
+	"github.com/Gimulator/protobuf/go/api"
+
+	hubv1 "github.com/Gimulator/hub/api/v1"
+)
+
+// MessageQueue publishes results of rooms to queue, which differs between tenants
 type MessageQueue interface {
-	Send(result *api.Result) error
+	Send(ctx context.Context, queue string, result *Result) error
+}
+
+// Result is the published result of a room, the fields of api.Result with what the hub adds to them
+type Result struct {
+	*api.Result
+
+	// Placements are where actors of rooms in benchmark mode ran, for auditing fairness of the match
+	Placements map[string]*hubv1.ActorPlacement `json:"placements,omitempty"`
 }
@@ -1,27 +1,29 @@
 package mq
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
-	"github.com/Gimulator/protobuf/go/api"
-	"github.com/sirupsen/logrus"
+	"github.com/go-logr/logr"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/tracing"
 )
 
 type Rabbit struct {
-	uri   string
-	queue string
-	log   *logrus.Entry
-	ch    *amqp.Channel
+	uri string
+	log logr.Logger
+	ch  *amqp.Channel
 }
 
-func NewRabbit(host, username, password, queueName string) (*Rabbit, error) {
+func NewRabbit(log logr.Logger, host, username, password string) (*Rabbit, error) {
 	uri := fmt.Sprintf("amqps://%v:%v@%v:5671", username, password, host)
 	r := &Rabbit{
-		uri:   uri,
-		queue: queueName,
-		log:   logrus.WithField("component", "rabbit"),
+		uri: uri,
+		log: log,
 	}
 
 	conn, err := amqp.Dial(r.uri)
@@ -43,32 +45,42 @@ func (r *Rabbit) test() error {
 	return nil
 }
 
-func (r *Rabbit) Send(result *api.Result) error {
-	r.log.Info("starting to send result")
+func (r *Rabbit) Send(ctx context.Context, queueName string, result *Result) (err error) {
+	ctx, span := tracing.Start(ctx, "Rabbit.Send", attribute.String("queue", queueName), attribute.String("room", result.Id))
+	defer tracing.End(span, &err)
+
+	logger := logging.Logger(ctx, r.log).WithValues("queue", queueName)
+	logger.Info("starting to send result")
 
-	r.log.Info("starting to marshal result")
+	logger.V(1).Info("starting to marshal result")
 	data, err := json.Marshal(result)
 	if err != nil {
-		r.log.WithError(err).Error("could not marshal result")
+		logger.Error(err, "could not marshal result")
 		return err
 	}
 	body := string(data)
 
-	r.log.Info("starting to declare queue")
+	logger.V(1).Info("starting to declare queue")
 	queue, err := r.ch.QueueDeclare(
-		r.queue, // name
-		true,    // durable
-		false,   // delete when unused
-		false,   // exclusive
-		false,   // no-wait
-		nil,     // arguments
+		queueName, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
 	)
 	if err != nil {
-		r.log.WithError(err).Error("could not declare queue")
+		logger.Error(err, "could not declare queue")
 		return err
 	}
 
-	r.log.Info("starting to publish message")
+	// the trace context is sent in headers so consumers can continue the trace
+	headers := amqp.Table{}
+	for key, value := range tracing.Inject(ctx) {
+		headers[key] = value
+	}
+
+	logger.V(1).Info("starting to publish message")
 	if err := r.ch.Publish(
 		"",         // exchange
 		queue.Name, // routing key
@@ -76,10 +88,11 @@ func (r *Rabbit) Send(result *api.Result) error {
 		false,      // immediate
 		amqp.Publishing{
 			ContentType: "application/x-yaml",
+			Headers:     headers,
 			Body:        []byte(body),
 		},
 	); err != nil {
-		r.log.WithError(err).Error("could not publish message")
+		logger.Error(err, "could not publish message")
 		return err
 	}
 
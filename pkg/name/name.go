@@ -1,22 +1,113 @@
 package name
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"github.com/Gimulator/protobuf/go/api"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
-// Pods
-func ActorPodName(id string) string {
+// Generated objects are named by joining a prefix, the room ID and the participant. Joining several
+// parts is ambiguous, ("a-b", "c") and ("a", "b-c") join to the same name, so such names end with a
+// hash of the separate parts. Names which are not DNS-1123 labels are sanitized and truncated, and
+// end with a hash as well.
+func scopedName(prefix string, parts ...string) string {
+	if len(parts) < 2 {
+		return unhashedScopedName(append([]string{prefix}, parts...)...)
+	}
+
+	sum := sha256.Sum256([]byte(prefix + "\x00" + strings.Join(parts, "\x00")))
+	return truncatedName(prefix+"-"+strings.Join(parts, "-"), hex.EncodeToString(sum[:])[:8])
+}
+
+// unhashedScopedName joins the parts, and only hashes names which are not DNS-1123 labels
+func unhashedScopedName(parts ...string) string {
+	joined := strings.Join(parts, "-")
+	if len(validation.IsDNS1123Label(joined)) == 0 {
+		return joined
+	}
+
+	sum := sha256.Sum256([]byte(joined))
+	return truncatedName(joined, hex.EncodeToString(sum[:])[:8])
+}
+
+// truncatedName sanitizes and truncates the name so that it is a DNS-1123 label ending with the hash
+func truncatedName(joined, hash string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(joined))
+	if max := validation.DNS1123LabelMaxLength - len(hash) - 1; len(sanitized) > max {
+		sanitized = sanitized[:max]
+	}
+	return strings.Trim(sanitized, "-") + "-" + hash
+}
+
+func ActorPodName(roomID, actorID string) string {
+	return scopedName("actor", roomID, actorID)
+}
+
+func DirectorPodName(roomID, directorID string) string {
+	return scopedName("director", roomID, directorID)
+}
+
+func BuildPodName(roomID, actorID string) string {
+	return scopedName("build", roomID, actorID)
+}
+
+func UploaderPodName(pvcName string) string {
+	return scopedName("upload", pvcName)
+}
+
+func FetcherPodName(podName string) string {
+	return scopedName("fetch", podName)
+}
+
+func PopulatorPodName(pvcName string) string {
+	return scopedName("populate", pvcName)
+}
+
+func GimulatorPodName(roomID string) string {
+	return scopedName("gimulator", roomID)
+}
+
+// Names of rooms created before names were scoped by the room ID
+func LegacyActorPodName(id string) string {
 	return "actor-" + id
 }
 
-func DirectorPodName(id string) string {
+func LegacyDirectorPodName(id string) string {
 	return "director-" + id
 }
 
-func GimulatorPodName(roomID string) string {
-	return "gimulator-" + roomID
+func LegacyBuildPodName(actorID string) string {
+	return "build-" + actorID
+}
+
+func LegacyOutputPVCName(id string) string {
+	return "output-pvc-" + id
+}
+
+// Names of rooms created before names of several parts were hashed
+func UnhashedActorPodName(roomID, actorID string) string {
+	return unhashedScopedName("actor", roomID, actorID)
+}
+
+func UnhashedDirectorPodName(roomID, directorID string) string {
+	return unhashedScopedName("director", roomID, directorID)
+}
+
+func UnhashedBuildPodName(roomID, actorID string) string {
+	return unhashedScopedName("build", roomID, actorID)
+}
+
+func UnhashedOutputPVCName(roomID, actorID string) string {
+	return unhashedScopedName("output", roomID, actorID)
 }
 
 // Containers
@@ -36,29 +127,155 @@ func GimulatorContainerName() string {
 	return CharacterGimulator()
 }
 
+func SourceContainerName() string {
+	return "source"
+}
+
+func BuilderContainerName() string {
+	return "kaniko"
+}
+
+func PusherContainerName() string {
+	return "pusher"
+}
+
+func UploaderContainerName() string {
+	return "uploader"
+}
+
+func PopulatorContainerName() string {
+	return "populator"
+}
+
+func WarmerContainerName(index int) string {
+	return fmt.Sprintf("warm-%d", index)
+}
+
+func WarmerHelperContainerName() string {
+	return "warmer-helper"
+}
+
+func WarmerPauseContainerName() string {
+	return "pause"
+}
+
 // ConfigMap
 
 func CredConfigMapName(id string) string {
-	return "credential-" + id
+	return scopedName("credential", id)
 }
 
 func RulesConfigMapName(id string) string {
-	return "rules-" + id
+	return scopedName("rules", id)
+}
+
+// IsCredOrRulesConfigMapName returns whether a ConfigMap may hold credentials or rules of any room
+func IsCredOrRulesConfigMapName(configMapName string) bool {
+	return strings.HasPrefix(configMapName, "credential-") || strings.HasPrefix(configMapName, "rules-")
+}
+
+func FilesConfigMapName(podName string) string {
+	return scopedName("files", podName)
+}
+
+func ImageCacheConfigMapName() string {
+	return "hub-image-cache"
+}
+
+// Secret
+func SourceSecretName(podName string) string {
+	return scopedName("source", podName)
+}
+
+// S3SecretName is the secret of the operator S3 keys which older versions copied into namespaces of rooms
+func S3SecretName() string {
+	return "s3-credentials"
+}
+
+func S3CredentialsSecretName(podName string) string {
+	return scopedName("s3", podName)
+}
+
+func RegistrySecretName() string {
+	return "registry-credentials"
+}
+
+// Namespace
+func RoomNamespaceName(roomID string) string {
+	return scopedName("room", roomID)
+}
+
+func ResourceQuotaName() string {
+	return "room-quota"
+}
+
+func LimitRangeName() string {
+	return "room-limit-range"
+}
+
+func RoomNamespaceFinalizer() string {
+	return "hub.roboepics.com/room-namespace"
+}
+
+// NetworkPolicy
+func DenyAllNetworkPolicyName(roomID string) string {
+	return scopedName("deny-all", roomID)
+}
+
+func GimulatorNetworkPolicyName(roomID string) string {
+	return scopedName("gimulator", roomID)
+}
+
+func ParticipantsNetworkPolicyName(roomID string) string {
+	return scopedName("participants", roomID)
+}
+
+func BuilderNetworkPolicyName(roomID string) string {
+	return scopedName("builder", roomID)
+}
+
+func ObjectStoreNetworkPolicyName(roomID string) string {
+	return scopedName("object-store", roomID)
+}
+
+func DNSPort() int {
+	return 53
+}
+
+func DNSNamespace() string {
+	return "kube-system"
+}
+
+func DNSPodLabel() string {
+	return "k8s-app"
+}
+
+func DNSPodLabelValue() string {
+	return "kube-dns"
+}
+
+// Image warmer
+func ImageWarmerName() string {
+	return "hub-image-warmer"
+}
+
+func WarmerVolumeName() string {
+	return "warmer-bin"
+}
+
+func WarmerVolumeMountPath() string {
+	return "/warmer"
 }
 
 // Gimulator
 func GimulatorServiceName(roomID string) string {
-	return "gimulator-" + roomID
+	return scopedName("gimulator", roomID)
 }
 
 func GimulatorConfigDir() string {
 	return "/etc/gimulator"
 }
 
-func GimulatorServicePort() int {
-	return 23579
-}
-
 func GimulatorMemoryLimit() string {
 	return "200M" // TODO should be set dynamically
 }
@@ -71,8 +288,8 @@ func GimulatorEphemeralLimit() string {
 	return "100M" // TODO should be set dynamically
 }
 
-func GimulatorHost(roomID string) string {
-	return fmt.Sprintf("%s:%d", GimulatorServiceName(roomID), GimulatorServicePort())
+func GimulatorHost(roomID string, port int32) string {
+	return fmt.Sprintf("%s:%d", GimulatorServiceName(roomID), port)
 }
 
 // Volumes
@@ -93,13 +310,61 @@ func FactVolumeMountPath() string {
 }
 
 func OutputVolumeName(id string) string {
-	return "output-" + id
+	return scopedName("output", id)
 }
 
 func OutputVolumeMountPath() string {
 	return "/output"
 }
 
+func DatasetVolumeName() string {
+	return "dataset"
+}
+
+func DatasetMountPath() string {
+	return "/dataset"
+}
+
+func SourceVolumeName() string {
+	return "source"
+}
+
+func SourceMountPath() string {
+	return "/submission"
+}
+
+func DockerConfigVolumeName() string {
+	return "docker-config"
+}
+
+func DockerConfigMountPath() string {
+	return "/docker"
+}
+
+func ImageVolumeName() string {
+	return "image"
+}
+
+func ImageMountPath() string {
+	return "/image"
+}
+
+func FilesVolumeName() string {
+	return "files"
+}
+
+func FileKey(index int) string {
+	return fmt.Sprintf("file-%d", index)
+}
+
+func TmpVolumeName() string {
+	return "tmp"
+}
+
+func TmpVolumeMountPath() string {
+	return "/tmp"
+}
+
 func GimulatorConfigVolumeName() string {
 	return "gimulator-config-volume"
 }
@@ -108,12 +373,28 @@ func GimulatorConfigMountPath() string {
 	return GimulatorConfigDir()
 }
 
+func DirectorOutputMountPath() string {
+	return "/actors"
+}
+
 func ActorOutputVolumeMountPathForDirector(id string) string {
-	return "/actors/" + id
+	return DirectorOutputMountPath() + "/" + id
 }
 
-func OutputPVCName(id string) string {
-	return "output-pvc-" + id
+// DatasetPVCName names the PVC of a dataset by the first 10 characters of the key of its definition
+func DatasetPVCName(problemID, dataset, key string) string {
+	if len(key) > 10 {
+		key = key[:10]
+	}
+	return scopedName("dataset", problemID, dataset, key)
+}
+
+func SourcePVCName(podName string) string {
+	return scopedName("source-pvc", podName)
+}
+
+func OutputPVCName(roomID, actorID string) string {
+	return scopedName("output", roomID, actorID)
 }
 
 // Labels
@@ -137,6 +418,72 @@ func IDLabel() string {
 	return "id"
 }
 
+func OutputLabel() string {
+	return "output"
+}
+
+func DatasetLabel() string {
+	return "dataset"
+}
+
+// ObjectStoreLabel marks pods of the hub which fetch source code from the object store
+func ObjectStoreLabel() string {
+	return "object-store"
+}
+
+func ObjectStoreLabelValue() string {
+	return "true"
+}
+
+func ManagerLabel() string {
+	return "control-plane"
+}
+
+func ManagerLabelValue() string {
+	return "controller-manager"
+}
+
+func NamespaceNameLabel() string {
+	return "kubernetes.io/metadata.name"
+}
+
+func HostnameLabel() string {
+	return "kubernetes.io/hostname"
+}
+
+func CPUModelLabel() string {
+	return "feature.node.kubernetes.io/cpu-model.id"
+}
+
+// Annotations
+func DatasetPopulatedAnnotation() string {
+	return "hub.roboepics.com/populated"
+}
+
+func SourceFetchedAnnotation() string {
+	return "hub.roboepics.com/fetched"
+}
+
+func WarmerUpdatedAnnotation() string {
+	return "hub.roboepics.com/updated"
+}
+
+func DatasetLastUsedAnnotation() string {
+	return "hub.roboepics.com/last-used"
+}
+
+func OutputRetentionAnnotation() string {
+	return "hub.roboepics.com/retention"
+}
+
+func OutputKeepForHoursAnnotation() string {
+	return "hub.roboepics.com/keep-for-hours"
+}
+
+func OutputRoomDeletedAnnotation() string {
+	return "hub.roboepics.com/room-deleted"
+}
+
 // character
 func CharacterActor() string {
 	return api.Character_name[int32(api.Character_actor)]
@@ -158,40 +505,59 @@ func CharacterGimulator() string {
 	return "gimulator"
 }
 
-// S3
-func S3LogsBucket() string {
-	return "log"
+func CharacterBuilder() string {
+	return "builder"
+}
+
+func CharacterFetcher() string {
+	return "fetcher"
+}
+
+// S3, buckets are prefixed by the tenant of the namespace of the room
+func S3LogsBucket(prefix string) string {
+	return prefix + "log"
 }
 
 func S3LogObjectNameForDirector(runID, directorID string) string {
-	return fmt.Sprintf("%s/%s.log", runID, DirectorPodName(directorID))
+	return fmt.Sprintf("%s/director-%s.log", runID, directorID)
 }
 
 func S3LogObjectNameForActor(runID, actorID string) string {
-	return fmt.Sprintf("%s/%s.log", runID, ActorPodName(actorID))
+	return fmt.Sprintf("%s/actor-%s.log", runID, actorID)
 }
 
-func S3SettingBucket() string {
-	return "settings"
+func S3PlacementsObjectName(runID string) string {
+	return fmt.Sprintf("%s/placements.yaml", runID)
 }
 
-func S3SettingObjectName(id string) string {
-	return id + ".yaml"
+func S3OutputsBucket(prefix string) string {
+	return prefix + "outputs"
 }
 
-func S3RulesBucket() string {
-	return "rules"
+func S3OutputObjectPrefix(roomID, actorID string) string {
+	return roomID + "/" + actorID
 }
 
-func S3RulesObjectName(id string) string {
+func S3DatasetsBucket(prefix string) string {
+	return prefix + "datasets"
+}
+
+func S3SubmissionsBucket(prefix string) string {
+	return prefix + "submissions"
+}
+
+func S3SettingBucket(prefix string) string {
+	return prefix + "settings"
+}
+
+func S3SettingObjectName(id string) string {
 	return id + ".yaml"
 }
 
-// Cache
-func CacheKeyForSetting(id string) string {
-	return "settings-" + id
+func S3RulesBucket(prefix string) string {
+	return prefix + "rules"
 }
 
-func CacheKeyForRules(id string) string {
-	return "rules-" + id
+func S3RulesObjectName(id string) string {
+	return id + ".yaml"
 }
@@ -0,0 +1,97 @@
+package name
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestScopedName(t *testing.T) {
+	long := strings.Repeat("a", 80)
+
+	tests := []struct {
+		name   string
+		parts  []string
+		want   string
+		hashed bool
+	}{
+		{name: "single part", parts: []string{"gimulator", "room-1"}, want: "gimulator-room-1"},
+		{name: "valid", parts: []string{"actor", "room-1", "alice"}, want: "actor-room-1-alice", hashed: true},
+		{name: "upper case", parts: []string{"actor", "Room", "Alice"}, want: "actor-room-alice", hashed: true},
+		{name: "invalid characters", parts: []string{"actor", "room_1", "alice.b"}, want: "actor-room-1-alice-b", hashed: true},
+		{name: "leading and trailing separators", parts: []string{"actor", "room", "_alice_"}, want: "actor-room--alice", hashed: true},
+		{name: "too long", parts: []string{"actor", long, "alice"}, want: "actor-" + long[:validation.DNS1123LabelMaxLength-len("actor-")-9], hashed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scopedName(tt.parts[0], tt.parts[1:]...)
+
+			if errs := validation.IsDNS1123Label(got); len(errs) > 0 {
+				t.Fatalf("scopedName(%q) = %q is not a DNS-1123 label: %v", tt.parts, got, errs)
+			}
+			if !tt.hashed {
+				if got != tt.want {
+					t.Errorf("scopedName(%q) = %q, want %q", tt.parts, got, tt.want)
+				}
+				return
+			}
+
+			i := strings.LastIndex(got, "-")
+			if prefix, hash := got[:i], got[i+1:]; prefix != tt.want || len(hash) != 8 {
+				t.Errorf("scopedName(%q) = %q, want %q followed by a hash of 8 characters", tt.parts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedNameUnique(t *testing.T) {
+	long := strings.Repeat("a", 80)
+
+	// names which join, sanitize or truncate to the same prefix differ by their hash
+	pairs := [][2][]string{
+		{{"actor", "a-b", "c"}, {"actor", "a", "b-c"}},
+		{{"actor", "room_1", "alice"}, {"actor", "room.1", "alice"}},
+		{{"actor", "Room", "alice"}, {"actor", "ROOM", "alice"}},
+		{{"actor", long, "alice"}, {"actor", long, "bob"}},
+	}
+	for _, pair := range pairs {
+		if a, b := scopedName(pair[0][0], pair[0][1:]...), scopedName(pair[1][0], pair[1][1:]...); a == b {
+			t.Errorf("scopedName(%q) and scopedName(%q) are both %q", pair[0], pair[1], a)
+		}
+	}
+}
+
+func TestUnhashedNames(t *testing.T) {
+	// rooms named before names were hashed keep their names
+	for got, want := range map[string]string{
+		UnhashedActorPodName("room-1", "alice"):    "actor-room-1-alice",
+		UnhashedDirectorPodName("room-1", "judge"): "director-room-1-judge",
+		UnhashedBuildPodName("room-1", "alice"):    "build-room-1-alice",
+		UnhashedOutputPVCName("room-1", "alice"):   "output-room-1-alice",
+	} {
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestPodNames(t *testing.T) {
+	roomID := strings.Repeat("r", 36)
+	actorID := strings.Repeat("x", 40)
+
+	for _, got := range []string{
+		ActorPodName(roomID, actorID),
+		DirectorPodName(roomID, actorID),
+		BuildPodName(roomID, actorID),
+		OutputPVCName(roomID, actorID),
+		DatasetPVCName(roomID, actorID, strings.Repeat("k", 64)),
+		DatasetPVCName(roomID, actorID, "short"),
+		RoomNamespaceName(roomID),
+		GimulatorServiceName(roomID),
+	} {
+		if errs := validation.IsDNS1123Label(got); len(errs) > 0 {
+			t.Errorf("%q is not a DNS-1123 label: %v", got, errs)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package naming
+
+import (
+	hubv1 "github.com/Gimulator/hub/api/v1"
+	"github.com/Gimulator/hub/pkg/name"
+)
+
+// Pods and PVCs of rooms created before names were scoped by the room ID, or before names
+// scoped by the room ID and the participant were hashed, keep the names they were created with
+
+func ActorPodName(room *hubv1.Room, actorID string) string {
+	switch room.Status.Naming {
+	case hubv1.RoomNamingLegacy:
+		return name.LegacyActorPodName(actorID)
+	case hubv1.RoomNamingScoped:
+		return name.UnhashedActorPodName(room.Spec.ID, actorID)
+	}
+	return name.ActorPodName(room.Spec.ID, actorID)
+}
+
+func DirectorPodName(room *hubv1.Room) string {
+	if room.Spec.Director == nil {
+		return ""
+	}
+	switch room.Status.Naming {
+	case hubv1.RoomNamingLegacy:
+		return name.LegacyDirectorPodName(room.Spec.Director.Name)
+	case hubv1.RoomNamingScoped:
+		return name.UnhashedDirectorPodName(room.Spec.ID, room.Spec.Director.Name)
+	}
+	return name.DirectorPodName(room.Spec.ID, room.Spec.Director.Name)
+}
+
+func BuildPodName(room *hubv1.Room, actorID string) string {
+	switch room.Status.Naming {
+	case hubv1.RoomNamingLegacy:
+		return name.LegacyBuildPodName(actorID)
+	case hubv1.RoomNamingScoped:
+		return name.UnhashedBuildPodName(room.Spec.ID, actorID)
+	}
+	return name.BuildPodName(room.Spec.ID, actorID)
+}
+
+func OutputPVCName(room *hubv1.Room, actorID string) string {
+	switch room.Status.Naming {
+	case hubv1.RoomNamingLegacy:
+		return name.LegacyOutputPVCName(actorID)
+	case hubv1.RoomNamingScoped:
+		return name.UnhashedOutputPVCName(room.Spec.ID, actorID)
+	}
+	return name.OutputPVCName(room.Spec.ID, actorID)
+}
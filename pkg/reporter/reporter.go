@@ -4,15 +4,21 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"strconv"
+	"net"
 	"time"
 
 	hubv1 "github.com/Gimulator/hub/api/v1"
 	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/forward"
+	"github.com/Gimulator/hub/pkg/hubconfig"
+	"github.com/Gimulator/hub/pkg/metrics"
 	"github.com/Gimulator/hub/pkg/mq"
 	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/naming"
 	"github.com/Gimulator/hub/pkg/s3"
+	"github.com/Gimulator/hub/pkg/tracing"
 	"github.com/Gimulator/protobuf/go/api"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	corev1 "k8s.io/api/core/v1"
@@ -21,18 +27,22 @@ import (
 )
 
 type Reporter struct {
-	token        string
-	rabbit       *mq.Rabbit
+	config       *hubconfig.Config
+	results      mq.MessageQueue
 	client       *client.Client
 	k8sClientSet *kubernetes.Clientset
+	forwarder    *forward.Forwarder
 }
 
-func NewReporter(token string, rabbit *mq.Rabbit, client *client.Client, k8sClientSet *kubernetes.Clientset) (*Reporter, error) {
+// NewReporter returns new instance of Reporter, Gimulators are reached through
+// forwarder when it is not nil and through their services otherwise
+func NewReporter(config *hubconfig.Config, results mq.MessageQueue, client *client.Client, k8sClientSet *kubernetes.Clientset, forwarder *forward.Forwarder) (*Reporter, error) {
 	return &Reporter{
-		token:        token,
-		rabbit:       rabbit,
+		config:       config,
+		results:      results,
 		client:       client,
 		k8sClientSet: k8sClientSet,
+		forwarder:    forwarder,
 	}, nil
 }
 
@@ -46,6 +56,20 @@ func (r *Reporter) Report(ctx context.Context, room *hubv1.Room) (bool, error) {
 		}
 		return true, nil
 	case corev1.PodRunning:
+		// Without a director nobody will ever end the match, so the room
+		// fails regardless of TerminateOnActorFailure
+		if room.Status.DirectorReason != "" {
+			result := &api.Result{
+				Id:     room.Spec.ID,
+				Status: api.Result_failed,
+				Msg:    fmt.Sprintf("Director could not be started.\n%s", room.Status.DirectorReason),
+			}
+			if err := r.informRabbit(ctx, room, result); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+
 		if !room.Spec.TerminateOnActorFailure {
 			return false, r.informGimulator(ctx, room, reports)
 		}
@@ -56,13 +80,17 @@ func (r *Reporter) Report(ctx context.Context, room *hubv1.Room) (bool, error) {
 		}
 		return shouldDelete, r.informGimulator(ctx, room, reports)
 	case corev1.PodFailed:
+		msg := "Gimulator failed"
+		if room.Status.GimulatorReason != "" {
+			msg = fmt.Sprintf("Gimulator could not be started.\n%s", room.Status.GimulatorReason)
+		}
 		result := &api.Result{
 			Id:     room.Spec.ID,
 			Status: api.Result_failed,
-			Msg:    "Gimulator failed",
+			Msg:    msg,
 		}
 		// TODO: should write better result for backend
-		if err := r.informRabbit(room, result); err != nil {
+		if err := r.informRabbit(ctx, room, result); err != nil {
 			return false, err
 		}
 		return true, nil
@@ -72,20 +100,41 @@ func (r *Reporter) Report(ctx context.Context, room *hubv1.Room) (bool, error) {
 	}
 }
 
-func (r *Reporter) ReportTimeout(room *hubv1.Room, threshold uint64) error {
+func (r *Reporter) ReportTimeout(ctx context.Context, room *hubv1.Room, threshold uint64) error {
 	result := &api.Result{
 		Id:     room.Spec.ID,
 		Status: api.Result_failed,
 		Msg:    fmt.Sprintf("Timeout limit exceeded (%v seconds).", threshold),
 	}
 	// TODO: should write better result for backend
-	return r.informRabbit(room, result)
+	return r.informRabbit(ctx, room, result)
+}
+
+func (r *Reporter) ReportRejection(ctx context.Context, room *hubv1.Room, reason string) error {
+	result := &api.Result{
+		Id:     room.Spec.ID,
+		Status: api.Result_failed,
+		Msg:    reason,
+	}
+	return r.informRabbit(ctx, room, result)
 }
 
 func (r *Reporter) checkPodsForFailure(ctx context.Context, room *hubv1.Room) (bool, error) {
 	for actor, status := range room.Status.ActorStatuses {
+		if reason, ok := room.Status.ActorReasons[actor]; ok && status == corev1.PodFailed {
+			result := &api.Result{
+				Id:     room.Spec.ID,
+				Status: api.Result_failed,
+				Msg:    fmt.Sprintf("Actor could not be started.\n%s", reason),
+			}
+			if err := r.informRabbit(ctx, room, result); err != nil {
+				return true, err
+			}
+			return true, nil
+		}
+
 		if status == corev1.PodFailed {
-			key := types.NamespacedName{Name: name.ActorPodName(actor), Namespace: room.Namespace}
+			key := types.NamespacedName{Name: naming.ActorPodName(room, actor), Namespace: room.WorkloadNamespace()}
 			pod, err := r.client.GetPod(ctx, key)
 			if err != nil {
 				return true, err
@@ -94,6 +143,7 @@ func (r *Reporter) checkPodsForFailure(ctx context.Context, room *hubv1.Room) (b
 			var stream io.ReadCloser
 
 			if err := r.GetPodLogs(ctx, r.k8sClientSet, pod, &corev1.PodLogOptions{
+				Container:  name.ActorContainerName(),
 				Timestamps: true,
 			}, &stream); err != nil {
 				return true, err
@@ -109,14 +159,14 @@ func (r *Reporter) checkPodsForFailure(ctx context.Context, room *hubv1.Room) (b
 				Status: api.Result_failed,
 				Msg:    fmt.Sprintf("Actor faced an exception.\n%s", string(log)),
 			}
-			if err := r.informRabbit(room, result); err != nil {
+			if err := r.informRabbit(ctx, room, result); err != nil {
 				return true, err
 			}
 			return true, nil
 		}
 	}
 	if status := room.Status.DirectorStatus; status == corev1.PodFailed {
-		key := types.NamespacedName{Name: name.DirectorPodName(room.Spec.Director.Name), Namespace: room.Namespace}
+		key := types.NamespacedName{Name: naming.DirectorPodName(room), Namespace: room.WorkloadNamespace()}
 		pod, err := r.client.GetPod(ctx, key)
 		if err != nil {
 			return true, err
@@ -125,6 +175,7 @@ func (r *Reporter) checkPodsForFailure(ctx context.Context, room *hubv1.Room) (b
 		var stream io.ReadCloser
 
 		if err := r.GetPodLogs(ctx, r.k8sClientSet, pod, &corev1.PodLogOptions{
+			Container:  name.DirectorContainerName(),
 			Timestamps: true,
 		}, &stream); err != nil {
 			return true, err
@@ -140,7 +191,7 @@ func (r *Reporter) checkPodsForFailure(ctx context.Context, room *hubv1.Room) (b
 			Status: api.Result_failed,
 			Msg:    fmt.Sprintf("Director faced an exception.\n%s", string(log)),
 		}
-		if err := r.informRabbit(room, result); err != nil {
+		if err := r.informRabbit(ctx, room, result); err != nil {
 			return true, err
 		}
 		return true, nil
@@ -179,20 +230,38 @@ func (r *Reporter) kubeToAPIStatus(phase corev1.PodPhase) api.Status {
 	return status
 }
 
-func (r *Reporter) informGimulator(ctx context.Context, room *hubv1.Room, reports []*api.Report) error {
-	address := name.GimulatorServiceName(room.Spec.ID) + ":" + strconv.Itoa(name.GimulatorServicePort())
+func (r *Reporter) informGimulator(ctx context.Context, room *hubv1.Room, reports []*api.Report) (err error) {
+	defer func(start time.Time) {
+		metrics.GimulatorReport(start, err)
+	}(time.Now())
+
+	ctx, span := tracing.Start(ctx, "Reporter.informGimulator", attribute.String("room", room.Spec.ID))
+	defer tracing.End(span, &err)
+
+	port := r.config.Hub().Gimulator.Port
+	address := name.GimulatorHost(room.Spec.ID, port)
+	options := []grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock()}
+	if r.forwarder != nil {
+		options = append(options, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return r.forwarder.Dial(ctx, room.WorkloadNamespace(), name.GimulatorPodName(room.Spec.ID), int(port))
+		}))
+	}
 
 	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	conn, err := grpc.DialContext(ctx2, address, grpc.WithInsecure(), grpc.WithBlock())
+	conn, err := grpc.DialContext(ctx2, address, options...)
 	if err != nil {
-		return fmt.Errorf("could not connect to Gimulator with address=%v", address)
+		return fmt.Errorf("could not connect to Gimulator with address=%v: %w", address, err)
 	}
 	defer conn.Close()
 
 	operatorClient := api.NewOperatorAPIClient(conn)
 	for _, report := range reports {
-		ctx := metadata.AppendToOutgoingContext(ctx, "token", r.token)
+		ctx := metadata.AppendToOutgoingContext(ctx, "token", r.config.Hub().Gimulator.Token)
+		// Gimulator continues the trace of the report from the trace context in metadata
+		for key, value := range tracing.Inject(ctx) {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+		}
 		if _, err := operatorClient.SetUserStatus(ctx, report); err != nil {
 			return err
 		}
@@ -200,16 +269,26 @@ func (r *Reporter) informGimulator(ctx context.Context, room *hubv1.Room, report
 	return nil
 }
 
-func (r *Reporter) informRabbit(_ *hubv1.Room, result *api.Result) error {
-	if err := r.rabbit.Send(result); err != nil {
+func (r *Reporter) informRabbit(ctx context.Context, room *hubv1.Room, result *api.Result) error {
+	published := &mq.Result{
+		Result:     result,
+		Placements: room.Status.ActorPlacements,
+	}
+	if err := r.results.Send(ctx, r.config.ResultQueue(room.Namespace), published); err != nil {
+		metrics.RabbitPublishFailed()
 		return err
 	}
 	return nil
 }
 
 func (r *Reporter) informBackendS3(ctx context.Context, room *hubv1.Room) error {
-	// Setting up K8s ClientSet
-	podLogOpts := &corev1.PodLogOptions{
+	// Pods may have sidecars, so logs of their main container are dumped
+	actorLogOpts := &corev1.PodLogOptions{
+		Container:  name.ActorContainerName(),
+		Timestamps: true,
+	}
+	directorLogOpts := &corev1.PodLogOptions{
+		Container:  name.DirectorContainerName(),
 		Timestamps: true,
 	}
 
@@ -218,50 +297,57 @@ func (r *Reporter) informBackendS3(ctx context.Context, room *hubv1.Room) error
 	// Dumping logs
 	// Actor(s)
 	for _, actor := range room.Spec.Actors {
-		key := types.NamespacedName{Name: name.ActorPodName(actor.Name), Namespace: room.Namespace}
+		key := types.NamespacedName{Name: naming.ActorPodName(room, actor.Name), Namespace: room.WorkloadNamespace()}
 		actorPod, err := r.client.GetPod(ctx, key)
 		if err != nil {
 			return err
 		}
 
-		if err := r.GetPodLogs(ctx, r.k8sClientSet, actorPod, podLogOpts, &stream); err != nil {
+		if err := r.GetPodLogs(ctx, r.k8sClientSet, actorPod, actorLogOpts, &stream); err != nil {
 			return err
 		}
 
-		if err := s3.PutObject(ctx, stream, name.S3LogsBucket(), name.S3LogObjectNameForActor(room.Spec.ID, actor.Name)); err != nil {
+		if err := s3.PutObject(ctx, stream, name.S3LogsBucket(r.config.BucketPrefix(room.Namespace)), name.S3LogObjectNameForActor(room.Spec.ID, actor.Name)); err != nil {
 			return err
 		}
 	}
 
 	// Director
-	directorKey := types.NamespacedName{Name: name.DirectorPodName(room.Spec.Director.Name), Namespace: room.Namespace}
+	directorKey := types.NamespacedName{Name: naming.DirectorPodName(room), Namespace: room.WorkloadNamespace()}
 	directorPod, err := r.client.GetPod(ctx, directorKey)
 	if err != nil {
 		return err
 	}
 
-	if err := r.GetPodLogs(ctx, r.k8sClientSet, directorPod, podLogOpts, &stream); err != nil {
+	if err := r.GetPodLogs(ctx, r.k8sClientSet, directorPod, directorLogOpts, &stream); err != nil {
 		return err
 	}
 
-	if err := s3.PutObject(ctx, stream, name.S3LogsBucket(), name.S3LogObjectNameForDirector(room.Spec.ID, room.Spec.Director.Name)); err != nil {
+	if err := s3.PutObject(ctx, stream, name.S3LogsBucket(r.config.BucketPrefix(room.Namespace)), name.S3LogObjectNameForDirector(room.Spec.ID, room.Spec.Director.Name)); err != nil {
 		return err
 	}
 
+	// Placements of actors in benchmark mode, for auditing fairness of the match
+	if len(room.Status.ActorPlacements) > 0 {
+		if err := s3.PutStruct(ctx, room.Status.ActorPlacements, name.S3LogsBucket(r.config.BucketPrefix(room.Namespace)), name.S3PlacementsObjectName(room.Spec.ID)); err != nil {
+			return err
+		}
+	}
+
 	// Gimulator
 	// TODO: There's a bug lying below. For some reason, gimulator logs can't make it to the S3. Yeah you might not need Gimulator's logs but still ... why is this happening?
 
-	// gimulatorKey := types.NamespacedName{Name: name.GimulatorPodName(room.Spec.ID), Namespace: room.Namespace}
+	// gimulatorKey := types.NamespacedName{Name: name.GimulatorPodName(room.Spec.ID), Namespace: room.WorkloadNamespace()}
 	// gimulatorPod, err := r.client.GetPod(ctx, gimulatorKey)
 	// if err != nil {
 	// 	return err
 	// }
 
-	// if err := r.GetPodLogs(ctx, clientSet, gimulatorPod, podLogOpts, &stream); err != nil {
+	// if err := r.GetPodLogs(ctx, clientSet, gimulatorPod, gimulatorLogOpts, &stream); err != nil {
 	// 	return err
 	// }
 
-	// if err := s3.PutObject(ctx, stream, name.S3LogsBucket(), name.S3LogObjectName(room.Spec.ID, "gimulator")); err != nil {
+	// if err := s3.PutObject(ctx, stream, name.S3LogsBucket(r.config.BucketPrefix(room.Namespace)), name.S3LogObjectName(room.Spec.ID, "gimulator")); err != nil {
 	// 	return err
 	// }
 
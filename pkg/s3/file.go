@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotReachable is returned for objects which pods would have to reach by themselves
+var ErrNotReachable = errors.New("objects of the file-system object store are not reachable from pods")
+
+// fileStore keeps objects in files of the local file system, for running without an S3
+type fileStore struct {
+	dir string
+}
+
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+// path returns the file of an object, names of objects may not leave their bucket
+func (f *fileStore) path(bucket, name string) (string, error) {
+	path := filepath.Join(f.dir, bucket, filepath.FromSlash(name))
+	if !strings.HasPrefix(path, filepath.Join(f.dir, bucket)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return path, nil
+}
+
+func (f *fileStore) get(_ context.Context, bucket, name string) (io.ReadCloser, error) {
+	path, err := f.path(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (f *fileStore) put(_ context.Context, bucket, name string, reader io.Reader, _ int64, _ string) error {
+	path, err := f.path(bucket, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (f *fileStore) presign(context.Context, string, string, time.Duration) (string, error) {
+	return "", ErrNotReachable
+}
+
+func (f *fileStore) assumeRole(context.Context, string, time.Duration) (*ScopedCredentials, error) {
+	return nil, ErrNotReachable
+}
@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// minioStore keeps objects in an S3
+type minioStore struct {
+	client    *minio.Client
+	endpoint  string
+	accessKey string
+	secretKey string
+}
+
+func newMinioStore(url, accessKey, secretKey string) (*minioStore, error) {
+	client, err := minio.New(url, &minio.Options{
+		Creds:  credentials.NewStaticV2(accessKey, secretKey, ""),
+		Secure: false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &minioStore{
+		client:    client,
+		endpoint:  "http://" + url,
+		accessKey: accessKey,
+		secretKey: secretKey,
+	}, nil
+}
+
+func (m *minioStore) get(ctx context.Context, bucket, name string) (io.ReadCloser, error) {
+	return m.client.GetObject(ctx, bucket, name, minio.GetObjectOptions{})
+}
+
+func (m *minioStore) put(ctx context.Context, bucket, name string, reader io.Reader, size int64, contentType string) error {
+	_, err := m.client.PutObject(ctx, bucket, name, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (m *minioStore) presign(ctx context.Context, bucket, name string, expiry time.Duration) (string, error) {
+	u, err := m.client.PresignedGetObject(ctx, bucket, name, expiry, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
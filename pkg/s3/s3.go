@@ -1,38 +1,66 @@
 package s3
 
 import (
+	"bytes"
 	"context"
 	"io"
-	"os"
+	"time"
 
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/otel/attribute"
 	"sigs.k8s.io/yaml"
+
+	"github.com/Gimulator/hub/pkg/metrics"
+	"github.com/Gimulator/hub/pkg/tracing"
 )
 
-var s *minio.Client
+// store is the backend objects are read from and written to
+type store interface {
+	get(ctx context.Context, bucket, name string) (io.ReadCloser, error)
+	put(ctx context.Context, bucket, name string, reader io.Reader, size int64, contentType string) error
+	presign(ctx context.Context, bucket, name string, expiry time.Duration) (string, error)
+	assumeRole(ctx context.Context, policy string, duration time.Duration) (*ScopedCredentials, error)
+}
 
-func init() {
-	s3URL := os.Getenv("HUB_S3_URL")
-	s3AccessKey := os.Getenv("HUB_S3_ACCESS_KEY")
-	s3SecretKey := os.Getenv("HUB_S3_SECRET_KEY")
+var s store
 
-	if s3URL == "" || s3AccessKey == "" || s3SecretKey == "" {
-		panic("Invalid credential for S3: Set three environment variable HUB_S3_URL, HUB_S3_ACCESS_KEY, and HUB_S3_SECRET_Key for connecting to S3")
+// Setup connects to the S3 at url, it or SetupLocal must be called before any other function of the package
+func Setup(url, accessKey, secretKey string) error {
+	minioStore, err := newMinioStore(url, accessKey, secretKey)
+	if err != nil {
+		return err
 	}
 
-	var err error
-	s, err = minio.New(s3URL, &minio.Options{
-		Creds:  credentials.NewStaticV2(s3AccessKey, s3SecretKey, ""),
-		Secure: false,
-	})
+	s = minioStore
+	return nil
+}
+
+// SetupLocal keeps objects in sub-directories of dir named after their bucket, for running without an S3.
+// Pods can not reach these objects, so PresignedGetURL, ReadCredentials and WriteCredentials fail.
+func SetupLocal(dir string) error {
+	fileStore, err := newFileStore(dir)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	s = fileStore
+	return nil
+}
+
+// observe starts tracing a request to S3 and returns a function recording it, see tracing.End
+func observe(ctx context.Context, operation, bucket, name string) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "s3."+operation, attribute.String("bucket", bucket), attribute.String("object", name))
+	return ctx, func(err *error) {
+		metrics.S3Request(operation, start, *err)
+		tracing.End(span, err)
 	}
 }
 
-func GetStruct(ctx context.Context, bucket, name string, i interface{}) error {
-	reader, err := s.GetObject(ctx, bucket, name, minio.GetObjectOptions{})
+func GetStruct(ctx context.Context, bucket, name string, i interface{}) (err error) {
+	ctx, done := observe(ctx, "get", bucket, name)
+	defer done(&err)
+
+	reader, err := s.get(ctx, bucket, name)
 	if err != nil {
 		return err
 	}
@@ -49,20 +77,26 @@ func GetStruct(ctx context.Context, bucket, name string, i interface{}) error {
 	return nil
 }
 
-func GetBytes(ctx context.Context, bucket, name string) ([]byte, error) {
-	obj, err := s.GetObject(ctx, bucket, name, minio.GetObjectOptions{})
+// GetBytes returns the content of an object without its last byte
+func GetBytes(ctx context.Context, bucket, name string) (b []byte, err error) {
+	ctx, done := observe(ctx, "get", bucket, name)
+	defer done(&err)
+
+	reader, err := s.get(ctx, bucket, name)
 	if err != nil {
 		return nil, err
 	}
+	defer reader.Close()
 
-	stat, err := obj.Stat()
+	content, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, err
 	}
 
-	b := make([]byte, stat.Size-1)
-	_, err = obj.Read(b)
-	return b, err
+	if len(content) == 0 {
+		return content, nil
+	}
+	return content[:len(content)-1], nil
 }
 
 func GetString(ctx context.Context, bucket, name string) (string, error) {
@@ -70,12 +104,47 @@ func GetString(ctx context.Context, bucket, name string) (string, error) {
 	return string(bytes), err
 }
 
-func PutObject(ctx context.Context, reader io.ReadCloser, bucket string, name string) error {
+func PutObject(ctx context.Context, reader io.ReadCloser, bucket string, name string) (err error) {
+	ctx, done := observe(ctx, "put", bucket, name)
+	defer done(&err)
 	defer reader.Close()
-	if _, err := s.PutObject(ctx, bucket, name, reader, -1, minio.PutObjectOptions{
-		ContentType: "text/plain",
-	}); err != nil {
+
+	return s.put(ctx, bucket, name, reader, -1, "text/plain")
+}
+
+func PutStruct(ctx context.Context, i interface{}, bucket string, name string) (err error) {
+	ctx, done := observe(ctx, "put", bucket, name)
+	defer done(&err)
+
+	content, err := yaml.Marshal(i)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	return s.put(ctx, bucket, name, bytes.NewReader(content), int64(len(content)), "application/yaml")
+}
+
+func PresignedGetURL(ctx context.Context, bucket, name string, expiry time.Duration) (_ string, err error) {
+	ctx, done := observe(ctx, "presign", bucket, name)
+	defer done(&err)
+
+	return s.presign(ctx, bucket, name, expiry)
+}
+
+// ReadCredentials returns temporary credentials for pods which copy objects themselves,
+// which may only list and read the objects of bucket under prefix
+func ReadCredentials(ctx context.Context, bucket, prefix string, duration time.Duration) (_ *ScopedCredentials, err error) {
+	ctx, done := observe(ctx, "assumeRole", bucket, prefix)
+	defer done(&err)
+
+	return s.assumeRole(ctx, prefixPolicy(bucket, prefix, "s3:GetObject"), duration)
+}
+
+// WriteCredentials returns temporary credentials for pods which copy objects themselves,
+// which may only list and write the objects of bucket under prefix
+func WriteCredentials(ctx context.Context, bucket, prefix string, duration time.Duration) (_ *ScopedCredentials, err error) {
+	ctx, done := observe(ctx, "assumeRole", bucket, prefix)
+	defer done(&err)
+
+	return s.assumeRole(ctx, prefixPolicy(bucket, prefix, "s3:PutObject"), duration)
 }
@@ -0,0 +1,126 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+// minAssumeRoleDuration is the shortest lifetime of credentials the STS API issues
+const minAssumeRoleDuration = time.Minute * 15
+
+// ScopedCredentials are temporary credentials of S3 which are only allowed what their policy allows
+type ScopedCredentials struct {
+	URL          string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expiration   time.Time
+}
+
+// MCHost returns the value of the MC_HOST_<alias> environment variable which makes mc use the credentials,
+// i.e. "<scheme>://<access key>:<secret key>:<session token>@<host>"
+func (c *ScopedCredentials) MCHost() (string, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", err
+	}
+	userinfo := url.UserPassword(c.AccessKey, c.SecretKey).String() + ":" + url.PathEscape(c.SessionToken)
+	return fmt.Sprintf("%s://%s@%s", u.Scheme, userinfo, u.Host), nil
+}
+
+type policyStatement struct {
+	Effect    string                       `json:"Effect"`
+	Action    []string                     `json:"Action"`
+	Resource  []string                     `json:"Resource"`
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// prefixPolicy returns the session policy allowing actions on the objects of bucket under prefix,
+// and listing those objects
+func prefixPolicy(bucket, prefix string, actions ...string) string {
+	policy := struct {
+		Version   string            `json:"Version"`
+		Statement []policyStatement `json:"Statement"`
+	}{
+		Version: "2012-10-17",
+		Statement: []policyStatement{
+			{
+				Effect:   "Allow",
+				Action:   actions,
+				Resource: []string{fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, prefix)},
+			},
+			{
+				Effect:    "Allow",
+				Action:    []string{"s3:ListBucket"},
+				Resource:  []string{"arn:aws:s3:::" + bucket},
+				Condition: map[string]map[string]string{"StringLike": {"s3:prefix": prefix + "*"}},
+			},
+			{
+				Effect:   "Allow",
+				Action:   []string{"s3:GetBucketLocation"},
+				Resource: []string{"arn:aws:s3:::" + bucket},
+			},
+		},
+	}
+
+	data, _ := json.Marshal(policy)
+	return string(data)
+}
+
+// assumeRole asks the STS API of the S3 for credentials restricted by the session policy
+func (m *minioStore) assumeRole(ctx context.Context, policy string, duration time.Duration) (*ScopedCredentials, error) {
+	if duration < minAssumeRoleDuration {
+		duration = minAssumeRoleDuration
+	}
+
+	values := url.Values{}
+	values.Set("Action", "AssumeRole")
+	values.Set("Version", credentials.STSVersion)
+	values.Set("DurationSeconds", strconv.Itoa(int(duration.Seconds())))
+	values.Set("Policy", policy)
+	body := values.Encode()
+	hash := sha256.Sum256([]byte(body))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint+"/", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	req = signer.SignV4STS(*req, m.accessKey, m.secretKey, "")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not assume role: %s", resp.Status)
+	}
+
+	response := credentials.AssumeRoleResponse{}
+	if err := xml.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	result := response.Result.Credentials
+	return &ScopedCredentials{
+		URL:          m.endpoint,
+		AccessKey:    result.AccessKey,
+		SecretKey:    result.SecretKey,
+		SessionToken: result.SessionToken,
+		Expiration:   result.Expiration,
+	}, nil
+}
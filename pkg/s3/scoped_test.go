@@ -0,0 +1,116 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixPolicy(t *testing.T) {
+	policy := struct {
+		Statement []policyStatement
+	}{}
+	if err := json.Unmarshal([]byte(prefixPolicy("outputs", "room-1/alice/", "s3:PutObject")), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Statement) != 3 {
+		t.Fatalf("statements = %+v, want objects, listing and the bucket location", policy.Statement)
+	}
+
+	objects, listing := policy.Statement[0], policy.Statement[1]
+	if len(objects.Action) != 1 || objects.Action[0] != "s3:PutObject" || objects.Resource[0] != "arn:aws:s3:::outputs/room-1/alice/*" {
+		t.Errorf("object statement = %+v, want only writing objects under the prefix", objects)
+	}
+	if listing.Resource[0] != "arn:aws:s3:::outputs" || listing.Condition["StringLike"]["s3:prefix"] != "room-1/alice/*" {
+		t.Errorf("listing statement = %+v, want listing only under the prefix", listing)
+	}
+}
+
+func TestMCHost(t *testing.T) {
+	credentials := &ScopedCredentials{
+		URL:          "http://minio:9000",
+		AccessKey:    "ACCESS",
+		SecretKey:    "se/cr+et",
+		SessionToken: "token.part",
+	}
+	got, err := credentials.MCHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://ACCESS:se%2Fcr+et:token.part@minio:9000"; got != want {
+		t.Errorf("MCHost() = %q, want %q", got, want)
+	}
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password, _ := u.User.Password(); password != "se/cr+et:token.part" {
+		t.Errorf("password = %q, want the secret key and the session token", password)
+	}
+}
+
+func TestAssumeRole(t *testing.T) {
+	expiration := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=operator/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err := req.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		form = req.PostForm
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials>
+<AccessKeyId>TEMP</AccessKeyId><SecretAccessKey>temp-secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>%s</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`, expiration.Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	store, err := newMinioStore(strings.TrimPrefix(server.URL, "http://"), "operator", "operator-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := prefixPolicy("datasets", "images/", "s3:GetObject")
+	credentials, err := store.assumeRole(context.Background(), policy, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.AccessKey != "TEMP" || credentials.SecretKey != "temp-secret" || credentials.SessionToken != "token" ||
+		!credentials.Expiration.Equal(expiration) || credentials.URL != server.URL {
+		t.Errorf("assumeRole() = %+v", credentials)
+	}
+	if form.Get("Action") != "AssumeRole" || form.Get("Policy") != policy {
+		t.Errorf("form = %v, want an AssumeRole request with the policy", form)
+	}
+	if form.Get("DurationSeconds") != "900" {
+		t.Errorf("DurationSeconds = %q, short durations should be raised to the minimum", form.Get("DurationSeconds"))
+	}
+
+	denied, err := newMinioStore(strings.TrimPrefix(server.URL, "http://"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := denied.assumeRole(context.Background(), policy, time.Hour); err == nil {
+		t.Error("assumeRole() should fail if the STS API refuses")
+	}
+}
+
+func TestLocalCredentials(t *testing.T) {
+	if err := SetupLocal(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCredentials(context.Background(), "datasets", "", time.Hour); !errors.Is(err, ErrNotReachable) {
+		t.Errorf("ReadCredentials() error = %v, want ErrNotReachable", err)
+	}
+}
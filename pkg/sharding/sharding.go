@@ -0,0 +1,66 @@
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+)
+
+// Enabled returns true if rooms are split between several shards
+func Enabled(config v1alpha1.ShardingConfig) bool {
+	return config.Shards > 1
+}
+
+// Shard returns the shard of this replica, zero if rooms are not sharded
+func Shard(config v1alpha1.ShardingConfig) int32 {
+	if !Enabled(config) {
+		return 0
+	}
+	return *config.Shard
+}
+
+// ShardOf returns the shard of the room with the given ID
+func ShardOf(roomID string, shards int32) int32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(roomID))
+	return int32(hash.Sum32() % uint32(shards))
+}
+
+// Owns returns true if the room with the given ID belongs to the shard of this replica
+func Owns(config v1alpha1.ShardingConfig, roomID string) bool {
+	if !Enabled(config) {
+		return true
+	}
+	return ShardOf(roomID, config.Shards) == Shard(config)
+}
+
+// IsPrimary returns true for the shard which also reconciles the objects shared by rooms of all shards,
+// such as the image warmer, datasets and outputs. While every replica of the primary shard is down,
+// images are not warmed and unused datasets and outputs are not cleaned up, so the primary shard
+// should run as many replicas as the others.
+func IsPrimary(config v1alpha1.ShardingConfig) bool {
+	return Shard(config) == 0
+}
+
+// FromHostname returns the ordinal of a StatefulSet pod from its hostname, e.g. 2 for hub-2
+func FromHostname() (int32, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	return ordinal(hostname)
+}
+
+// ordinal returns the number after the last dash of hostname
+func ordinal(hostname string) (int32, error) {
+	i := strings.LastIndex(hostname, "-")
+	n, err := strconv.ParseInt(hostname[i+1:], 10, 32)
+	if i < 0 || err != nil || n < 0 {
+		return 0, fmt.Errorf("hostname %s does not end with an ordinal", hostname)
+	}
+	return int32(n), nil
+}
@@ -0,0 +1,88 @@
+package sharding
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Gimulator/hub/api/config/v1alpha1"
+)
+
+func TestShardOf(t *testing.T) {
+	const shards = 4
+
+	counts := make([]int, shards)
+	for i := 0; i < 1000; i++ {
+		roomID := fmt.Sprintf("room-%d", i)
+		shard := ShardOf(roomID, shards)
+		if shard < 0 || shard >= shards {
+			t.Fatalf("ShardOf(%q, %d) = %d is not a shard", roomID, shards, shard)
+		}
+		if again := ShardOf(roomID, shards); again != shard {
+			t.Fatalf("ShardOf(%q, %d) returned %d and then %d", roomID, shards, shard, again)
+		}
+		counts[shard]++
+	}
+
+	// fnv spreads IDs evenly enough that no shard is left with a small share of the rooms
+	for shard, count := range counts {
+		if count < 150 {
+			t.Errorf("shard %d owns %d of 1000 rooms", shard, count)
+		}
+	}
+}
+
+func TestOwns(t *testing.T) {
+	shard := func(n int32) *int32 { return &n }
+
+	tests := []struct {
+		name    string
+		config  v1alpha1.ShardingConfig
+		primary bool
+	}{
+		{name: "not sharded", config: v1alpha1.ShardingConfig{}, primary: true},
+		{name: "single shard", config: v1alpha1.ShardingConfig{Shards: 1}, primary: true},
+		{name: "first of three", config: v1alpha1.ShardingConfig{Shards: 3, Shard: shard(0)}, primary: true},
+		{name: "last of three", config: v1alpha1.ShardingConfig{Shards: 3, Shard: shard(2)}, primary: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPrimary(tt.config); got != tt.primary {
+				t.Errorf("IsPrimary() = %v, want %v", got, tt.primary)
+			}
+			for i := 0; i < 100; i++ {
+				roomID := fmt.Sprintf("room-%d", i)
+				want := !Enabled(tt.config) || ShardOf(roomID, tt.config.Shards) == *tt.config.Shard
+				if got := Owns(tt.config, roomID); got != want {
+					t.Errorf("Owns(%q) = %v, want %v", roomID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     int32
+		err      bool
+	}{
+		{hostname: "hub-0", want: 0},
+		{hostname: "hub-controller-manager-12", want: 12},
+		{hostname: "hub", err: true},
+		{hostname: "hub-", err: true},
+		{hostname: "hub-abc", err: true},
+		{hostname: "hub-99999999999", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ordinal(tt.hostname)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ordinal(%q) = %d, want an error", tt.hostname, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ordinal(%q) = %d, %v, want %d", tt.hostname, got, err, tt.want)
+		}
+	}
+}
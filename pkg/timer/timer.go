@@ -3,191 +3,125 @@ package timer
 import (
 	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 
 	hubv1 "github.com/Gimulator/hub/api/v1"
 	"github.com/Gimulator/hub/pkg/client"
+	"github.com/Gimulator/hub/pkg/logging"
+	"github.com/Gimulator/hub/pkg/metrics"
 	"github.com/Gimulator/hub/pkg/name"
+	"github.com/Gimulator/hub/pkg/naming"
 	"github.com/Gimulator/hub/pkg/reporter"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 )
 
+// Timer terminates rooms whose actors run longer than the timeout of the room. It keeps no state
+// of its own: deadlines are derived from the start times of the actor containers and the report
+// of a timeout is recorded in the status of the room, so any replica can take over a room.
 type Timer struct {
-	clientSet *kubernetes.Clientset
 	hubClient *client.Client
-	timers    map[string]uint64 // map each pod to its timeout threshold
-	mutex     sync.Mutex
 	log       logr.Logger
 	reporter  *reporter.Reporter
+	recorder  record.EventRecorder
 }
 
-func NewTimer(clientSet *kubernetes.Clientset, log logr.Logger, reporter *reporter.Reporter, client *client.Client) (*Timer, error) {
+func NewTimer(log logr.Logger, reporter *reporter.Reporter, client *client.Client, recorder record.EventRecorder) (*Timer, error) {
 	logger := log.WithValues("package", "Timer")
 
 	return &Timer{
-		clientSet: clientSet,
 		hubClient: client,
-		timers:    make(map[string]uint64),
 		log:       logger,
 		reporter:  reporter,
+		recorder:  recorder,
 	}, nil
 }
 
-// SyncTimers
-// StartTimer initiates a timer for every actor/director pod if necessary
-// At the moment, every pod timer is supplied with the same threshold value but the code is ready to accept various values as threshold for any pod.
-func (t *Timer) SyncTimers(room *hubv1.Room) {
+// Check terminates the room if one of its actors has run for longer than the timeout and returns true.
+// Otherwise it returns the time until the first running actor reaches the timeout, zero if no actor is running.
+func (t *Timer) Check(ctx context.Context, room *hubv1.Room) (time.Duration, bool, error) {
 	if room.Spec.Timeout <= 0 {
-		return
+		return 0, false, nil
 	}
 
-	//directorPodName := name.DirectorPodName(room.Spec.Director.Name)
-	//if _, ok := t.timers[directorPodName]; ok {
-	//	t.log.WithValues("podName", directorPodName).Info("Timer for pod exists.")
-	//} else {
-	//	t.timers[directorPodName] = room.Spec.Timeout
-	//	go t.startPodTimer(directorPodName, room)
-	//}
+	logger := logging.Logger(ctx, t.log)
+	timeout := time.Duration(room.Spec.Timeout) * time.Second
 
-	for _, actor := range room.Spec.Actors {
-		actorPodName := name.ActorPodName(actor.Name)
-		if _, ok := t.timers[actorPodName]; ok {
-			t.log.WithValues("podName", actorPodName).Info("Timer for pod exists.")
-		} else {
-			t.timers[actorPodName] = room.Spec.Timeout
-			go t.startPodTimer(actorPodName, room)
-		}
+	if room.Status.TimedOut {
+		logger.Info("room timed out, starting to report timeout and delete room")
+		return 0, true, t.reportAndDelete(ctx, room)
 	}
-}
 
-// startPodTimer measures the age of a running actor/director pod and kills the room if a pod's age exceeds the given limit.
-// Please note that this function DOES return an error object (if there's any) but because it's supposed to run as a goroutine you cannot actually receive/observe the given error.
-// TODO: Error handling of this method needs some work.
-// TODO: Will be more efficient to use time.NewTimer
-func (t *Timer) startPodTimer(podName string, room *hubv1.Room) error {
-	ctx := context.TODO()
-
-	startTime, err := t.waitForPod(ctx, room, podName, -1) // TODO: not sure if notFoundThreshold should be dynamic or not.
-	if err != nil {
-		t.deleteTimer(podName)
-		return err
-	}
-
-	for {
-		isRunning, err := t.isPodRunning(ctx, room, podName)
+	var next time.Duration
+	for _, actor := range room.Spec.Actors {
+		podName := naming.ActorPodName(room, actor.Name)
+		startTime, err := t.startTime(ctx, room, podName)
 		if err != nil {
-			t.deleteTimer(podName)
-			return err
+			return 0, false, err
 		}
-
-		if !isRunning {
-			t.deleteTimer(podName)
-			return nil
+		if startTime.IsZero() {
+			continue
 		}
 
-		timeout, ok := t.timers[podName]
-
-		// The timer has been deleted by another goroutine
-		// FIXME: Use a better approach to avoid this
-		if !ok {
-			return nil
+		remaining := timeout - time.Since(startTime)
+		if remaining <= 0 {
+			logger.Info("pod reached the timeout, starting to terminate room", "pod", podName, "timeout", room.Spec.Timeout)
+			return 0, true, t.terminate(ctx, room, podName)
 		}
-
-		// Pod time has reached the timeout
-		if diff := time.Now().Sub(startTime); diff.Seconds() > float64(timeout) {
-			break
+		if next == 0 || remaining < next {
+			next = remaining
 		}
-
-		time.Sleep(time.Second * 2)
 	}
 
-	// limit has been exceeded. Must report and terminate the room.
-	t.log.Info(fmt.Sprintf("Pod '%s' has reached the timeout threshold. Terminating the room.", podName))
+	return next, false, nil
+}
 
-	// Report result to rabbit
-	if err := t.reporter.ReportTimeout(room, t.timers[podName]); err != nil {
-		return err
+// startTime returns when the actor container of the pod started running,
+// or the zero time if it is not running
+func (t *Timer) startTime(ctx context.Context, room *hubv1.Room, podName string) (time.Time, error) {
+	pod, err := t.hubClient.GetPod(ctx, types.NamespacedName{Name: podName, Namespace: room.WorkloadNamespace()})
+	if errors.IsNotFound(err) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
 	}
 
-	// Kill all the timers for the room since it's timed out
-	t.deleteTimers(room)
-
-	// Delete the room
-	return t.hubClient.DeleteRoom(ctx, room)
-}
-
-// waitForPod waits until the pod is in Running phase and then returns the time its status has changed to running state.
-// `notFoundRetries` will be ignored if -1 is passed.
-func (t *Timer) waitForPod(ctx context.Context, room *hubv1.Room, podName string, notFoundRetries int) (time.Time, error) {
-	var pod *corev1.Pod
-	var err error
-
-	for {
-		if pod, err = t.clientSet.CoreV1().Pods(room.Namespace).Get(ctx, podName, metav1.GetOptions{}); err != nil {
-			// Return the error if retrieving the pod had any errors other than "Not Found"
-			if !errors.IsNotFound(err) {
-				return time.Time{}, err
-			}
-
-			// Pod is not found
-			if notFoundRetries -= 1; notFoundRetries == -1 {
-				return time.Time{}, fmt.Errorf("could not find pod '%s'", podName)
-			}
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Name != name.ActorContainerName() {
 			continue
 		}
-
-		// Pod has been found. Checking if its container is in running state
-		for _, containerStatus := range pod.Status.ContainerStatuses {
-			t.log.Info(fmt.Sprintf("Pod %s => %v", podName, pod.Status.ContainerStatuses))
-			if containerStatus.State.Running != nil {
-				return containerStatus.State.Running.StartedAt.Time, nil
-			}
+		if containerStatus.State.Running != nil {
+			return containerStatus.State.Running.StartedAt.Time, nil
 		}
-
-		time.Sleep(time.Second * 1)
 	}
+	return time.Time{}, nil
 }
 
-// isPodRunning checks if the pod is in running state or not.
-func (t *Timer) isPodRunning(ctx context.Context, room *hubv1.Room, podName string) (bool, error) {
-	var pod *corev1.Pod
-	var err error
+// terminate records the timeout in the status of the room before reporting it and deleting the room,
+// so a failed report is retried by whichever replica reconciles the room next
+func (t *Timer) terminate(ctx context.Context, room *hubv1.Room, podName string) error {
+	t.recorder.Event(room, corev1.EventTypeWarning, "Timeout", fmt.Sprintf("Pod %s reached the timeout of %d seconds", podName, room.Spec.Timeout))
 
-	if pod, err = t.clientSet.CoreV1().Pods(room.Namespace).Get(ctx, podName, metav1.GetOptions{}); err != nil {
-		return false, err
-	}
-
-	// Pod has been found. Checking if its container is in terminated state
-	for _, containerStatus := range pod.Status.ContainerStatuses {
-		t.log.Info(fmt.Sprintf("Pod %s => %v", podName, pod.Status.ContainerStatuses))
-		if containerStatus.State.Terminated != nil {
-			return false, nil
-		}
+	room.Status.TimedOut = true
+	syncedRoom, err := t.hubClient.SyncRoom(ctx, room)
+	if err != nil {
+		return err
 	}
+	metrics.RoomFinished(syncedRoom, metrics.OutcomeTimeout)
 
-	return true, nil
+	return t.reportAndDelete(ctx, syncedRoom)
 }
 
-// deleteTimers kills all the timers for a room.
-func (t *Timer) deleteTimers(room *hubv1.Room) {
-	//t.deleteTimer(name.DirectorPodName(room.Spec.Director.Name))
-	for _, actor := range room.Spec.Actors {
-		t.deleteTimer(name.ActorPodName(actor.Name))
+// reportAndDelete reports the timeout of a timed out room and deletes it. If deleting the room fails,
+// the timeout is reported again by the next reconcile, since a lost result is worse than a repeated one.
+func (t *Timer) reportAndDelete(ctx context.Context, room *hubv1.Room) error {
+	if err := t.reporter.ReportTimeout(ctx, room, room.Spec.Timeout); err != nil {
+		return err
 	}
-}
-
-// deleteTimer kills the timer for a pod.
-func (t *Timer) deleteTimer(podName string) {
-	t.mutex.Lock()
-
-	delete(t.timers, name.ActorPodName(podName))
-
-	t.mutex.Unlock()
+	return t.hubClient.DeleteRoom(ctx, room)
 }
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	traced := func(fail bool) (err error) {
+		_, span := Start(context.Background(), "traced", attribute.String("room", "room-1"))
+		defer End(span, &err)
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	}
+	_ = traced(false)
+	_ = traced(true)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended %d spans, want 2", len(spans))
+	}
+	if status := spans[0].Status(); status.Code == codes.Error {
+		t.Errorf("status = %v, want no error", status)
+	}
+	if status := spans[1].Status(); status.Code != codes.Error || status.Description != "failed" {
+		t.Errorf("status = %v, want the returned error", status)
+	}
+	if attrs := spans[1].Attributes(); len(attrs) != 1 || attrs[0].Value.AsString() != "room-1" {
+		t.Errorf("attributes = %v, want the room", attrs)
+	}
+}